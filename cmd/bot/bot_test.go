@@ -3,8 +3,11 @@ package main
 import (
 	"reflect"
 	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bcmk/siren/internal/botconfig"
 	"github.com/bcmk/siren/internal/db"
 	"github.com/bcmk/siren/lib/cmdlib"
 	tg "github.com/bcmk/telegram-bot-api"
@@ -297,6 +300,63 @@ func TestUpdateStatus(t *testing.T) {
 	_ = w.db.Close()
 }
 
+func TestSubStateNotifications(t *testing.T) {
+	w := newTestWorker()
+	defer w.terminate()
+	w.createDatabase(make(chan bool, 1))
+	w.initCache()
+	cfg := testConfig
+	cfg.SubStateNotifications = true
+	w.cfg = &cfg
+	w.db.MustExec("insert into users (chat_id, sub_state_notifications) values ($1, $2)", 1, true)
+	w.db.MustExec("insert into users (chat_id) values ($1)", 2)
+	w.db.MustExec("insert into signals (endpoint, chat_id, model_id) values ($1, $2, $3)", "test", 1, "a")
+	w.db.MustExec("insert into signals (endpoint, chat_id, model_id) values ($1, $2, $3)", "test", 2, "a")
+	_, _, nots, _ := w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOnline, SubState: cmdlib.SubStatePublic}}, 18)
+	if len(nots) != 2 || nots[0].SubState != cmdlib.SubStateUnknown || nots[1].SubState != cmdlib.SubStateUnknown {
+		t.Errorf("unexpected notifications: %v", nots)
+	}
+	_, _, nots, _ = w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOnline, SubState: cmdlib.SubStatePrivate}}, 19)
+	if len(nots) != 1 || nots[0].ChatID != 1 || nots[0].SubState != cmdlib.SubStatePrivate {
+		t.Errorf("unexpected notifications: %v", nots)
+	}
+	if statuses := w.db.StatusesForChat("test", 1); len(statuses) != 1 || statuses[0].SubState != cmdlib.SubStatePrivate {
+		t.Errorf("unexpected statuses: %v", statuses)
+	}
+	_, _, nots, _ = w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOnline, SubState: cmdlib.SubStatePrivate}}, 20)
+	if len(nots) != 0 {
+		t.Errorf("unexpected notifications: %v", nots)
+	}
+	if subStates := w.db.QueryLastSubStates(); !reflect.DeepEqual(subStates, map[string]cmdlib.SubState{"a": cmdlib.SubStatePrivate}) {
+		t.Errorf("unexpected sub-states: %v", subStates)
+	}
+}
+
+func TestSubStateLastSeen(t *testing.T) {
+	w := newTestWorker()
+	defer w.terminate()
+	w.createDatabase(make(chan bool, 1))
+	w.initCache()
+	cfg := testConfig
+	cfg.StatusConfirmationSeconds.Online = 5
+	w.cfg = &cfg
+	w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOnline, SubState: cmdlib.SubStatePublic}}, 18)
+	w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOnline, SubState: cmdlib.SubStatePrivate}}, 20)
+	checkInv(&w.worker, t)
+	if _, n, _, _ := w.processStatusUpdates([]cmdlib.StatusUpdate{}, 23); n != 1 || !w.ourOnline["a"] {
+		t.Error("the sub-state change restarts the confirmation")
+	}
+	if subStates := w.db.QueryLastSubStates(); !reflect.DeepEqual(subStates, map[string]cmdlib.SubState{"a": cmdlib.SubStatePrivate}) {
+		t.Errorf("unexpected sub-states: %v", subStates)
+	}
+	w.processStatusUpdates([]cmdlib.StatusUpdate{{ModelID: "a", Status: cmdlib.StatusOffline}}, 30)
+	checkInv(&w.worker, t)
+	if begin, end, prevStatus := w.db.LastSeenInfo("a"); begin != 18 || end != 30 || prevStatus != cmdlib.StatusUnknown {
+		t.Errorf("unexpected last seen info: %d, %d, %v", begin, end, prevStatus)
+	}
+	_ = w.db.Close()
+}
+
 func TestCleanStatuses(t *testing.T) {
 	const day = 60 * 60 * 24
 	w := newTestWorker()
@@ -427,6 +487,34 @@ func TestNotificationsStorage(t *testing.T) {
 	}
 }
 
+func TestRenameModel(t *testing.T) {
+	w := newTestWorker()
+	defer w.terminate()
+	w.createDatabase(make(chan bool, 1))
+	w.initCache()
+	w.db.MustExec("insert into signals (endpoint, chat_id, model_id) values ($1, $2, $3)", "test", 1, "a")
+	w.db.MustExec("insert into signals (endpoint, chat_id, model_id) values ($1, $2, $3)", "test", 1, "b")
+	w.db.MustExec("insert into signals (endpoint, chat_id, model_id) values ($1, $2, $3)", "test", 2, "a")
+	w.db.StoreNotifications([]db.Notification{{Endpoint: "test", ChatID: 2, ModelID: "a", Status: cmdlib.StatusOnline}})
+	subs := w.db.RenameModel("a", "b")
+	if !reflect.DeepEqual(subs, []db.Subscription{{Endpoint: "test", ChatID: 2, ModelID: "b"}}) {
+		t.Errorf("unexpected subscriptions: %v", subs)
+	}
+	if count := w.db.MustInt("select count(*) from signals where model_id = $1", "b"); count != 2 {
+		t.Errorf("unexpected subscriptions count %d", count)
+	}
+	if count := w.db.MustInt("select count(*) from notification_queue where model_id = $1", "b"); count != 1 {
+		t.Errorf("the queued notification is not moved")
+	}
+
+	w.ourOnline["c"] = true
+	w.siteOnline["c"] = true
+	w.renameModel("c", "d")
+	if w.ourOnline["c"] || !w.ourOnline["d"] || w.siteOnline["c"] || !w.siteOnline["d"] {
+		t.Errorf("the online caches are not moved, ours: %v, site: %v", w.ourOnline, w.siteOnline)
+	}
+}
+
 func TestModels(t *testing.T) {
 	w := newTestWorker()
 	defer w.terminate()
@@ -567,3 +655,135 @@ func checkInv(w *worker, t *testing.T) {
 		t.Log(string(debug.Stack()))
 	}
 }
+
+func TestSiteModelIDs(t *testing.T) {
+	w := &worker{sites: map[string]*site{
+		"chaturbate": newSite("chaturbate", "chaturbate", 1, nil, nil),
+		"stripchat":  newSite("stripchat", "stripchat", 1, nil, nil),
+	}}
+	if modelID, valid := w.parseModelID("chaturbate/Alice"); !valid || modelID != "chaturbate/alice" {
+		t.Errorf("unexpected result %s %v", modelID, valid)
+	}
+	if modelID, valid := w.parseModelID("Stripchat/alice"); !valid || modelID != "stripchat/alice" {
+		t.Errorf("unexpected result %s %v", modelID, valid)
+	}
+	if _, valid := w.parseModelID("alice"); valid {
+		t.Error("unexpected result")
+	}
+	if _, valid := w.parseModelID("bongacams/alice"); valid {
+		t.Error("unexpected result")
+	}
+	w = &worker{sites: map[string]*site{"": newSite("", "chaturbate", 1, nil, nil)}}
+	if modelID, valid := w.parseModelID("https://chaturbate.com/alice/"); !valid || modelID != "alice" {
+		t.Errorf("unexpected result %s %v", modelID, valid)
+	}
+	models := map[string]bool{"chaturbate/alice": true, "stripchat/alice": true, "stripchat/bob": true}
+	if !reflect.DeepEqual(forSite(models, "stripchat"), map[string]bool{"alice": true, "bob": true}) {
+		t.Error("unexpected result")
+	}
+	if !reflect.DeepEqual(forSite(models, ""), models) {
+		t.Error("unexpected result")
+	}
+	res := namespaceStatusResults("stripchat", cmdlib.StatusResults{Data: &cmdlib.StatusResultsData{
+		Statuses: map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline},
+		Info:     map[string]cmdlib.StreamInfo{"alice": {ImageURL: "image"}},
+		UserIDs:  map[string]string{"alice": "1"},
+		Renames:  map[string]string{"bob": "alice"},
+	}})
+	if !reflect.DeepEqual(res.Data.Statuses, map[string]cmdlib.StatusKind{"stripchat/alice": cmdlib.StatusOnline}) ||
+		!reflect.DeepEqual(res.Data.Info, map[string]cmdlib.StreamInfo{"stripchat/alice": {ImageURL: "image"}}) ||
+		!reflect.DeepEqual(res.Data.UserIDs, map[string]string{"stripchat/alice": "1"}) ||
+		!reflect.DeepEqual(res.Data.Renames, map[string]string{"stripchat/bob": "stripchat/alice"}) {
+		t.Error("unexpected result")
+	}
+	userIDs := map[string]string{"twitch/alice": "1", "stripchat/bob": "2"}
+	if !reflect.DeepEqual(forSite(userIDs, "twitch"), map[string]string{"alice": "1"}) {
+		t.Error("unexpected result")
+	}
+}
+
+func TestAffiliateLink(t *testing.T) {
+	link := affiliateLink(&botconfig.Config{
+		AffiliateLink: "https://example.com/{{ . }}",
+		Websites: map[string]botconfig.Website{
+			"chaturbate": {},
+			"stripchat":  {AffiliateLink: "https://stripchat.com/{{ . }}?ref=1"},
+		},
+	})
+	cases := map[string]string{
+		"stripchat/alice":  "https://stripchat.com/alice?ref=1",
+		"chaturbate/alice": "https://example.com/chaturbate/alice",
+		"alice":            "https://example.com/alice",
+	}
+	for modelID, expected := range cases {
+		if got, err := link(modelID); err != nil || got != expected {
+			t.Errorf("wrong link for %s, expected: %s, got: %s, %v", modelID, expected, got, err)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	w := &worker{
+		sites: map[string]*site{
+			"chaturbate": newSite("chaturbate", "chaturbate", 1, nil, nil),
+			"stripchat":  newSite("stripchat", "stripchat", 1, nil, nil),
+		},
+		db:              db.Database{Durations: map[string]db.QueryDurationsData{"db: \"quoted\"": {Avg: 0.5, Count: 4}}},
+		ourOnline:       map[string]bool{"chaturbate/alice": true, "chaturbate/bob": true},
+		highPriorityMsg: make(chan outgoingPacket, 10),
+		lowPriorityMsg:  make(chan outgoingPacket, 10),
+		metrics:         newBotMetrics(),
+	}
+	w.lowPriorityMsg <- outgoingPacket{}
+	w.observePolls("chaturbate", &cmdlib.StatusUpdateResultsData{
+		Elapsed:          3 * time.Second,
+		EndpointsElapsed: map[string]time.Duration{"https://chaturbate.com/api/online?key=secret": 2 * time.Second},
+	})
+	w.observePolls("chaturbate", &cmdlib.StatusUpdateResultsData{
+		Elapsed:          21 * time.Second,
+		EndpointsElapsed: map[string]time.Duration{"https://chaturbate.com/api/online?key=secret": 20 * time.Second},
+	})
+	w.observePolls("stripchat", &cmdlib.StatusUpdateResultsData{Elapsed: time.Second})
+	w.metrics.countStatusChange(w.modelSite("stripchat/alice"), false)
+	w.metrics.countStatusChange(w.modelSite("stripchat/alice"), true)
+	w.metrics.countSendResult(msgSendResult{endpoint: "main", priority: 1, result: messageBlocked})
+	w.metrics.countSendResult(msgSendResult{endpoint: "main", priority: 1, result: messageBlocked})
+	w.metrics.countImageDownload("chaturbate", false)
+	var out strings.Builder
+	if err := w.writeMetrics(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`siren_poll_duration_seconds_bucket{checker="chaturbate",endpoint="chaturbate.com/api/online",le="1"} 0`,
+		`siren_poll_duration_seconds_bucket{checker="chaturbate",endpoint="chaturbate.com/api/online",le="2.5"} 1`,
+		`siren_poll_duration_seconds_bucket{checker="chaturbate",endpoint="chaturbate.com/api/online",le="30"} 2`,
+		`siren_poll_duration_seconds_bucket{checker="chaturbate",endpoint="chaturbate.com/api/online",le="+Inf"} 2`,
+		`siren_poll_duration_seconds_sum{checker="chaturbate",endpoint="chaturbate.com/api/online"} 22`,
+		`siren_poll_duration_seconds_count{checker="stripchat",endpoint=""} 1`,
+		`siren_online_models{checker="chaturbate"} 2`,
+		`siren_online_models{checker="stripchat"} 0`,
+		`siren_status_changes_total{checker="stripchat"} 1`,
+		`siren_confirmed_status_changes_total{checker="stripchat"} 1`,
+		`siren_image_download_errors_total{checker="chaturbate"} 1`,
+		`siren_telegram_send_results_total{endpoint="main",priority="low",code="403"} 2`,
+		`siren_outgoing_queue_length{priority="high"} 0`,
+		`siren_outgoing_queue_length{priority="low"} 1`,
+		`siren_db_query_duration_seconds_sum{query="db: \"quoted\""} 2`,
+		`siren_db_query_duration_seconds_count{query="db: \"quoted\""} 4`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("the metrics do not contain %s, got:\n%s", line, out.String())
+		}
+	}
+
+	w.sites = map[string]*site{"": newSite("", "chaturbate", 1, nil, nil)}
+	w.ourOnline = map[string]bool{"alice": true}
+	out.Reset()
+	if err := w.writeMetrics(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `siren_online_models{checker="chaturbate"} 1`+"\n") {
+		t.Errorf("wrong metrics for a single website, got:\n%s", out.String())
+	}
+}
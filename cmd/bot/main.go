@@ -3,6 +3,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -12,10 +13,10 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path"
-	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -54,6 +55,11 @@ type timeDiff struct {
 	Nanoseconds int
 }
 
+type downloadResult struct {
+	site    string
+	success bool
+}
+
 type statRequest struct {
 	endpoint string
 	writer   http.ResponseWriter
@@ -62,41 +68,42 @@ type statRequest struct {
 }
 
 type worker struct {
-	db                       db.Database
-	clients                  []*cmdlib.Client
-	bots                     map[string]*tg.BotAPI
-	cfg                      *botconfig.Config
-	httpQueriesDuration      time.Duration
-	updatesDuration          time.Duration
-	cleaningDuration         time.Duration
-	changesInPeriod          int
-	confirmedChangesInPeriod int
-	ourOnline                map[string]bool
-	specialModels            map[string]bool
-	siteOnline               map[string]bool
-	tr                       map[string]*cmdlib.Translations
-	tpl                      map[string]*template.Template
-	trAds                    map[string]map[string]*cmdlib.Translation
-	tplAds                   map[string]*template.Template
-	modelIDPreprocessing     func(string) string
-	checker                  cmdlib.Checker
-	unsuccessfulRequests     []bool
-	unsuccessfulRequestsPos  int
-	downloadResults          chan bool
-	downloadErrors           []bool
-	downloadResultsPos       int
-	nextErrorReport          time.Time
-	images                   map[string]string
-	botNames                 map[string]string
-	lowPriorityMsg           chan outgoingPacket
-	highPriorityMsg          chan outgoingPacket
-	outgoingMsgResults       chan msgSendResult
-	unconfirmedSubsResults   chan cmdlib.StatusResults
-	onlineModelsChan         chan cmdlib.StatusUpdateResults
-	sendingNotifications     chan []db.Notification
-	sentNotifications        chan []db.Notification
-	ourIDs                   []int64
-	modelIDRegexp            *regexp.Regexp
+	db                     db.Database
+	clients                []*cmdlib.Client
+	bots                   map[string]*tg.BotAPI
+	cfg                    *botconfig.Config
+	httpQueriesDurations   map[string]time.Duration
+	updates                map[string]updatesStat
+	cleaningDuration       time.Duration
+	ourOnline              map[string]bool
+	specialModels          map[string]bool
+	siteOnline             map[string]bool
+	tr                     map[string]*cmdlib.Translations
+	tpl                    map[string]*template.Template
+	trAds                  map[string]map[string]*cmdlib.Translation
+	tplAds                 map[string]*template.Template
+	sites                  map[string]*site
+	queryErrors            []*queryError
+	queryErrorsPos         int
+	downloadResults        chan downloadResult
+	downloadErrors         []bool
+	downloadResultsPos     int
+	nextErrorReport        time.Time
+	quarantineAlerts       map[*cmdlib.Client]int64
+	failureLog             *cmdlib.FailureLog
+	metrics                *botMetrics
+	info                   map[string]map[string]cmdlib.StreamInfo
+	coverage               map[string]cmdlib.Coverage
+	botNames               map[string]string
+	lowPriorityMsg         chan outgoingPacket
+	highPriorityMsg        chan outgoingPacket
+	outgoingMsgResults     chan msgSendResult
+	unconfirmedSubsResults chan cmdlib.StatusResults
+	renameCheckResults     chan cmdlib.StatusResults
+	onlineModelsChan       chan siteStatusUpdateResults
+	sendingNotifications   chan []db.Notification
+	sentNotifications      chan []db.Notification
+	ourIDs                 []int64
 }
 
 type incomingPacket struct {
@@ -131,6 +138,9 @@ const (
 	messageChatNotFound        = -5
 )
 
+// maxListTitleLength is the maximum length of a stream title in the list of models
+const maxListTitleLength = 24
+
 type msgSendResult struct {
 	priority  int
 	timestamp int
@@ -150,13 +160,39 @@ func newWorker(args []string) *worker {
 	if len(args) != 1 {
 		panic("usage: siren <config>")
 	}
-	cfg := botconfig.ReadConfig(args[0])
+	cfg := botconfig.ReadConfig(args[0], checkers.SpecificConfig)
 
 	var err error
 
 	var clients []*cmdlib.Client
 	for _, address := range cfg.SourceIPAddresses {
-		clients = append(clients, cmdlib.HTTPClientWithTimeoutAndAddress(cfg.TimeoutSeconds, address, cfg.EnableCookies))
+		client := cmdlib.HTTPClientWithTimeoutAndAddress(cfg.TimeoutSeconds, address, cfg.EnableCookies)
+		client.Headers = cfg.SourceIPHeaders[address]
+		clients = append(clients, client)
+	}
+	for _, proxy := range cfg.Proxies {
+		proxyURL, err := proxy.ProxyURL()
+		checkErr(err)
+		client := cmdlib.HTTPClientWithTimeoutAndProxy(cfg.TimeoutSeconds, proxyURL, cfg.EnableCookies)
+		client.Headers = proxy.Headers
+		clients = append(clients, client)
+	}
+	for _, client := range clients {
+		client.Limiter = cmdlib.NewRateLimiter(cfg.RequestsPerSecond, cfg.RequestsBurst)
+		if cfg.ResponseCache {
+			client.Cache = cmdlib.NewResponseCache()
+		}
+		client.SetHealthPolicy(cmdlib.ClientHealthPolicy{
+			FailuresToQuarantine: cfg.FailuresToQuarantine,
+			BaseQuarantine:       time.Duration(cfg.QuarantineSeconds) * time.Second,
+			MaxQuarantine:        time.Duration(cfg.MaxQuarantineSeconds) * time.Second,
+		})
+	}
+
+	var failureLog *cmdlib.FailureLog
+	if cfg.FailureLogDir != "" {
+		failureLog, err = cmdlib.NewFailureLog(cfg.FailureLogDir, cfg.FailureLogEntries, cfg.FailureLogBodyBytes)
+		checkErr(err)
 	}
 
 	telegramClient := cmdlib.HTTPClientWithTimeoutAndAddress(cfg.TelegramTimeoutSeconds, "", false)
@@ -170,8 +206,10 @@ func newWorker(args []string) *worker {
 	}
 	tr, tpl := cmdlib.LoadAllTranslations(trsByEndpoint(cfg))
 	trAds, tplAds := cmdlib.LoadAllAds(trsAdsByEndpoint(cfg))
+	link := affiliateLink(cfg)
 	for _, t := range tpl {
-		template.Must(t.New("affiliate_link").Parse(cfg.AffiliateLink))
+		t.Funcs(template.FuncMap{"affiliateLink": link})
+		template.Must(t.New("affiliate_link").Parse("{{ affiliateLink . }}"))
 	}
 	w := &worker{
 		bots:                   bots,
@@ -182,20 +220,27 @@ func newWorker(args []string) *worker {
 		tpl:                    tpl,
 		trAds:                  trAds,
 		tplAds:                 tplAds,
-		unsuccessfulRequests:   make([]bool, cfg.ErrorDenominator),
+		queryErrors:            make([]*queryError, cfg.ErrorDenominator),
 		downloadErrors:         make([]bool, cfg.ErrorDenominator),
-		downloadResults:        make(chan bool),
-		images:                 map[string]string{},
+		downloadResults:        make(chan downloadResult),
+		info:                   map[string]map[string]cmdlib.StreamInfo{},
+		coverage:               map[string]cmdlib.Coverage{},
+		httpQueriesDurations:   map[string]time.Duration{},
+		updates:                map[string]updatesStat{},
 		botNames:               map[string]string{},
 		lowPriorityMsg:         make(chan outgoingPacket, 10000),
 		highPriorityMsg:        make(chan outgoingPacket, 10000),
 		outgoingMsgResults:     make(chan msgSendResult),
 		unconfirmedSubsResults: make(chan cmdlib.StatusResults),
-		onlineModelsChan:       make(chan cmdlib.StatusUpdateResults),
+		renameCheckResults:     make(chan cmdlib.StatusResults),
+		onlineModelsChan:       make(chan siteStatusUpdateResults),
 		sendingNotifications:   make(chan []db.Notification, 1000),
 		sentNotifications:      make(chan []db.Notification),
 		ourIDs:                 getOurIDs(cfg),
 		specialModels:          map[string]bool{},
+		quarantineAlerts:       map[*cmdlib.Client]int64{},
+		failureLog:             failureLog,
+		metrics:                newBotMetrics(),
 	}
 	for endpoint, a := range tr {
 		for _, b := range a.ToMap() {
@@ -208,50 +253,7 @@ func newWorker(args []string) *worker {
 		}
 	}
 
-	switch cfg.Website {
-	case "test":
-		w.checker = &checkers.RandomChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "bongacams":
-		w.checker = &checkers.BongaCamsChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "chaturbate":
-		w.checker = &checkers.ChaturbateChecker{}
-		w.modelIDPreprocessing = checkers.ChaturbateCanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "stripchat":
-		w.checker = &checkers.StripchatChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "livejasmin":
-		w.checker = &checkers.LiveJasminChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "camsoda":
-		w.checker = &checkers.CamSodaChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "flirt4free":
-		w.checker = &checkers.Flirt4FreeChecker{}
-		w.modelIDPreprocessing = checkers.Flirt4FreeCanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "streamate":
-		w.checker = &checkers.StreamateChecker{}
-		w.modelIDPreprocessing = cmdlib.CanonicalModelID
-		w.modelIDRegexp = cmdlib.ModelIDRegexp
-	case "twitch":
-		w.checker = &checkers.TwitchChecker{}
-		w.modelIDPreprocessing = checkers.TwitchCanonicalModelID
-		w.modelIDRegexp = checkers.TwitchModelIDRegexp
-	case "cam4":
-		w.checker = &checkers.Cam4Checker{}
-		w.modelIDPreprocessing = checkers.Cam4CanonicalModelID
-		w.modelIDRegexp = checkers.Cam4ModelIDRegexp
-	default:
-		panic("wrong website")
-	}
+	w.sites = newSites(cfg)
 
 	return w
 }
@@ -572,20 +574,25 @@ func (w *worker) confirmationSeconds(status cmdlib.StatusKind) int {
 	}
 }
 
-func (w *worker) changedStatuses(newStatuses []cmdlib.StatusUpdate, now int) []db.StatusChange {
+// changedStatuses returns the changes of statuses
+// and separately the changes of sub-states of the models staying online
+func (w *worker) changedStatuses(newStatuses []cmdlib.StatusUpdate, now int) (result []db.StatusChange, subStateChanges []db.StatusChange) {
 	var modelIDs []string
 	for _, next := range newStatuses {
 		modelIDs = append(modelIDs, next.ModelID)
 	}
-	result := []db.StatusChange{}
+	result = []db.StatusChange{}
 	siteStatuses := w.db.QueryLastStatusChangesForModels(modelIDs)
 	for _, next := range newStatuses {
 		prev := siteStatuses[next.ModelID]
+		change := db.StatusChange{ModelID: next.ModelID, Status: next.Status, SubState: next.SubState, Timestamp: now}
 		if next.Status != prev.Status {
-			result = append(result, db.StatusChange{ModelID: next.ModelID, Status: next.Status, Timestamp: now})
+			result = append(result, change)
+		} else if next.Status == cmdlib.StatusOnline && next.SubState != cmdlib.SubStateUnknown && next.SubState != prev.SubState {
+			subStateChanges = append(subStateChanges, change)
 		}
 	}
-	return result
+	return
 }
 
 func (w *worker) updateCachedStatus(changedStatuses []db.StatusChange) {
@@ -612,7 +619,7 @@ func (w *worker) confirmStatusChanges(now int) []db.StatusChange {
 			} else {
 				delete(w.ourOnline, modelID)
 			}
-			result = append(result, db.StatusChange{ModelID: modelID, Status: statusChange.Status, Timestamp: now})
+			result = append(result, db.StatusChange{ModelID: modelID, Status: statusChange.Status, SubState: statusChange.SubState, Timestamp: now})
 		}
 	}
 	return result
@@ -631,13 +638,15 @@ func (w *worker) notifyOfAddResults(queue chan outgoingPacket, notifications []d
 
 func (w *worker) downloadImages(notifications []db.Notification) map[string][]byte {
 	images := map[string][]byte{}
+	sites := map[string]string{}
 	for _, n := range notifications {
 		if n.ImageURL != "" {
 			images[n.ImageURL] = nil
+			sites[n.ImageURL] = w.modelSite(n.ModelID)
 		}
 	}
 	for url := range images {
-		images[url] = w.downloadImage(url)
+		images[url] = w.downloadImage(sites[url], url)
 	}
 	return images
 }
@@ -683,10 +692,13 @@ func (w *worker) notifyOfStatus(queue chan outgoingPacket, n db.Notification, im
 		temp := calcTimeDiff(*n.TimeDiff)
 		timeDiff = &temp
 	}
-	data := tplData{"model": n.ModelID, "time_diff": timeDiff}
+	data := tplData{"model": n.ModelID, "time_diff": timeDiff, "title": n.Title, "viewers": n.Viewers}
 	switch n.Status {
 	case cmdlib.StatusOnline:
-		if image == nil {
+		if n.SubState != cmdlib.SubStateUnknown {
+			data["sub_state"] = n.SubState.String()
+			w.sendTr(queue, n.Endpoint, n.ChatID, n.Sound, w.tr[n.Endpoint].SubState, data, n.Kind)
+		} else if image == nil {
 			w.sendTr(queue, n.Endpoint, n.ChatID, true, w.tr[n.Endpoint].Online, data, n.Kind)
 		} else {
 			w.sendTrImage(queue, n.Endpoint, n.ChatID, true, w.tr[n.Endpoint].Online, data, image, n.Kind)
@@ -725,8 +737,8 @@ func (w *worker) showWeek(endpoint string, chatID int64, modelID string) {
 }
 
 func (w *worker) showWeekForModel(endpoint string, chatID int64, modelID string) {
-	modelID = w.modelIDPreprocessing(modelID)
-	if !w.modelIDRegexp.MatchString(modelID) {
+	modelID, valid := w.parseModelID(modelID)
+	if !valid {
 		w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].InvalidSymbols, tplData{"model": modelID}, db.ReplyPacket)
 		return
 	}
@@ -743,8 +755,8 @@ func (w *worker) addModel(endpoint string, chatID int64, modelID string, now int
 		w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].SyntaxAdd, nil, db.ReplyPacket)
 		return false
 	}
-	modelID = w.modelIDPreprocessing(modelID)
-	if !w.modelIDRegexp.MatchString(modelID) {
+	modelID, valid := w.parseModelID(modelID)
+	if !valid {
 		w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].InvalidSymbols, tplData{"model": modelID}, db.ReplyPacket)
 		return false
 	}
@@ -816,11 +828,13 @@ func (w *worker) settings(endpoint string, chatID int64) {
 	subscriptionsNumber := w.db.SubscriptionsNumber(endpoint, chatID)
 	user := w.mustUser(chatID)
 	w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].Settings, tplData{
-		"subscriptions_used":              subscriptionsNumber,
-		"total_subscriptions":             user.MaxModels,
-		"show_images":                     user.ShowImages,
-		"offline_notifications_supported": w.cfg.OfflineNotifications,
-		"offline_notifications":           user.OfflineNotifications,
+		"subscriptions_used":                subscriptionsNumber,
+		"total_subscriptions":               user.MaxModels,
+		"show_images":                       user.ShowImages,
+		"offline_notifications_supported":   w.cfg.OfflineNotifications,
+		"offline_notifications":             user.OfflineNotifications,
+		"sub_state_notifications_supported": w.cfg.SubStateNotifications,
+		"sub_state_notifications":           user.SubStateNotifications,
 	}, db.ReplyPacket)
 }
 
@@ -834,13 +848,18 @@ func (w *worker) enableOfflineNotifications(endpoint string, chatID int64, offli
 	w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].OK, nil, db.ReplyPacket)
 }
 
+func (w *worker) enableSubStateNotifications(endpoint string, chatID int64, subStateNotifications bool) {
+	w.db.MustExec("update users set sub_state_notifications = $1 where chat_id = $2", subStateNotifications, chatID)
+	w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].OK, nil, db.ReplyPacket)
+}
+
 func (w *worker) removeModel(endpoint string, chatID int64, modelID string) {
 	if modelID == "" {
 		w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].SyntaxRemove, nil, db.ReplyPacket)
 		return
 	}
-	modelID = w.modelIDPreprocessing(modelID)
-	if !w.modelIDRegexp.MatchString(modelID) {
+	modelID, valid := w.parseModelID(modelID)
+	if !valid {
 		w.sendTr(w.highPriorityMsg, endpoint, chatID, false, w.tr[endpoint].InvalidSymbols, tplData{"model": modelID}, db.ReplyPacket)
 		return
 	}
@@ -907,6 +926,9 @@ func (w *worker) listModels(endpoint string, chatID int64, now int) {
 	type data struct {
 		Model    string
 		TimeDiff *timeDiff
+		SubState string
+		Title    string
+		Viewers  int
 	}
 	statuses := w.db.StatusesForChat(endpoint, chatID)
 	sort.SliceStable(statuses, func(i, j int) bool {
@@ -920,6 +942,14 @@ func (w *worker) listModels(endpoint string, chatID int64, now int) {
 				Model:    s.ModelID,
 				TimeDiff: w.modelTimeDiff(s.ModelID, now),
 			}
+			if s.Status == cmdlib.StatusOnline {
+				if s.SubState != cmdlib.SubStateUnknown {
+					data.SubState = s.SubState.String()
+				}
+				info := w.streamInfo(s.ModelID)
+				data.Title = shortTitle(info.Title)
+				data.Viewers = info.Viewers
+			}
 			switch s.Status {
 			case cmdlib.StatusOnline:
 				online = append(online, data)
@@ -934,6 +964,15 @@ func (w *worker) listModels(endpoint string, chatID int64, now int) {
 	}
 }
 
+// shortTitle truncates a stream title to fit into the list of models
+func shortTitle(title string) string {
+	runes := []rune(strings.TrimSpace(title))
+	if len(runes) <= maxListTitleLength {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:maxListTitleLength-1])) + "…"
+}
+
 func (w *worker) modelDuration(modelID string, now int) *int {
 	begin, end, prevStatus := w.db.LastSeenInfo(modelID)
 	if end != 0 {
@@ -956,14 +995,16 @@ func (w *worker) modelTimeDiff(modelID string, now int) *timeDiff {
 	return nil
 }
 
-func (w *worker) downloadSuccess(success bool) { w.downloadResults <- success }
+func (w *worker) downloadSuccess(site string, success bool) {
+	w.downloadResults <- downloadResult{site: site, success: success}
+}
 
-func (w *worker) downloadImage(url string) []byte {
+func (w *worker) downloadImage(site string, url string) []byte {
 	imageBytes, err := w.downloadImageInternal(url)
 	if err != nil {
 		lerr("cannot download image, %v", err)
 	}
-	w.downloadSuccess(err == nil)
+	w.downloadSuccess(site, err == nil)
 	return imageBytes
 }
 
@@ -1008,13 +1049,16 @@ func (w *worker) listOnlineModels(endpoint string, chatID int64, now int) {
 	}
 	var nots []db.Notification
 	for _, s := range online {
+		info := w.streamInfo(s.ModelID)
 		not := db.Notification{
 			Priority: 1,
 			Endpoint: endpoint,
 			ChatID:   chatID,
 			ModelID:  s.ModelID,
 			Status:   cmdlib.StatusOnline,
-			ImageURL: w.images[s.ModelID],
+			ImageURL: info.ImageURL,
+			Title:    info.Title,
+			Viewers:  info.Viewers,
 			TimeDiff: w.modelDuration(s.ModelID, now),
 			Kind:     db.ReplyPacket,
 		}
@@ -1062,14 +1106,41 @@ func (w *worker) feedback(endpoint string, chatID int64, text string, now int) {
 
 func (w *worker) unsuccessfulRequestsCount() int {
 	var count = 0
-	for _, s := range w.unsuccessfulRequests {
-		if s {
+	for _, e := range w.queryErrors {
+		if e != nil {
 			count++
 		}
 	}
 	return count
 }
 
+// queryErrorsByKind counts the failures in the error rate window by their kinds and by their endpoints
+func (w *worker) queryErrorsByKind() (byKind map[string]int, byEndpoint map[string]map[string]int) {
+	byKind = map[string]int{}
+	byEndpoint = map[string]map[string]int{}
+	for _, e := range w.queryErrors {
+		if e == nil {
+			continue
+		}
+		byKind[e.kind]++
+		if byEndpoint[e.endpoint] == nil {
+			byEndpoint[e.endpoint] = map[string]int{}
+		}
+		byEndpoint[e.endpoint][e.kind]++
+	}
+	return
+}
+
+// dominantErrorKind returns the most frequent kind of failures
+func dominantErrorKind(byKind map[string]int) (kind string, count int) {
+	for k, c := range byKind {
+		if c > count || (c == count && k < kind) {
+			kind, count = k, c
+		}
+	}
+	return
+}
+
 func (w *worker) downloadErrorsCount() int {
 	var count = 0
 	for _, s := range w.downloadErrors {
@@ -1080,9 +1151,26 @@ func (w *worker) downloadErrorsCount() int {
 	return count
 }
 
+// formatCounts formats the counts sorted by their keys
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s %d", k, counts[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func (w *worker) statStrings(endpoint string) []string {
 	stat := w.getStat(endpoint)
-	return []string{
+	result := []string{
 		fmt.Sprintf("Users: %d", stat.UsersCount),
 		fmt.Sprintf("Groups: %d", stat.GroupsCount),
 		fmt.Sprintf("Active users: %d", stat.ActiveUsersOnEndpointCount),
@@ -1095,6 +1183,8 @@ func (w *worker) statStrings(endpoint string) []string {
 		fmt.Sprintf("Queries duration: %d ms", stat.QueriesDurationMilliseconds),
 		fmt.Sprintf("Updates duration: %d ms", stat.UpdatesDurationMilliseconds),
 		fmt.Sprintf("Error rate: %d/%d", stat.ErrorRate[0], stat.ErrorRate[1]),
+		fmt.Sprintf("Errors by kind: %s", formatCounts(stat.ErrorsByKind)),
+		fmt.Sprintf("Response cache hit rate: %d/%d", stat.ResponseCacheHitRate[0], stat.ResponseCacheHitRate[1]),
 		fmt.Sprintf("Memory usage: %d KiB", stat.Rss),
 		fmt.Sprintf("Reports: %d", stat.ReportsCount),
 		fmt.Sprintf("User referrals: %d", stat.UserReferralsCount),
@@ -1102,6 +1192,27 @@ func (w *worker) statStrings(endpoint string) []string {
 		fmt.Sprintf("Changes in period: %d", stat.ChangesInPeriod),
 		fmt.Sprintf("Confirmed changes in period: %d", stat.ConfirmedChangesInPeriod),
 	}
+	var sites []string
+	for name := range stat.QueriesDurationsBySite {
+		sites = append(sites, name)
+	}
+	sort.Strings(sites)
+	for _, name := range sites {
+		result = append(result, fmt.Sprintf("Queries duration %s: %d ms", name, stat.QueriesDurationsBySite[name]))
+	}
+	sites = nil
+	for name := range stat.Coverage {
+		sites = append(sites, name)
+	}
+	sort.Strings(sites)
+	for _, name := range sites {
+		if name == "" {
+			result = append(result, fmt.Sprintf("Coverage: %v", stat.Coverage[name]))
+		} else {
+			result = append(result, fmt.Sprintf("Coverage %s: %v", name, stat.Coverage[name]))
+		}
+	}
+	return result
 }
 
 func (w *worker) stat(endpoint string) {
@@ -1109,6 +1220,51 @@ func (w *worker) stat(endpoint string) {
 	w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, true, true, cmdlib.ParseRaw, text, db.ReplyPacket)
 }
 
+// failures sends the recent failing responses optionally filtered by the checker and the kind of failure
+func (w *worker) failures(endpoint string, arguments string) {
+	if w.failureLog == nil {
+		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "failure log is disabled", db.ReplyPacket)
+		return
+	}
+	parts := strings.Fields(arguments)
+	if len(parts) > 2 {
+		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "wrong number of arguments", db.ReplyPacket)
+		return
+	}
+	parts = append(parts, "", "")
+	entries, err := w.failureLog.Entries(parts[0], parts[1])
+	if err != nil {
+		lerr("cannot read failure log, %v", err)
+		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "cannot read failure log", db.ReplyPacket)
+		return
+	}
+	if len(entries) == 0 {
+		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "no failures", db.ReplyPacket)
+		return
+	}
+	if len(entries) > 5 {
+		entries = entries[:5]
+	}
+	for _, e := range entries {
+		body := []rune(e.Body)
+		if len(body) > 1000 {
+			body = body[:1000]
+		}
+		lines := []string{
+			fmt.Sprintf("<b>Time</b>: %s", time.Unix(e.Time, 0).UTC().Format(time.RFC3339)),
+			fmt.Sprintf("<b>Checker</b>: %s", html.EscapeString(e.Checker)),
+			fmt.Sprintf("<b>Kind</b>: %s", html.EscapeString(e.Kind)),
+			fmt.Sprintf("<b>Error</b>: %s", html.EscapeString(e.Error)),
+			fmt.Sprintf("<b>URL</b>: %s", html.EscapeString(e.URL)),
+			fmt.Sprintf("<b>Status</b>: %d", e.Status),
+			fmt.Sprintf("<b>Content type</b>: %s", html.EscapeString(e.Headers.Get("Content-Type"))),
+			fmt.Sprintf("<pre>%s</pre>", html.EscapeString(string(body))),
+		}
+		entry := strings.Join(lines, "\n")
+		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseHTML, entry, db.ReplyPacket)
+	}
+}
+
 func (w *worker) performanceStat(endpoint string, arguments string) {
 	parts := strings.Split(arguments, " ")
 	if len(parts) > 2 {
@@ -1203,8 +1359,8 @@ func (w *worker) addSpecialModel(endpoint string, arguments string) {
 		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "usage: /special set/unset MODEL_ID", db.ReplyPacket)
 		return
 	}
-	modelID := w.modelIDPreprocessing(parts[1])
-	if !w.modelIDRegexp.MatchString(modelID) {
+	modelID, valid := w.parseModelID(parts[1])
+	if !valid {
 		w.sendText(w.highPriorityMsg, endpoint, w.cfg.AdminID, false, true, cmdlib.ParseRaw, "MODEL_ID is invalid", db.ReplyPacket)
 		return
 	}
@@ -1248,6 +1404,9 @@ func (w *worker) processAdminMessage(endpoint string, chatID int64, command, arg
 	case "performance":
 		w.performanceStat(endpoint, arguments)
 		return true, false
+	case "failures":
+		w.failures(endpoint, arguments)
+		return true, false
 	case "broadcast":
 		w.broadcast(endpoint, arguments)
 		return true, false
@@ -1349,8 +1508,7 @@ func (w *worker) start(endpoint string, chatID int64, referrer string, now int)
 	modelID := ""
 	switch {
 	case strings.HasPrefix(referrer, "m-"):
-		modelID = referrer[2:]
-		modelID = w.modelIDPreprocessing(modelID)
+		modelID, _ = w.parseModelID(referrer[2:])
 		referrer = ""
 	case referrer != "":
 		referralID := w.db.ReferralID(chatID)
@@ -1455,6 +1613,10 @@ func (w *worker) processIncomingCommand(endpoint string, chatID int64, command,
 		w.enableOfflineNotifications(endpoint, chatID, true)
 	case "disable_offline_notifications":
 		w.enableOfflineNotifications(endpoint, chatID, false)
+	case "enable_show_notifications":
+		w.enableSubStateNotifications(endpoint, chatID, true)
+	case "disable_show_notifications":
+		w.enableSubStateNotifications(endpoint, chatID, false)
 	case "referral":
 		w.showReferral(endpoint, chatID)
 	case "week":
@@ -1469,11 +1631,13 @@ func (w *worker) processIncomingCommand(endpoint string, chatID int64, command,
 	return false
 }
 
-func (w *worker) periodic() {
+func (w *worker) periodic(s *site) {
 	unsuccessfulRequestsCount := w.unsuccessfulRequestsCount()
 	now := time.Now()
 	if w.nextErrorReport.Before(now) && unsuccessfulRequestsCount > w.cfg.ErrorThreshold {
-		text := fmt.Sprintf("Dangerous error rate reached: %d/%d", unsuccessfulRequestsCount, w.cfg.ErrorDenominator)
+		byKind, _ := w.queryErrorsByKind()
+		kind, count := dominantErrorKind(byKind)
+		text := fmt.Sprintf("Dangerous error rate reached: %d/%d, mostly %s: %d", unsuccessfulRequestsCount, w.cfg.ErrorDenominator, kind, count)
 		w.sendText(
 			w.highPriorityMsg,
 			w.cfg.AdminEndpoint,
@@ -1485,24 +1649,81 @@ func (w *worker) periodic() {
 			db.MessagePacket)
 		w.nextErrorReport = now.Add(time.Minute * time.Duration(w.cfg.ErrorReportingPeriodMinutes))
 	}
-	w.pushOnlineRequest()
+	w.reportQuarantinedClients()
+	w.pushOnlineRequest(s)
+}
+
+func (w *worker) reportMassOffline(s *site, drop *cmdlib.MassOfflineDrop) {
+	now := time.Now()
+	if s.nextMassOfflineReport.After(now) {
+		return
+	}
+	s.nextMassOfflineReport = now.Add(time.Minute * time.Duration(w.cfg.ErrorReportingPeriodMinutes))
+	text := fmt.Sprintf(
+		"Mass offline guard tripped for %s: %d of %d models would go offline, the previous snapshot is kept",
+		s.website,
+		drop.Offline,
+		drop.Previous)
+	w.sendText(w.highPriorityMsg, w.cfg.AdminEndpoint, w.cfg.AdminID, true, true, cmdlib.ParseRaw, text, db.MessagePacket)
+}
+
+func (w *worker) reportQuarantinedClients() {
+	for _, c := range w.clients {
+		stat := c.HealthStat()
+		if !c.Quarantined() || w.quarantineAlerts[c] == stat.QuarantinedSince {
+			continue
+		}
+		w.quarantineAlerts[c] = stat.QuarantinedSince
+		text := fmt.Sprintf(
+			"Source address %s is quarantined until %s after repeated failures",
+			stat.Address,
+			time.Unix(stat.QuarantinedUntil, 0).UTC().Format(time.RFC3339))
+		w.sendText(w.highPriorityMsg, w.cfg.AdminEndpoint, w.cfg.AdminID, true, true, cmdlib.ParseRaw, text, db.MessagePacket)
+	}
+}
+
+func (w *worker) clientsHealth() []cmdlib.ClientHealthStat {
+	var result []cmdlib.ClientHealthStat
+	for _, c := range w.clients {
+		result = append(result, c.HealthStat())
+	}
+	return result
+}
+
+// responseCacheHitRate returns the number of not modified online lists and the number of all cacheable ones
+func (w *worker) responseCacheHitRate() [2]int {
+	var result [2]int
+	for _, c := range w.clients {
+		if c.Cache != nil {
+			hits, total := c.Cache.HitRate()
+			result[0] += hits
+			result[1] += total
+		}
+	}
+	return result
+}
+
+func (w *worker) onlineModelsCallback(s *site) func(cmdlib.StatusUpdateResults) {
+	return func(res cmdlib.StatusUpdateResults) {
+		w.onlineModelsChan <- siteStatusUpdateResults{site: s.name, results: namespaceStatusUpdateResults(s.name, res)}
+	}
 }
 
-func (w *worker) pushOnlineRequest() {
-	err := w.checker.Updater().PushUpdateRequest(cmdlib.StatusUpdateRequest{
-		Callback:      func(res cmdlib.StatusUpdateResults) { w.onlineModelsChan <- res },
-		SpecialModels: w.specialModels,
-		Subscriptions: w.db.QueryLastSubscriptionStatuses(),
+func (w *worker) pushOnlineRequest(s *site) {
+	err := s.checker.Updater().PushUpdateRequest(cmdlib.StatusUpdateRequest{
+		Callback:      w.onlineModelsCallback(s),
+		SpecialModels: forSite(w.specialModels, s.name),
+		Subscriptions: forSite(w.db.QueryLastSubscriptionStatuses(), s.name),
 	})
 	if err != nil {
 		lerr("%v", err)
 	}
 }
 
-func (w *worker) pushSpecificRequest(resultsCh chan cmdlib.StatusResults, specific map[string]bool) error {
-	err := w.checker.PushStatusRequest(cmdlib.StatusRequest{
-		Callback:  func(res cmdlib.StatusResults) { resultsCh <- res },
-		Specific:  specific,
+func (w *worker) pushSpecificRequest(s *site, resultsCh chan cmdlib.StatusResults, specific map[string]bool) error {
+	err := s.checker.PushStatusRequest(cmdlib.StatusRequest{
+		Callback:  func(res cmdlib.StatusResults) { resultsCh <- namespaceStatusResults(s.name, res) },
+		Specific:  forSite(specific, s.name),
 		CheckMode: cmdlib.CheckStatuses})
 	if err != nil {
 		lerr("%v", err)
@@ -1521,11 +1742,27 @@ func (w *worker) processStatusUpdates(updates []cmdlib.StatusUpdate, now int) (
 
 	changesCount = len(updates)
 
-	changedStatuses := w.changedStatuses(updates, now)
+	changedStatuses, subStateChanges := w.changedStatuses(updates, now)
+	for _, c := range changedStatuses {
+		w.metrics.countStatusChange(w.modelSite(c.ModelID), false)
+	}
 	w.db.InsertStatusChanges(changedStatuses)
+	w.db.UpdateLatestSubStates(subStateChanges)
 	w.updateCachedStatus(changedStatuses)
 
+	// Sub-state changes are reported only for the models we have already notified of going online
+	var confirmedSubStateChanges []db.StatusChange
+	for _, c := range subStateChanges {
+		if w.ourOnline[c.ModelID] {
+			confirmedSubStateChanges = append(confirmedSubStateChanges, c)
+		}
+	}
+	w.db.InsertConfirmedStatusChanges(confirmedSubStateChanges)
+
 	confirmedStatusChanges := w.confirmStatusChanges(now)
+	for _, c := range confirmedStatusChanges {
+		w.metrics.countStatusChange(w.modelSite(c.ModelID), true)
+	}
 	w.db.InsertConfirmedStatusChanges(confirmedStatusChanges)
 
 	if w.cfg.Debug {
@@ -1537,6 +1774,7 @@ func (w *worker) processStatusUpdates(updates []cmdlib.StatusUpdate, now int) (
 		endpoints := endpointsForModels[c.ModelID]
 		for i, user := range users {
 			if (w.cfg.OfflineNotifications && user.OfflineNotifications) || c.Status != cmdlib.StatusOffline {
+				info := w.streamInfo(c.ModelID)
 				n := db.Notification{
 					Endpoint: endpoints[i],
 					ChatID:   user.ChatID,
@@ -1545,14 +1783,37 @@ func (w *worker) processStatusUpdates(updates []cmdlib.StatusUpdate, now int) (
 					Social:   user.ChatID > 0,
 					Sound:    c.Status == cmdlib.StatusOnline,
 					Kind:     db.NotificationPacket}
+				if c.Status == cmdlib.StatusOnline {
+					n.Title = info.Title
+					n.Viewers = info.Viewers
+				}
 				if user.ShowImages {
-					n.ImageURL = w.images[c.ModelID]
+					n.ImageURL = info.ImageURL
 				}
 				notifications = append(notifications, n)
 			}
 		}
 	}
 
+	if w.cfg.SubStateNotifications {
+		for _, c := range confirmedSubStateChanges {
+			users := usersForModels[c.ModelID]
+			endpoints := endpointsForModels[c.ModelID]
+			for i, user := range users {
+				if user.SubStateNotifications {
+					notifications = append(notifications, db.Notification{
+						Endpoint: endpoints[i],
+						ChatID:   user.ChatID,
+						ModelID:  c.ModelID,
+						Status:   c.Status,
+						SubState: c.SubState,
+						Sound:    c.SubState == cmdlib.SubStatePublic,
+						Kind:     db.NotificationPacket})
+				}
+			}
+		}
+	}
+
 	confirmedChangesCount = len(confirmedStatusChanges)
 
 	elapsed = time.Since(start)
@@ -1636,12 +1897,41 @@ func getRss() (int64, error) {
 	return rss * int64(os.Getpagesize()), err
 }
 
+// queriesDurations returns the total duration of the last online list polls of the sites
+// and the durations by the sites for several websites
+func (w *worker) queriesDurations() (total time.Duration, bySite map[string]int) {
+	if _, single := w.sites[""]; !single {
+		bySite = map[string]int{}
+	}
+	for site, elapsed := range w.httpQueriesDurations {
+		total += elapsed
+		if bySite != nil {
+			bySite[site] = int(elapsed.Milliseconds())
+		}
+	}
+	return
+}
+
+// updatesTotal sums the last status updates of the sites
+func (w *worker) updatesTotal() updatesStat {
+	var result updatesStat
+	for _, x := range w.updates {
+		result.duration += x.duration
+		result.changes += x.changes
+		result.confirmedChanges += x.confirmedChanges
+	}
+	return result
+}
+
 func (w *worker) getStat(endpoint string) statistics {
 	measureDone := w.db.Measure("db: retrieving stats")
 	defer measureDone()
+	queriesDuration, queriesDurations := w.queriesDurations()
+	updates := w.updatesTotal()
 	rss, _ := getRss()
 	var rusage syscall.Rusage
 	checkErr(syscall.Getrusage(syscall.RUSAGE_SELF, &rusage))
+	errorsByKind, errorsByEndpoint := w.queryErrorsByKind()
 
 	return statistics{
 		UsersCount:                   w.db.UsersCount(endpoint),
@@ -1656,20 +1946,26 @@ func (w *worker) getStat(endpoint string) statistics {
 		KnownModelsCount:             w.db.MustInt("select count(*) from models"),
 		SpecialModelsCount:           len(w.specialModels),
 		StatusChangesCount:           w.db.StatusChangesCount(),
-		QueriesDurationMilliseconds:  int(w.httpQueriesDuration.Milliseconds()),
-		UpdatesDurationMilliseconds:  int(w.updatesDuration.Milliseconds()),
+		QueriesDurationMilliseconds:  int(queriesDuration.Milliseconds()),
+		QueriesDurationsBySite:       queriesDurations,
+		UpdatesDurationMilliseconds:  int(updates.duration.Milliseconds()),
 		CleaningDurationMilliseconds: int(w.cleaningDuration.Milliseconds()),
 		ErrorRate:                    [2]int{w.unsuccessfulRequestsCount(), w.cfg.ErrorDenominator},
 		DownloadErrorRate:            [2]int{w.downloadErrorsCount(), w.cfg.ErrorDenominator},
+		ErrorsByKind:                 errorsByKind,
+		ErrorsByEndpoint:             errorsByEndpoint,
 		Rss:                          rss / 1024,
 		MaxRss:                       rusage.Maxrss,
 		UserReferralsCount:           w.db.UserReferralsCount(),
 		ModelReferralsCount:          w.db.ModelReferralsCount(),
 		ReportsCount:                 w.db.Reports(),
-		ChangesInPeriod:              w.changesInPeriod,
-		ConfirmedChangesInPeriod:     w.confirmedChangesInPeriod,
+		ChangesInPeriod:              updates.changes,
+		ConfirmedChangesInPeriod:     updates.confirmedChanges,
 		Interactions:                 w.db.InteractionsByResultToday(endpoint),
 		InteractionsByKind:           w.db.InteractionsByKindToday(endpoint),
+		ClientsHealth:                w.clientsHealth(),
+		ResponseCacheHitRate:         w.responseCacheHitRate(),
+		Coverage:                     w.coverage,
 	}
 }
 
@@ -1712,6 +2008,48 @@ func (w *worker) handleStatEndpoints(statRequests chan statRequest) {
 		if p.StatPath != "" {
 			http.HandleFunc(p.WebhookDomain+p.StatPath, w.handleStat(n, statRequests))
 		}
+		if p.FailuresPath != "" && w.failureLog != nil {
+			http.HandleFunc(p.WebhookDomain+p.FailuresPath, w.handleFailures)
+		}
+	}
+}
+
+// handleFailures serves the failing responses filtered by the checker and kind query parameters,
+// the failure log is safe for concurrent use so the request is not passed to the main loop
+func (w *worker) handleFailures(writer http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("password") != w.cfg.StatPassword {
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	entries, err := w.failureLog.Entries(query.Get("checker"), query.Get("kind"))
+	if err != nil {
+		lerr("cannot read failure log, %v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []cmdlib.FailureEntry{}
+	}
+	failuresJSON, err := json.MarshalIndent(entries, "", "    ")
+	checkErr(err)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, err = writer.Write(failuresJSON)
+	if err != nil {
+		lerr("error on processing failures request, %v", err)
+	}
+}
+
+// handleCheckerWebhook serves the webhook of a checker receiving status changes from its site
+func (w *worker) handleCheckerWebhook(s *site) {
+	c, ok := s.checker.(cmdlib.WebhookChecker)
+	if !ok {
+		return
+	}
+	if pattern, handler := c.Webhook(); pattern != "" {
+		linf("listening for a webhook for site %s at %s", s.website, pattern)
+		http.Handle(pattern, handler)
 	}
 }
 
@@ -1743,18 +2081,38 @@ func getOurIDs(c *botconfig.Config) []int64 {
 	return ids
 }
 
-func (w *worker) logQueryErrors(errors int) {
-	for i := 0; i < errors; i++ {
-		w.logSingleQueryResult(false)
+// queryError is a failure kept in the error rate window
+type queryError struct {
+	kind     string
+	endpoint string
+}
+
+// endpointLabel returns the host and the path of an endpoint
+// leaving out the query possibly containing credentials,
+// the site name is used if there is no endpoint
+func endpointLabel(site string, endpoint string) string {
+	if endpoint == "" {
+		return site
 	}
-	if errors == 0 {
-		w.logSingleQueryResult(true)
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return site
 	}
+	return u.Host + u.Path
 }
 
-func (w *worker) logSingleQueryResult(success bool) {
-	w.unsuccessfulRequests[w.unsuccessfulRequestsPos] = !success
-	w.unsuccessfulRequestsPos = (w.unsuccessfulRequestsPos + 1) % w.cfg.ErrorDenominator
+func (w *worker) logQueryErrors(site string, errs []*cmdlib.CheckerError) {
+	for _, e := range errs {
+		w.logSingleQueryResult(&queryError{kind: e.Name(), endpoint: endpointLabel(site, e.Endpoint)})
+	}
+	if len(errs) == 0 {
+		w.logSingleQueryResult(nil)
+	}
+}
+
+func (w *worker) logSingleQueryResult(err *queryError) {
+	w.queryErrors[w.queryErrorsPos] = err
+	w.queryErrorsPos = (w.queryErrorsPos + 1) % w.cfg.ErrorDenominator
 }
 
 func (w *worker) cleanStatusChanges(now int64) time.Duration {
@@ -1831,9 +2189,77 @@ func (w *worker) queryUnconfirmedSubs() {
 	if len(unconfirmed) > 0 {
 		w.db.MustExec("update signals set confirmed = 2 where confirmed = 0")
 		ldbg("queueing unconfirmed subscriptions check for %d channels", len(unconfirmed))
-		if w.pushSpecificRequest(w.unconfirmedSubsResults, unconfirmed) != nil {
-			w.db.MustExec("update signals set confirmed = 0 where confirmed = 2")
+		for _, s := range w.sites {
+			specific := forSite(unconfirmed, s.name)
+			if len(specific) == 0 {
+				continue
+			}
+			if w.pushSpecificRequest(s, w.unconfirmedSubsResults, specific) != nil {
+				w.db.MustExec(
+					"update signals set confirmed = 0 where confirmed = 2 and model_id = any($1)",
+					namespacedModelIDs(s.name, specific))
+			}
+		}
+	}
+}
+
+// queryRenames checks the subscribed models of the sites with stable user IDs for renames
+func (w *worker) queryRenames() {
+	subscribed := map[string]bool{}
+	for _, m := range w.db.MustStrings("select distinct model_id from signals where confirmed = 1") {
+		subscribed[m] = true
+	}
+	for _, s := range w.sites {
+		if _, ok := s.checker.(cmdlib.IdentityChecker); !ok {
+			continue
 		}
+		specific := forSite(subscribed, s.name)
+		if len(specific) == 0 {
+			continue
+		}
+		if w.cfg.Debug {
+			ldbg("queueing rename check for %d models of %s", len(specific), s.website)
+		}
+		_ = w.pushSpecificRequest(s, w.renameCheckResults, specific)
+	}
+}
+
+func (w *worker) processRenameCheck(res cmdlib.StatusResults) {
+	if res.Data == nil {
+		lerr("rename check failed")
+		return
+	}
+	for modelID, newModelID := range res.Data.Renames {
+		w.renameModel(modelID, newModelID)
+	}
+	w.db.StoreUserIDs(res.Data.UserIDs)
+}
+
+// renameModel moves the subscriptions and the history of a renamed model to its new ID
+// and tells the subscribers about the new name
+func (w *worker) renameModel(modelID string, newModelID string) {
+	linf("model %s is renamed to %s", modelID, newModelID)
+	subs := w.db.RenameModel(modelID, newModelID)
+	if w.siteOnline[modelID] {
+		w.siteOnline[newModelID] = true
+		delete(w.siteOnline, modelID)
+	}
+	if w.ourOnline[modelID] {
+		w.ourOnline[newModelID] = true
+		delete(w.ourOnline, modelID)
+	}
+	if w.specialModels[modelID] {
+		w.specialModels[newModelID] = true
+		delete(w.specialModels, modelID)
+	}
+	site, _ := splitSiteModelID(modelID)
+	if info, ok := w.info[site][modelID]; ok {
+		w.info[site][newModelID] = info
+		delete(w.info[site], modelID)
+	}
+	for _, sub := range subs {
+		data := tplData{"model": modelID, "new_model": newModelID}
+		w.sendTr(w.lowPriorityMsg, sub.Endpoint, sub.ChatID, true, w.tr[sub.Endpoint].ModelRenamed, data, db.MessagePacket)
 	}
 }
 
@@ -1852,10 +2278,18 @@ func (w *worker) processSubsConfirmations(res cmdlib.StatusResults) {
 		func() { confirmationsInWork[iter.ModelID] = append(confirmationsInWork[iter.ModelID], iter) })
 	var nots []db.Notification
 	if res.Data != nil {
+		for modelID, newModelID := range res.Data.Renames {
+			for _, sub := range confirmationsInWork[modelID] {
+				sub.ModelID = newModelID
+				confirmationsInWork[newModelID] = append(confirmationsInWork[newModelID], sub)
+			}
+			delete(confirmationsInWork, modelID)
+			w.renameModel(modelID, newModelID)
+		}
 		for modelID, status := range res.Data.Statuses {
 			for _, sub := range confirmationsInWork[modelID] {
 				if status&(cmdlib.StatusOnline|cmdlib.StatusOffline|cmdlib.StatusDenied) != 0 {
-					w.db.ConfirmSub(sub)
+					w.db.ConfirmSub(sub, res.Data.UserIDs[modelID])
 				} else {
 					w.db.DenySub(sub)
 				}
@@ -1966,56 +2400,98 @@ func main() {
 
 	statRequests := make(chan statRequest)
 	w.handleStatEndpoints(statRequests)
+	metricsRequests := make(chan statRequest)
+	w.handleMetricsEndpoint(metricsRequests)
 
-	var requestTimer = time.NewTicker(time.Duration(w.cfg.PeriodSeconds) * time.Second)
+	requestTimer := w.startPollTimers()
 	var cleaningTimerChannel <-chan time.Time
 	if w.cfg.CleaningPeriodSeconds != 0 {
 		cleaningTimerChannel = time.NewTicker(time.Duration(w.cfg.CleaningPeriodSeconds) * time.Second).C
 	}
 	var subsConfirmTimer = time.NewTicker(time.Duration(w.cfg.SubsConfirmationPeriodSeconds) * time.Second)
 	var notificationSenderTimer = time.NewTicker(time.Duration(w.cfg.NotificationsReadyPeriodSeconds) * time.Second)
-	w.checker.Init(w.checker, cmdlib.CheckerConfig{
-		UsersOnlineEndpoints: w.cfg.UsersOnlineEndpoint,
-		Clients:              w.clients,
-		Headers:              w.cfg.Headers,
-		Dbg:                  w.cfg.Debug,
-		SpecificConfig:       w.cfg.SpecificConfig,
-		QueueSize:            5,
-		SiteOnlineModels:     w.siteOnline,
-		Subscriptions:        w.db.QueryLastSubscriptionStatuses(),
-		IntervalMs:           w.cfg.IntervalMs,
-	})
-	w.checker.Start()
+	var renameCheckTimerChannel <-chan time.Time
+	if w.cfg.RenameCheckPeriodSeconds != 0 {
+		renameCheckTimerChannel = time.NewTicker(time.Duration(w.cfg.RenameCheckPeriodSeconds) * time.Second).C
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscriptionStatuses := w.db.QueryLastSubscriptionStatuses()
+	subStates := w.db.QueryLastSubStates()
+	userIDs := w.db.QueryUserIDs()
+	for _, s := range w.sites {
+		s.checker.Init(s.checker, cmdlib.CheckerConfig{
+			UsersOnlineEndpoints:      s.usersOnlineEndpoints,
+			Clients:                   w.clients,
+			Headers:                   w.cfg.Headers,
+			Dbg:                       w.cfg.Debug,
+			SpecificConfig:            s.specificConfig,
+			QueueSize:                 5,
+			SiteOnlineModels:          forSite(w.siteOnline, s.name),
+			SiteSubStates:             forSite(subStates, s.name),
+			Subscriptions:             forSite(subscriptionStatuses, s.name),
+			PollTimeoutSeconds:        s.pollTimeoutSeconds,
+			EndpointRetries:           w.cfg.EndpointRetries,
+			EndpointRetryDelayMs:      w.cfg.EndpointRetryDelayMs,
+			MassOfflineGuard:          w.cfg.OfflineGuard,
+			MinCoveragePercent:        w.cfg.MinCoveragePercent,
+			MaxResponseBytes:          w.cfg.MaxResponseBytes,
+			UserIDs:                   forSite(userIDs, s.name),
+			EventsCallback:            w.onlineModelsCallback(s),
+			Name:                      w.checkerLabel(s.name),
+			FailureLog:                w.failureLog,
+			SingleCheckTimeoutSeconds: w.cfg.SingleCheckTimeoutSeconds,
+		})
+		s.checker.Start(ctx)
+		w.handleCheckerWebhook(s)
+	}
 	signals := make(chan os.Signal, 16)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT, syscall.SIGTSTP, syscall.SIGCONT)
 	w.sendText(w.highPriorityMsg, w.cfg.AdminEndpoint, w.cfg.AdminID, true, true, cmdlib.ParseRaw, "bot is up", db.MessagePacket)
-	w.pushOnlineRequest()
+	for _, s := range w.sites {
+		w.pushOnlineRequest(s)
+	}
 	for {
 		select {
-		case <-requestTimer.C:
+		case name := <-requestTimer:
 			runtime.GC()
-			w.periodic()
+			w.periodic(w.sites[name])
 		case <-cleaningTimerChannel:
 			w.cleaningDuration = w.cleanStatusChanges(time.Now().Unix())
 		case <-subsConfirmTimer.C:
 			w.queryUnconfirmedSubs()
 		case <-notificationSenderTimer.C:
 			w.sendReadyNotifications()
-		case onlineModels := <-w.onlineModelsChan:
+		case <-renameCheckTimerChannel:
+			w.queryRenames()
+		case siteResults := <-w.onlineModelsChan:
+			onlineModels := siteResults.results
 			if onlineModels.Data != nil {
-				w.httpQueriesDuration = onlineModels.Data.Elapsed
+				if onlineModels.Data.Elapsed != 0 {
+					// the updates pushed by a site are not timed
+					w.httpQueriesDurations[siteResults.site] = onlineModels.Data.Elapsed
+					w.observePolls(siteResults.site, onlineModels.Data)
+				}
 				now := int(time.Now().Unix())
-				w.images = onlineModels.Data.Images
+				w.info[siteResults.site] = onlineModels.Data.Info
+				if onlineModels.Data.Coverage != nil {
+					w.coverage[siteResults.site] = *onlineModels.Data.Coverage
+				}
 				changesInPeriod, confirmedChangesInPeriod, notifications, elapsed := w.processStatusUpdates(onlineModels.Data.Updates, now)
-				w.updatesDuration = elapsed
-				w.changesInPeriod = changesInPeriod
-				w.confirmedChangesInPeriod = confirmedChangesInPeriod
+				w.updates[siteResults.site] = updatesStat{
+					duration:         elapsed,
+					changes:          changesInPeriod,
+					confirmedChanges: confirmedChangesInPeriod,
+				}
 				w.db.StoreNotifications(notifications)
 				if w.cfg.Debug {
 					ldbg("status updates processed in %v", elapsed)
 				}
 			}
-			w.logQueryErrors(onlineModels.Errors)
+			w.logQueryErrors(siteResults.site, onlineModels.Errors)
+			if onlineModels.MassOffline != nil {
+				w.reportMassOffline(w.sites[siteResults.site], onlineModels.MassOffline)
+			}
 		case u := <-incoming:
 			if w.processTGUpdate(u) {
 				if !w.maintenance(signals, incoming) {
@@ -2024,6 +2500,8 @@ func main() {
 			}
 		case s := <-statRequests:
 			w.processStatCommand(s.endpoint, s.writer, s.request, s.done)
+		case s := <-metricsRequests:
+			w.processMetricsRequest(s.writer, s.request, s.done)
 		case s := <-signals:
 			linf("got signal %v", s)
 			if s == syscall.SIGINT || s == syscall.SIGTERM || s == syscall.SIGABRT {
@@ -2036,6 +2514,7 @@ func main() {
 				}
 			}
 		case r := <-w.outgoingMsgResults:
+			w.metrics.countSendResult(r)
 			switch r.result {
 			case messageBlocked:
 				w.db.IncrementBlock(r.endpoint, r.chatID)
@@ -2046,13 +2525,16 @@ func main() {
 			w.db.MustExec(query, r.timestamp, r.chatID, r.result, r.endpoint, r.priority, r.delay, r.kind)
 		case r := <-w.unconfirmedSubsResults:
 			w.processSubsConfirmations(r)
+		case r := <-w.renameCheckResults:
+			w.processRenameCheck(r)
 		case nots := <-w.sentNotifications:
 			for _, n := range nots {
 				w.db.MustExec("delete from notification_queue where id = $1", n.ID)
 				w.db.MustExec("update users set reports=reports+1 where chat_id = $1", n.ChatID)
 			}
 		case r := <-w.downloadResults:
-			w.downloadErrors[w.downloadResultsPos] = !r
+			w.metrics.countImageDownload(r.site, r.success)
+			w.downloadErrors[w.downloadResultsPos] = !r.success
 			w.downloadResultsPos = (w.downloadResultsPos + 1) % w.cfg.ErrorDenominator
 		}
 	}
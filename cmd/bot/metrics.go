@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// pollDurationBuckets are the upper bounds of the poll duration histogram buckets in seconds
+var pollDurationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type histogram struct {
+	buckets []int
+	count   int
+	sum     float64
+}
+
+func (h *histogram) observe(bounds []float64, value float64) {
+	if h.buckets == nil {
+		h.buckets = make([]int, len(bounds))
+	}
+	for i, b := range bounds {
+		if value <= b {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// pollKey identifies the polls of an endpoint of a checker,
+// the endpoint is empty for the checkers not querying endpoints
+type pollKey struct {
+	site     string
+	endpoint string
+}
+
+type sendResultKey struct {
+	endpoint string
+	priority int
+	code     int
+}
+
+// botMetrics collects the metrics exposed in the Prometheus text format,
+// the checkers are identified by the names of the sites,
+// it is used by the main loop only, a nil value collects nothing
+type botMetrics struct {
+	pollDurations    map[pollKey]*histogram
+	statusChanges    map[string]int
+	confirmedChanges map[string]int
+	sendResults      map[sendResultKey]int
+	imageDownloads   map[string]int
+	imageErrors      map[string]int
+}
+
+func newBotMetrics() *botMetrics {
+	return &botMetrics{
+		pollDurations:    map[pollKey]*histogram{},
+		statusChanges:    map[string]int{},
+		confirmedChanges: map[string]int{},
+		sendResults:      map[sendResultKey]int{},
+		imageDownloads:   map[string]int{},
+		imageErrors:      map[string]int{},
+	}
+}
+
+func (m *botMetrics) observePoll(site string, endpoint string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	key := pollKey{site: site, endpoint: endpoint}
+	h := m.pollDurations[key]
+	if h == nil {
+		h = &histogram{}
+		m.pollDurations[key] = h
+	}
+	h.observe(pollDurationBuckets, elapsed.Seconds())
+}
+
+// observePolls records the duration of each endpoint query of a poll
+// or the duration of the whole poll if the checker does not query endpoints
+func (w *worker) observePolls(site string, data *cmdlib.StatusUpdateResultsData) {
+	if data.EndpointsElapsed == nil {
+		w.metrics.observePoll(site, "", data.Elapsed)
+		return
+	}
+	for endpoint, elapsed := range data.EndpointsElapsed {
+		w.metrics.observePoll(site, endpointLabel(site, endpoint), elapsed)
+	}
+}
+
+func (m *botMetrics) countStatusChange(site string, confirmed bool) {
+	if m == nil {
+		return
+	}
+	if confirmed {
+		m.confirmedChanges[site]++
+	} else {
+		m.statusChanges[site]++
+	}
+}
+
+func (m *botMetrics) countSendResult(r msgSendResult) {
+	if m == nil {
+		return
+	}
+	m.sendResults[sendResultKey{endpoint: r.endpoint, priority: r.priority, code: r.result}]++
+}
+
+func (m *botMetrics) countImageDownload(site string, success bool) {
+	if m == nil {
+		return
+	}
+	m.imageDownloads[site]++
+	if !success {
+		m.imageErrors[site]++
+	}
+}
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	out strings.Builder
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metricsWriter) header(name string, kind string, help string) {
+	fmt.Fprintf(&m.out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample with the labels given as name and value pairs
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.out.WriteString(name)
+	if len(labels) > 0 {
+		m.out.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.out.WriteString(",")
+			}
+			fmt.Fprintf(&m.out, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.out.WriteString("}")
+	}
+	m.out.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func (m *metricsWriter) counters(name string, help string, label string, values map[string]int, labelValue func(string) string) {
+	m.header(name, "counter", help)
+	for _, k := range sortedKeys(values) {
+		m.sample(name, float64(values[k]), label, labelValue(k))
+	}
+}
+
+func sortedKeys(xs map[string]int) []string {
+	result := make([]string, 0, len(xs))
+	for k := range xs {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func priorityName(priority int) string {
+	if priority == 0 {
+		return "high"
+	}
+	return "low"
+}
+
+// checkerLabel returns the label of the checker of a site,
+// the website is used for the single website configuration
+func (w *worker) checkerLabel(site string) string {
+	if s := w.sites[site]; s != nil && site == "" {
+		return s.website
+	}
+	return site
+}
+
+// modelSite returns the name of the site of a model
+func (w *worker) modelSite(modelID string) string {
+	if _, single := w.sites[""]; single {
+		return ""
+	}
+	site, _ := splitSiteModelID(modelID)
+	return site
+}
+
+// writeMetrics writes all the metrics, it must be called in the main loop
+func (w *worker) writeMetrics(out io.Writer) error {
+	m := w.metrics
+	mw := &metricsWriter{}
+
+	polls := make([]pollKey, 0, len(m.pollDurations))
+	for k := range m.pollDurations {
+		polls = append(polls, k)
+	}
+	sort.Slice(polls, func(i, j int) bool {
+		a, b := polls[i], polls[j]
+		if a.site != b.site {
+			return a.site < b.site
+		}
+		return a.endpoint < b.endpoint
+	})
+	mw.header("siren_poll_duration_seconds", "histogram", "The duration of successful online list polls.")
+	for _, k := range polls {
+		h := m.pollDurations[k]
+		labels := []string{"checker", w.checkerLabel(k.site), "endpoint", k.endpoint}
+		for i, b := range pollDurationBuckets {
+			mw.sample("siren_poll_duration_seconds_bucket", float64(h.buckets[i]), append(labels, "le", strconv.FormatFloat(b, 'g', -1, 64))...)
+		}
+		mw.sample("siren_poll_duration_seconds_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+		mw.sample("siren_poll_duration_seconds_sum", h.sum, labels...)
+		mw.sample("siren_poll_duration_seconds_count", float64(h.count), labels...)
+	}
+
+	online := map[string]int{}
+	for site := range w.sites {
+		online[site] = 0
+	}
+	for modelID := range w.ourOnline {
+		online[w.modelSite(modelID)]++
+	}
+	mw.header("siren_online_models", "gauge", "The number of confirmed online models.")
+	for _, site := range sortedKeys(online) {
+		mw.sample("siren_online_models", float64(online[site]), "checker", w.checkerLabel(site))
+	}
+
+	mw.counters("siren_status_changes_total", "The number of status changes reported by the checkers.", "checker", m.statusChanges, w.checkerLabel)
+	mw.counters("siren_confirmed_status_changes_total", "The number of confirmed status changes.", "checker", m.confirmedChanges, w.checkerLabel)
+	mw.counters("siren_image_downloads_total", "The number of downloaded images.", "checker", m.imageDownloads, w.checkerLabel)
+	mw.counters("siren_image_download_errors_total", "The number of failed image downloads.", "checker", m.imageErrors, w.checkerLabel)
+
+	keys := make([]sendResultKey, 0, len(m.sendResults))
+	for k := range m.sendResults {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return a.code < b.code
+	})
+	mw.header("siren_telegram_send_results_total", "counter", "The number of Telegram messages sending attempts by the result code.")
+	for _, k := range keys {
+		mw.sample("siren_telegram_send_results_total", float64(m.sendResults[k]), "endpoint", k.endpoint, "priority", priorityName(k.priority), "code", strconv.Itoa(k.code))
+	}
+
+	mw.header("siren_outgoing_queue_length", "gauge", "The number of messages waiting to be sent.")
+	mw.sample("siren_outgoing_queue_length", float64(len(w.highPriorityMsg)), "priority", priorityName(0))
+	mw.sample("siren_outgoing_queue_length", float64(len(w.lowPriorityMsg)), "priority", priorityName(1))
+
+	durations := w.db.Durations
+	var queries []string
+	for query := range durations {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+	mw.header("siren_db_query_duration_seconds", "summary", "The duration of database queries.")
+	for _, query := range queries {
+		mw.sample("siren_db_query_duration_seconds_sum", durations[query].Total(), "query", query)
+		mw.sample("siren_db_query_duration_seconds_count", float64(durations[query].Count), "query", query)
+	}
+
+	_, err := io.WriteString(out, mw.out.String())
+	return err
+}
+
+func (w *worker) processMetricsRequest(writer http.ResponseWriter, r *http.Request, done chan bool) {
+	defer func() { done <- true }()
+	if r.URL.Query().Get("password") != w.cfg.StatPassword {
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if err := w.writeMetrics(writer); err != nil {
+		lerr("error on processing metrics request, %v", err)
+	}
+}
+
+func (w *worker) handleMetricsEndpoint(metricsRequests chan statRequest) {
+	if w.cfg.MetricsPath == "" {
+		return
+	}
+	http.HandleFunc(w.cfg.MetricsPath, func(writer http.ResponseWriter, r *http.Request) {
+		request := statRequest{writer: writer, request: r, done: make(chan bool)}
+		metricsRequests <- request
+		<-request.done
+	})
+}
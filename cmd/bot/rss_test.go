@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcmk/siren/internal/checkers"
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+const benchmarkModels = 100000
+
+// measurePeakRss samples the resident set size while f runs
+// and returns its peak growth in KiB as it is reported in the statistics
+func measurePeakRss(f func()) int64 {
+	debug.FreeOSMemory()
+	base, _ := getRss()
+	peak := base
+	done := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if rss, _ := getRss(); rss > peak {
+					peak = rss
+				}
+			}
+		}
+	}()
+	f()
+	close(done)
+	wg.Wait()
+	if rss, _ := getRss(); rss > peak {
+		peak = rss
+	}
+	return (peak - base) / 1024
+}
+
+func benchmarkOnlineList(b *testing.B, f func(ctx context.Context, client *cmdlib.Client, endpoint string) int) {
+	var models []map[string]interface{}
+	for i := 0; i < benchmarkModels; i++ {
+		models = append(models, map[string]interface{}{
+			"username":     fmt.Sprintf("model%06d", i),
+			"image_url":    fmt.Sprintf("https://img/model%06d.jpg", i),
+			"current_show": "public",
+			"room_subject": "a pretty long room subject to make the response closer to the real one",
+			"num_users":    i,
+			"tags":         []string{"one", "two"},
+		})
+	}
+	body, err := json.Marshal(models)
+	if err != nil {
+		b.Fatal(err)
+	}
+	models = nil
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(body) }))
+	defer server.Close()
+	client := &cmdlib.Client{Client: server.Client()}
+	ctx := context.Background()
+	var maxPeak int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		peak := measurePeakRss(func() {
+			if n := f(ctx, client, server.URL); n != benchmarkModels {
+				b.Fatalf("unexpected number of models %d", n)
+			}
+		})
+		if peak > maxPeak {
+			maxPeak = peak
+		}
+	}
+	b.ReportMetric(float64(maxPeak), "peak-rss-KiB")
+}
+
+// BenchmarkOnlineListDecoding compares the peak RSS of reading a whole online list
+// before decoding it with decoding it element by element
+func BenchmarkOnlineListDecoding(b *testing.B) {
+	b.Run("buffered", func(b *testing.B) {
+		benchmarkOnlineList(b, func(ctx context.Context, client *cmdlib.Client, endpoint string) int {
+			resp, buf, err := cmdlib.OnlineQuery(ctx, endpoint, client, nil)
+			if err != nil || resp.StatusCode != 200 {
+				b.Fatalf("cannot query the list, %v", err)
+			}
+			var parsed []struct {
+				Username    string   `json:"username"`
+				ImageURL    string   `json:"image_url"`
+				CurrentShow string   `json:"current_show"`
+				RoomSubject string   `json:"room_subject"`
+				NumUsers    int      `json:"num_users"`
+				Tags        []string `json:"tags"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+				b.Fatal(err)
+			}
+			online := map[string]cmdlib.StreamInfo{}
+			for _, m := range parsed {
+				online[m.Username] = cmdlib.StreamInfo{ImageURL: m.ImageURL, Title: m.RoomSubject, Viewers: m.NumUsers, Tags: m.Tags}
+			}
+			return len(online)
+		})
+	})
+	b.Run("streaming", func(b *testing.B) {
+		benchmarkOnlineList(b, func(ctx context.Context, client *cmdlib.Client, endpoint string) int {
+			checker := &checkers.ChaturbateChecker{}
+			checker.Init(checker, cmdlib.CheckerConfig{Clients: []*cmdlib.Client{client}})
+			online, _, err := checker.CheckEndpoint(ctx, endpoint)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return len(online)
+		})
+	})
+}
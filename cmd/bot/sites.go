@@ -0,0 +1,235 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bcmk/siren/internal/botconfig"
+	"github.com/bcmk/siren/internal/checkers"
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// site represents a website checked by the bot
+//
+// The name of the site is used as a namespace for its models,
+// so that the models are stored as "site/model".
+// The name is empty for the single website configuration,
+// models are stored as they are then.
+type site struct {
+	name                  string
+	website               string
+	checker               cmdlib.Checker
+	modelIDPreprocessing  func(string) string
+	modelIDRegexp         *regexp.Regexp
+	periodSeconds         int
+	pollTimeoutSeconds    int
+	usersOnlineEndpoints  []string
+	specificConfig        map[string]string
+	nextMassOfflineReport time.Time
+}
+
+type siteStatusUpdateResults struct {
+	site    string
+	results cmdlib.StatusUpdateResults
+}
+
+func newSites(cfg *botconfig.Config) map[string]*site {
+	if cfg.Website != "" {
+		s := newSite("", cfg.Website, cfg.PeriodSeconds, cfg.UsersOnlineEndpoint, cfg.SpecificConfig)
+		s.setPollTimeout(cfg.PollTimeoutSeconds)
+		return map[string]*site{"": s}
+	}
+	result := map[string]*site{}
+	for name, x := range cfg.Websites {
+		periodSeconds := x.PeriodSeconds
+		if periodSeconds == 0 {
+			periodSeconds = cfg.PeriodSeconds
+		}
+		s := newSite(name, x.CheckerName(name), periodSeconds, x.UsersOnlineEndpoint, x.SpecificConfig)
+		s.setPollTimeout(x.PollTimeoutSeconds)
+		result[name] = s
+	}
+	return result
+}
+
+func newSite(name string, website string, periodSeconds int, usersOnlineEndpoints []string, specificConfig map[string]string) *site {
+	desc := checkers.Lookup(website)
+	if desc == nil {
+		panic("wrong website")
+	}
+	return &site{
+		name:                 name,
+		website:              website,
+		checker:              desc.NewChecker(),
+		modelIDPreprocessing: desc.CanonicalModelID,
+		modelIDRegexp:        desc.ModelIDRegexp,
+		periodSeconds:        periodSeconds,
+		usersOnlineEndpoints: desc.Endpoints(usersOnlineEndpoints),
+		specificConfig:       specificConfig,
+	}
+}
+
+func (s *site) setPollTimeout(pollTimeoutSeconds int) {
+	s.pollTimeoutSeconds = pollTimeoutSeconds
+	if s.pollTimeoutSeconds == 0 {
+		s.pollTimeoutSeconds = s.periodSeconds
+	}
+}
+
+// siteModelID returns a model ID namespaced by a site
+func siteModelID(site string, modelID string) string {
+	if site == "" {
+		return modelID
+	}
+	return site + "/" + modelID
+}
+
+// splitSiteModelID splits a namespaced model ID into a site and a model ID
+func splitSiteModelID(id string) (site string, modelID string) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 {
+		return "", id
+	}
+	return parts[0], parts[1]
+}
+
+// affiliateLink returns the function rendering the affiliate link of a model,
+// the link of a website gets the model ID without the website name,
+// the global link gets the full model ID
+func affiliateLink(cfg *botconfig.Config) func(string) (string, error) {
+	global := template.Must(template.New("").Parse(cfg.AffiliateLink))
+	links := map[string]*template.Template{}
+	for name, x := range cfg.Websites {
+		if x.AffiliateLink != "" {
+			links[name] = template.Must(template.New(name).Parse(x.AffiliateLink))
+		}
+	}
+	return func(modelID string) (string, error) {
+		site, id := splitSiteModelID(modelID)
+		link, data := links[site], id
+		if link == nil {
+			link, data = global, modelID
+		}
+		var buf strings.Builder
+		err := link.Execute(&buf, data)
+		return buf.String(), err
+	}
+}
+
+// parseModelID parses a model ID given by a user
+//
+// It returns a canonical namespaced model ID and whether it is valid.
+func (w *worker) parseModelID(arg string) (modelID string, valid bool) {
+	if s, single := w.sites[""]; single {
+		modelID = s.modelIDPreprocessing(arg)
+		return modelID, s.modelIDRegexp.MatchString(modelID)
+	}
+	name, modelID := splitSiteModelID(arg)
+	name = strings.ToLower(name)
+	s := w.sites[name]
+	if s == nil {
+		return arg, false
+	}
+	modelID = s.modelIDPreprocessing(modelID)
+	return siteModelID(name, modelID), s.modelIDRegexp.MatchString(modelID)
+}
+
+// streamInfo returns the latest known details of an online stream
+func (w *worker) streamInfo(modelID string) cmdlib.StreamInfo {
+	site, _ := splitSiteModelID(modelID)
+	return w.info[site][modelID]
+}
+
+// forSite returns the entries of the models of a site without a namespace
+func forSite[V any](xs map[string]V, site string) map[string]V {
+	result := map[string]V{}
+	for k, v := range xs {
+		if site == "" {
+			result[k] = v
+		} else if s, modelID := splitSiteModelID(k); s == site {
+			result[modelID] = v
+		}
+	}
+	return result
+}
+
+func namespacedModelIDs(site string, models map[string]bool) []string {
+	var result []string
+	for k := range models {
+		result = append(result, siteModelID(site, k))
+	}
+	return result
+}
+
+func namespaceInfo(site string, info map[string]cmdlib.StreamInfo) map[string]cmdlib.StreamInfo {
+	if site == "" || info == nil {
+		return info
+	}
+	result := make(map[string]cmdlib.StreamInfo, len(info))
+	for k, v := range info {
+		result[siteModelID(site, k)] = v
+	}
+	return result
+}
+
+func namespaceUserIDs(site string, userIDs map[string]string) map[string]string {
+	if site == "" || userIDs == nil {
+		return userIDs
+	}
+	result := make(map[string]string, len(userIDs))
+	for k, v := range userIDs {
+		result[siteModelID(site, k)] = v
+	}
+	return result
+}
+
+func namespaceStatusUpdateResults(site string, res cmdlib.StatusUpdateResults) cmdlib.StatusUpdateResults {
+	if site == "" || res.Data == nil {
+		return res
+	}
+	data := *res.Data
+	data.Updates = make([]cmdlib.StatusUpdate, len(res.Data.Updates))
+	for i, u := range res.Data.Updates {
+		u.ModelID = siteModelID(site, u.ModelID)
+		data.Updates[i] = u
+	}
+	data.Info = namespaceInfo(site, res.Data.Info)
+	res.Data = &data
+	return res
+}
+
+func namespaceStatusResults(site string, res cmdlib.StatusResults) cmdlib.StatusResults {
+	if site == "" || res.Data == nil {
+		return res
+	}
+	data := *res.Data
+	data.Statuses = make(map[string]cmdlib.StatusKind, len(res.Data.Statuses))
+	for k, v := range res.Data.Statuses {
+		data.Statuses[siteModelID(site, k)] = v
+	}
+	data.Info = namespaceInfo(site, res.Data.Info)
+	data.UserIDs = namespaceUserIDs(site, res.Data.UserIDs)
+	if res.Data.Renames != nil {
+		data.Renames = make(map[string]string, len(res.Data.Renames))
+		for k, v := range res.Data.Renames {
+			data.Renames[siteModelID(site, k)] = siteModelID(site, v)
+		}
+	}
+	res.Data = &data
+	return res
+}
+
+func (w *worker) startPollTimers() chan string {
+	result := make(chan string)
+	for name, s := range w.sites {
+		go func(name string, period time.Duration) {
+			ticker := time.NewTicker(period)
+			for range ticker.C {
+				result <- name
+			}
+		}(name, time.Duration(s.periodSeconds)*time.Second)
+	}
+	return result
+}
@@ -1,32 +1,50 @@
 package main
 
-import "github.com/bcmk/siren/internal/db"
+import (
+	"time"
+
+	"github.com/bcmk/siren/internal/db"
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// updatesStat describes the last status updates of a site
+type updatesStat struct {
+	duration         time.Duration
+	changes          int
+	confirmedChanges int
+}
 
 type statistics struct {
-	UsersCount                   int                   `json:"users_count"`
-	GroupsCount                  int                   `json:"groups_count"`
-	ActiveUsersOnEndpointCount   int                   `json:"active_users_on_endpoint_count"`
-	ActiveUsersTotalCount        int                   `json:"active_users_total_count"`
-	HeavyUsersCount              int                   `json:"heavy_users_count"`
-	ModelsCount                  int                   `json:"models_count"`
-	ModelsToPollOnEndpointCount  int                   `json:"models_to_poll_on_endpoint_count"`
-	ModelsToPollTotalCount       int                   `json:"models_to_poll_total_count"`
-	OnlineModelsCount            int                   `json:"online_models_count"`
-	KnownModelsCount             int                   `json:"known_models_count"`
-	SpecialModelsCount           int                   `json:"special_models_count"`
-	StatusChangesCount           int                   `json:"status_changes_count"`
-	QueriesDurationMilliseconds  int                   `json:"queries_duration_milliseconds"`
-	UpdatesDurationMilliseconds  int                   `json:"updates_duration_milliseconds"`
-	CleaningDurationMilliseconds int                   `json:"cleaning_duration_milliseconds"`
-	ErrorRate                    [2]int                `json:"error_rate"`
-	DownloadErrorRate            [2]int                `json:"download_error_rate"`
-	Rss                          int64                 `json:"rss"`
-	MaxRss                       int64                 `json:"max_rss"`
-	UserReferralsCount           int                   `json:"user_referrals_count"`
-	ModelReferralsCount          int                   `json:"model_referrals_count"`
-	ReportsCount                 int                   `json:"reports_count"`
-	ChangesInPeriod              int                   `json:"changes_in_period"`
-	ConfirmedChangesInPeriod     int                   `json:"confirmed_changes_in_period"`
-	Interactions                 map[int]int           `json:"interactions"`
-	InteractionsByKind           map[db.PacketKind]int `json:"interactions_by_kind"`
+	UsersCount                   int                        `json:"users_count"`
+	GroupsCount                  int                        `json:"groups_count"`
+	ActiveUsersOnEndpointCount   int                        `json:"active_users_on_endpoint_count"`
+	ActiveUsersTotalCount        int                        `json:"active_users_total_count"`
+	HeavyUsersCount              int                        `json:"heavy_users_count"`
+	ModelsCount                  int                        `json:"models_count"`
+	ModelsToPollOnEndpointCount  int                        `json:"models_to_poll_on_endpoint_count"`
+	ModelsToPollTotalCount       int                        `json:"models_to_poll_total_count"`
+	OnlineModelsCount            int                        `json:"online_models_count"`
+	KnownModelsCount             int                        `json:"known_models_count"`
+	SpecialModelsCount           int                        `json:"special_models_count"`
+	StatusChangesCount           int                        `json:"status_changes_count"`
+	QueriesDurationMilliseconds  int                        `json:"queries_duration_milliseconds"`
+	QueriesDurationsBySite       map[string]int             `json:"queries_durations_by_site,omitempty"`
+	UpdatesDurationMilliseconds  int                        `json:"updates_duration_milliseconds"`
+	CleaningDurationMilliseconds int                        `json:"cleaning_duration_milliseconds"`
+	ErrorRate                    [2]int                     `json:"error_rate"`
+	DownloadErrorRate            [2]int                     `json:"download_error_rate"`
+	ErrorsByKind                 map[string]int             `json:"errors_by_kind"`
+	ErrorsByEndpoint             map[string]map[string]int  `json:"errors_by_endpoint"`
+	Rss                          int64                      `json:"rss"`
+	MaxRss                       int64                      `json:"max_rss"`
+	UserReferralsCount           int                        `json:"user_referrals_count"`
+	ModelReferralsCount          int                        `json:"model_referrals_count"`
+	ReportsCount                 int                        `json:"reports_count"`
+	ChangesInPeriod              int                        `json:"changes_in_period"`
+	ConfirmedChangesInPeriod     int                        `json:"confirmed_changes_in_period"`
+	Interactions                 map[int]int                `json:"interactions"`
+	InteractionsByKind           map[db.PacketKind]int      `json:"interactions_by_kind"`
+	ClientsHealth                []cmdlib.ClientHealthStat  `json:"clients_health"`
+	ResponseCacheHitRate         [2]int                     `json:"response_cache_hit_rate"`
+	Coverage                     map[string]cmdlib.Coverage `json:"coverage"`
 }
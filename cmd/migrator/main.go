@@ -5,6 +5,7 @@ import (
 	"flag"
 
 	"github.com/bcmk/siren/internal/botconfig"
+	"github.com/bcmk/siren/internal/checkers"
 	"github.com/bcmk/siren/internal/db"
 	"github.com/bcmk/siren/lib/cmdlib"
 )
@@ -17,7 +18,7 @@ func main() {
 	if len(args) != 1 {
 		panic("usage: migrator <config>")
 	}
-	cfg := botconfig.ReadConfig(args[0])
+	cfg := botconfig.ReadConfig(args[0], checkers.SpecificConfig)
 
 	db := db.NewDatabase(cfg.DBPath, cfg.CheckGID)
 
@@ -0,0 +1,269 @@
+// This program checks models on any of the supported websites
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bcmk/siren/internal/botconfig"
+	"github.com/bcmk/siren/internal/checkers"
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+var verbose = flag.Bool("v", false, "verbose output")
+var timeout = flag.Int("t", 10, "timeout in seconds")
+var address = flag.String("a", "", "source IP address")
+var cookies = flag.Bool("c", false, "use cookies")
+var output = flag.String("o", "table", "output format: table, tsv or json")
+var configPath = flag.String("config", "", "bot config to take headers, endpoints and specific config from")
+var endpoints = cmdlib.StringSetFlag{}
+var specificConfig = specificConfigFlag{}
+
+// specificConfigFlag is a flag representing specific config entries in key=value form
+type specificConfigFlag map[string]string
+
+// String implements flag.Value interface
+func (s *specificConfigFlag) String() string {
+	var xs []string
+	for k, v := range *s {
+		xs = append(xs, k+"="+v)
+	}
+	return strings.Join(xs, ", ")
+}
+
+// Set implements flag.Value interface
+func (s *specificConfigFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	(*s)[parts[0]] = parts[1]
+	return nil
+}
+
+type modelResult struct {
+	Model    string `json:"model"`
+	Status   string `json:"status"`
+	SubState string `json:"sub_state,omitempty"`
+	Viewers  int    `json:"viewers,omitempty"`
+	Title    string `json:"title,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+type report struct {
+	Command   string           `json:"command"`
+	Site      string           `json:"site"`
+	ElapsedMs int64            `json:"elapsed_ms"`
+	Error     string           `json:"error,omitempty"`
+	Coverage  *cmdlib.Coverage `json:"coverage,omitempty"`
+	Models    []modelResult    `json:"models"`
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s [options] status <site> <model ID>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s [options] many <site> <model IDs...>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s [options] online <site>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "sites: %s\n", strings.Join(checkers.Names(), ", "))
+	flag.PrintDefaults()
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Var(&endpoints, "e", "online query endpoint, can be repeated")
+	flag.Var(&specificConfig, "s", "specific config entry in key=value form, can be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, siteName, args := flag.Arg(0), flag.Arg(1), flag.Args()[2:]
+	switch {
+	case command == "status" && len(args) == 1:
+	case command == "many" && len(args) > 0:
+	case command == "online" && len(args) == 0:
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "tsv" && *output != "json" {
+		fail("unknown output format %q", *output)
+	}
+	var cfg *botconfig.Config
+	var website botconfig.Website
+	if *configPath != "" {
+		cfg = botconfig.ReadConfig(*configPath, checkers.SpecificConfig)
+		website, _ = cfg.WebsiteConfig(siteName)
+	}
+	site := checkers.Lookup(website.CheckerName(siteName))
+	if site == nil {
+		fail("unknown site %q, use one of %s", siteName, strings.Join(checkers.Names(), ", "))
+	}
+	var modelIDs []string
+	for _, arg := range args {
+		modelID := site.CanonicalModelID(arg)
+		if !site.ModelIDRegexp.MatchString(modelID) {
+			fail("invalid model ID %q", arg)
+		}
+		modelIDs = append(modelIDs, modelID)
+	}
+
+	config := checkerConfig(site, cfg, website)
+	checker := site.NewChecker()
+	checker.Init(checker, config)
+
+	ctx := context.Background()
+	start := time.Now()
+	var statuses map[string]cmdlib.StatusKind
+	var info map[string]cmdlib.StreamInfo
+	var coverage *cmdlib.Coverage
+	var err error
+	switch command {
+	case "status":
+		status, streamInfo := checker.CheckStatusSingle(ctx, modelIDs[0])
+		statuses = map[string]cmdlib.StatusKind{modelIDs[0]: status}
+		info = map[string]cmdlib.StreamInfo{modelIDs[0]: streamInfo}
+	case "many":
+		statuses, info, err = checker.CheckStatusesMany(ctx, cmdlib.NewQueryModelList(modelIDs), cmdlib.CheckStatuses)
+		if err == nil && cmdlib.IsFullChecker(checker) {
+			statuses = requestedStatuses(statuses, modelIDs)
+		}
+	case "online":
+		if cc, ok := checker.(cmdlib.CoverageChecker); ok {
+			results := cmdlib.QueryEndpoints(ctx, cc, config.UsersOnlineEndpoints, 0, 0, *verbose)
+			statuses, info, err = cmdlib.MergeEndpointResults(results)
+			coverage = cmdlib.EndpointsCoverage(results)
+		} else {
+			statuses, info, err = checker.CheckStatusesMany(ctx, cmdlib.AllModels, cmdlib.CheckOnline)
+		}
+	}
+	elapsed := time.Since(start)
+
+	r := report{Command: command, Site: siteName, ElapsedMs: elapsed.Milliseconds(), Coverage: coverage, Models: []modelResult{}}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for modelID, status := range statuses {
+		i := info[modelID]
+		m := modelResult{Model: modelID, Status: status.String(), Viewers: i.Viewers, Title: i.Title, ImageURL: i.ImageURL}
+		if i.SubState != cmdlib.SubStateUnknown {
+			m.SubState = i.SubState.String()
+		}
+		r.Models = append(r.Models, m)
+	}
+	sort.Slice(r.Models, func(i, j int) bool { return r.Models[i].Model < r.Models[j].Model })
+
+	switch *output {
+	case "json":
+		printJSON(r)
+	case "tsv":
+		printTSV(r)
+	default:
+		printTable(r)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// requestedStatuses picks the requested models from a full online list,
+// the models missing in it are offline
+func requestedStatuses(online map[string]cmdlib.StatusKind, modelIDs []string) map[string]cmdlib.StatusKind {
+	result := map[string]cmdlib.StatusKind{}
+	for _, modelID := range modelIDs {
+		if status, ok := online[modelID]; ok {
+			result[modelID] = status
+		} else {
+			result[modelID] = cmdlib.StatusOffline
+		}
+	}
+	return result
+}
+
+// checkerConfig combines the bot config and the command line flags
+func checkerConfig(site *checkers.Site, cfg *botconfig.Config, website botconfig.Website) cmdlib.CheckerConfig {
+	client := cmdlib.HTTPClientWithTimeoutAndAddress(*timeout, *address, *cookies)
+	config := cmdlib.CheckerConfig{Clients: []*cmdlib.Client{client}, Dbg: *verbose, SpecificConfig: map[string]string{}}
+	if cfg != nil {
+		config.Headers = cfg.Headers
+		config.UsersOnlineEndpoints = website.UsersOnlineEndpoint
+		for k, v := range website.SpecificConfig {
+			config.SpecificConfig[k] = v
+		}
+	}
+	if len(endpoints) != 0 {
+		config.UsersOnlineEndpoints = nil
+		for endpoint := range endpoints {
+			config.UsersOnlineEndpoints = append(config.UsersOnlineEndpoints, endpoint)
+		}
+	}
+	config.UsersOnlineEndpoints = site.Endpoints(config.UsersOnlineEndpoints)
+	for k, v := range specificConfig {
+		config.SpecificConfig[k] = v
+	}
+	for _, key := range site.RequiredSpecificConfig {
+		if config.SpecificConfig[key] == "" {
+			fail("specify %s with -s %s=<value> or in the config", key, key)
+		}
+	}
+	if site.CheckSpecificConfig != nil {
+		if err := site.CheckSpecificConfig(config.SpecificConfig); err != nil {
+			fail("wrong specific config, %v", err)
+		}
+	}
+	return config
+}
+
+func printJSON(r report) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	cmdlib.CheckErr(encoder.Encode(r))
+}
+
+func printTSV(r report) {
+	for _, m := range r.Models {
+		fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\n", m.Model, m.Status, m.SubState, m.Viewers, tsvField(m.Title), m.ImageURL)
+	}
+	printSummary(r)
+}
+
+func printTable(r report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tSTATUS\tSHOW\tVIEWERS\tTITLE\tIMAGE")
+	for _, m := range r.Models {
+		viewers := ""
+		if m.Viewers != 0 {
+			viewers = fmt.Sprint(m.Viewers)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.Model, m.Status, m.SubState, viewers, tsvField(m.Title), m.ImageURL)
+	}
+	cmdlib.CheckErr(w.Flush())
+	printSummary(r)
+}
+
+// printSummary prints timing and errors to stderr to keep the output parsable
+func printSummary(r report) {
+	if r.Error != "" {
+		fmt.Fprintf(os.Stderr, "error occurred: %s\n", r.Error)
+	}
+	fmt.Fprintf(os.Stderr, "%d models in %v\n", len(r.Models), time.Duration(r.ElapsedMs)*time.Millisecond)
+	if r.Coverage != nil {
+		fmt.Fprintf(os.Stderr, "coverage: %v\n", *r.Coverage)
+	}
+}
+
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
@@ -1,45 +0,0 @@
-// This program checks if a specific Twitch stream is online
-package main
-
-import (
-	"flag"
-	"fmt"
-	"os"
-
-	"github.com/bcmk/siren/internal/checkers"
-	"github.com/bcmk/siren/lib/cmdlib"
-)
-
-var verbose = flag.Bool("v", false, "verbose output")
-var timeout = flag.Int("t", 10, "timeout in seconds")
-var address = flag.String("a", "", "source IP address")
-var cookies = flag.Bool("c", false, "use cookies")
-var clientID = flag.String("id", "", "your client id")
-var secret = flag.String("secret", "", "your client secret")
-
-func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: %s [options] <model ID>\n", os.Args[0])
-		flag.PrintDefaults()
-	}
-	flag.Parse()
-	if flag.NArg() != 1 {
-		flag.Usage()
-		return
-	}
-	channel := flag.Arg(0)
-	if !cmdlib.ModelIDRegexp.MatchString(channel) {
-		fmt.Println("invalid channel name")
-		return
-	}
-	client := cmdlib.HTTPClientWithTimeoutAndAddress(*timeout, *address, *cookies)
-	checker := &checkers.TwitchChecker{}
-	checker.Init(checker, cmdlib.CheckerConfig{
-		Clients: []*cmdlib.Client{client},
-		Dbg:     *verbose,
-		SpecificConfig: map[string]string{
-			"client_id":     *clientID,
-			"client_secret": *secret,
-		}})
-	fmt.Println(checker.CheckStatusSingle(channel))
-}
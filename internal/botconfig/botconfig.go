@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -20,6 +21,7 @@ var checkErr = cmdlib.CheckErr
 type endpoint struct {
 	ListenPath          string   `json:"listen_path"`          // the path excluding domain to listen to, the good choice is "/your-telegram-bot-token"
 	StatPath            string   `json:"stat_path"`            // the path for statistics
+	FailuresPath        string   `json:"failures_path"`        // the path for the failing responses, it is protected by the statistics password
 	WebhookDomain       string   `json:"webhook_domain"`       // the domain listening to the webhook
 	CertificatePath     string   `json:"certificate_path"`     // a path to your certificate, it is used to set up a webhook and to set up this HTTP server
 	BotToken            string   `json:"bot_token"`            // your Telegram bot token
@@ -37,14 +39,56 @@ type StatusConfirmationSeconds struct {
 	Denied   int `json:"denied"`
 }
 
+// Proxy represents a proxy used as a separate client to query the websites
+type Proxy struct {
+	URL      string      `json:"url"`      // the proxy URL with "http", "https" or "socks5" scheme, e.g. "socks5://10.0.0.1:1080"
+	Username string      `json:"username"` // the proxy username, optional
+	Password string      `json:"password"` // the proxy password, optional
+	Headers  [][2]string `json:"headers"`  // HTTP headers to make queries through this proxy with, they override the common headers
+}
+
+// ProxyURL returns the proxy URL including the credentials
+func (p Proxy) ProxyURL() (*url.URL, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse proxy URL %s, %v", p.URL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme in %s", p.URL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("configure proxy host in %s", p.URL)
+	}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	} else if p.Password != "" {
+		return nil, fmt.Errorf("configure proxy username for %s", p.URL)
+	}
+	return u, nil
+}
+
+// Website represents a configuration of a checker for a single website
+type Website struct {
+	PeriodSeconds       int               `json:"period_seconds"`        // the period of querying models statuses, the global period is used if it is zero
+	UsersOnlineEndpoint []string          `json:"users_online_endpoint"` // the endpoint to fetch online users
+	SpecificConfig      map[string]string `json:"specific_config"`       // the config for specific website
+	PollTimeoutSeconds  int               `json:"poll_timeout_seconds"`  // the deadline of a single poll, the polling period is used if it is zero
+	Checker             string            `json:"checker"`               // the checker to use, the website name is used if it is empty, e.g. "json_api" for a declarative JSON feed
+	AffiliateLink       string            `json:"affiliate_link"`        // affiliate link template getting the model ID without the website name, the global one getting the full model ID is used if it is empty
+}
+
 // Config represents bot configuration
 type Config struct {
 	Debug                           bool                      `json:"debug"`                              // debug mode
 	CheckGID                        bool                      `json:"check_gid"`                          // check goroutines ids
 	ListenAddress                   string                    `json:"listen_address"`                     // the address to listen to
-	Website                         string                    `json:"website"`                            // one of the following strings: "bongacams", "stripchat", "chaturbate", "livejasmin", "flirt4free", "streamate", "cam4"
+	Website                         string                    `json:"website"`                            // one of the websites registered in the checkers package, e.g. "chaturbate" or "stripchat"
+	Websites                        map[string]Website        `json:"websites"`                           // the websites to check by their names, use it instead of website to run several checkers, models are referred as "website/model" then
 	WebsiteLink                     string                    `json:"website_link"`                       // affiliate link to website
 	PeriodSeconds                   int                       `json:"period_seconds"`                     // the period of querying models statuses
+	PollTimeoutSeconds              int                       `json:"poll_timeout_seconds"`               // the deadline of a single poll, the polling period is used if it is zero
 	CleaningPeriodSeconds           int                       `json:"cleaning_period_seconds"`            // the cleaning period
 	MaxModels                       int                       `json:"max_models"`                         // maximum models per user
 	TimeoutSeconds                  int                       `json:"timeout_seconds"`                    // HTTP timeout
@@ -52,20 +96,40 @@ type Config struct {
 	AdminEndpoint                   string                    `json:"admin_endpoint"`                     // admin endpoint
 	DBPath                          string                    `json:"db_path"`                            // path to the database
 	BlockThreshold                  int                       `json:"block_threshold"`                    // do not send a message to the user after being blocked by him this number of times
-	IntervalMs                      int                       `json:"interval_ms"`                        // queries interval per IP address for rate limited access
+	IntervalMs                      int                       `json:"interval_ms"`                        // queries interval per IP address for rate limited access, deprecated, use requests_per_second
+	RequestsPerSecond               float64                   `json:"requests_per_second"`                // the rate of queries per IP address, zero means no limit
+	RequestsBurst                   int                       `json:"requests_burst"`                     // the maximum burst of queries per IP address
 	SourceIPAddresses               []string                  `json:"source_ip_addresses"`                // source IP addresses for rate limited access
+	SourceIPHeaders                 map[string][][2]string    `json:"source_ip_headers"`                  // HTTP headers by source IP address, they override the common headers
+	Proxies                         []Proxy                   `json:"proxies"`                            // proxies for rate limited access, each one is used alongside source IP addresses
+	FailuresToQuarantine            int                       `json:"failures_to_quarantine"`             // quarantine a source IP address after this number of consecutive failures
+	QuarantineSeconds               int                       `json:"quarantine_seconds"`                 // the duration of the first quarantine of a source IP address, it doubles with each next one
+	MaxQuarantineSeconds            int                       `json:"max_quarantine_seconds"`             // the maximum duration of a quarantine of a source IP address
+	MassOfflineGuard                string                    `json:"mass_offline_guard"`                 // reject an update if more models go offline at once, format "1000" or "30%"
+	MassOfflineGuardPolls           int                       `json:"mass_offline_guard_polls"`           // accept a drop rejected by mass_offline_guard this number of times in a row, zero means 3
+	MinCoveragePercent              float64                   `json:"min_coverage_percent"`               // do not take models missing in a paginated list as offline if it covers less of the reported total
+	MaxResponseBytes                int64                     `json:"max_response_bytes"`                 // fail the online list queries with larger responses, zero means no limit
+	ResponseCache                   bool                      `json:"response_cache"`                     // send conditional online list queries and reuse the last parsed list if it is not modified
+	FailureLogDir                   string                    `json:"failure_log_dir"`                    // keep recent failing responses in this directory, empty disables it
+	FailureLogEntries               int                       `json:"failure_log_entries"`                // the number of failing responses kept for each checker and kind of failure
+	FailureLogBodyBytes             int                       `json:"failure_log_body_bytes"`             // the bodies of failing responses are truncated to this size
 	DangerousErrorRate              string                    `json:"dangerous_error_rate"`               // dangerous error rate, warn admin if it is reached, format "1000/10000"
 	EnableCookies                   bool                      `json:"enable_cookies"`                     // enable cookies, it can be useful to mitigate rate limits
 	Headers                         [][2]string               `json:"headers"`                            // HTTP headers to make queries with
 	StatPassword                    string                    `json:"stat_password"`                      // password for statistics
+	MetricsPath                     string                    `json:"metrics_path"`                       // the path for the metrics in the Prometheus format, it is protected by the statistics password, empty disables it
 	ErrorReportingPeriodMinutes     int                       `json:"error_reporting_period_minutes"`     // the period of the error reports
 	Endpoints                       map[string]endpoint       `json:"endpoints"`                          // the endpoints by simple name, used for the support of the bots in different languages accessing the same database
 	HeavyUserRemainder              int                       `json:"heavy_user_remainder"`               // the maximum remainder of models to treat a user as heavy
 	ReferralBonus                   int                       `json:"referral_bonus"`                     // number of additional subscriptions for a referrer
 	FollowerBonus                   int                       `json:"follower_bonus"`                     // number of additional subscriptions for a new user registered by a referral link
 	UsersOnlineEndpoint             []string                  `json:"users_online_endpoint"`              // the endpoint to fetch online users
+	EndpointRetries                 int                       `json:"endpoint_retries"`                   // the number of retries of a failed endpoint query
+	EndpointRetryDelayMs            int                       `json:"endpoint_retry_delay_ms"`            // the delay before the first retry of a failed endpoint query, it doubles with each next one
+	SingleCheckTimeoutSeconds       int                       `json:"single_check_timeout_seconds"`       // the deadline of a check of a single model, zero means no deadline
 	StatusConfirmationSeconds       StatusConfirmationSeconds `json:"status_confirmation_seconds"`        // a status is confirmed only if it lasts for at least this number of seconds
 	OfflineNotifications            bool                      `json:"offline_notifications"`              // enable offline notifications
+	SubStateNotifications           bool                      `json:"sub_state_notifications"`            // enable notifications of show changes like going private and back in public
 	SQLPrelude                      []string                  `json:"sql_prelude"`                        // run these SQL commands before any other
 	EnableWeek                      bool                      `json:"enable_week"`                        // enable week command
 	AffiliateLink                   string                    `json:"affiliate_link"`                     // affiliate link template
@@ -75,42 +139,92 @@ type Config struct {
 	KeepStatusesForDays             int                       `json:"keep_statuses_for_days"`             // keep statuses for this number of days
 	MaxCleanSeconds                 int                       `json:"max_clean_seconds"`                  // maximum number of seconds to clean
 	SubsConfirmationPeriodSeconds   int                       `json:"subs_confirmation_period_seconds"`   // subscriptions confirmation period
+	RenameCheckPeriodSeconds        int                       `json:"rename_check_period_seconds"`        // the period of the checks for renamed models on the sites with stable user IDs, zero disables them
 	NotificationsReadyPeriodSeconds int                       `json:"notifications_ready_period_seconds"` // notifications ready check period
 	SpecialModels                   bool                      `json:"special_models"`                     // process special models
 	ShowImages                      bool                      `json:"show_images"`                        // images support
 
 	ErrorThreshold   int
 	ErrorDenominator int
+	OfflineGuard     cmdlib.MassOfflineGuard
 }
 
 var fractionRegexp = regexp.MustCompile(`^(\d+)/(\d+)$`)
+var guardRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)(%?)$`)
+var websiteNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
 
-// ReadConfig read config
-func ReadConfig(path string) *Config {
+// SpecificConfigLookup returns the keys required in specific_config of a website and its validation if set,
+// it fails for an unknown website
+type SpecificConfigLookup func(website string) (required []string, check func(map[string]string) error, err error)
+
+// ReadConfig read config,
+// the websites and their specific_config are validated with the lookup, it is required
+func ReadConfig(path string, lookup SpecificConfigLookup) *Config {
 	file, err := os.Open(filepath.Clean(path))
 	checkErr(err)
 	defer func() { checkErr(file.Close()) }()
-	return parseConfig(file)
+	return parseConfig(file, lookup)
 }
 
-func parseConfig(r io.Reader) *Config {
+func parseConfig(r io.Reader, lookup SpecificConfigLookup) *Config {
 	decoder := json.NewDecoder(r)
 	decoder.DisallowUnknownFields()
 	cfg := &Config{ShowImages: true}
 	err := decoder.Decode(cfg)
 	checkErr(err)
-	checkErr(checkConfig(cfg))
-	if len(cfg.SourceIPAddresses) == 0 {
+	checkErr(checkConfig(cfg, lookup))
+	if len(cfg.SourceIPAddresses) == 0 && len(cfg.Proxies) == 0 {
 		cfg.SourceIPAddresses = append(cfg.SourceIPAddresses, "")
 	}
 	return cfg
 }
 
-func checkConfig(cfg *Config) error {
+// CheckerName returns the name of the checker for the website
+func (w Website) CheckerName(name string) string {
+	if w.Checker != "" {
+		return w.Checker
+	}
+	return name
+}
+
+// WebsiteConfig returns the configuration of a checked website by its name
+func (c *Config) WebsiteConfig(name string) (Website, bool) {
+	if c.Website != "" {
+		if c.Website != name {
+			return Website{}, false
+		}
+		return Website{
+			Checker:             c.Website,
+			PeriodSeconds:       c.PeriodSeconds,
+			UsersOnlineEndpoint: c.UsersOnlineEndpoint,
+			SpecificConfig:      c.SpecificConfig,
+			PollTimeoutSeconds:  c.PollTimeoutSeconds,
+		}, true
+	}
+	x, found := c.Websites[name]
+	return x, found
+}
+
+func checkConfig(cfg *Config, lookup SpecificConfigLookup) error {
+	if lookup == nil {
+		return errors.New("no website lookup to validate the config")
+	}
+	sourceIPs := map[string]bool{}
 	for _, x := range cfg.SourceIPAddresses {
 		if net.ParseIP(x) == nil {
 			return fmt.Errorf("cannot parse sourece IP address %s", x)
 		}
+		sourceIPs[x] = true
+	}
+	for x := range cfg.SourceIPHeaders {
+		if !sourceIPs[x] {
+			return fmt.Errorf("source_ip_headers contains unknown source IP address %s", x)
+		}
+	}
+	for _, x := range cfg.Proxies {
+		if _, err := x.ProxyURL(); err != nil {
+			return err
+		}
 	}
 	for _, x := range cfg.Endpoints {
 		if x.ListenPath == "" {
@@ -135,8 +249,8 @@ func checkConfig(cfg *Config) error {
 	if _, found := cfg.Endpoints[cfg.AdminEndpoint]; !found {
 		return errors.New("configure admin_endpoint")
 	}
-	if cfg.PeriodSeconds == 0 {
-		return errors.New("configure period_seconds")
+	if err := checkWebsites(cfg, lookup); err != nil {
+		return err
 	}
 	if cfg.MaxModels == 0 {
 		return errors.New("configure max_models")
@@ -153,20 +267,9 @@ func checkConfig(cfg *Config) error {
 	if cfg.BlockThreshold == 0 {
 		return errors.New("configure block_threshold")
 	}
-	if cfg.Website == "" {
-		return errors.New("configure website")
-	}
 	if cfg.WebsiteLink == "" {
 		return errors.New("configure website_link")
 	}
-	if cfg.Website == "livejasmin" {
-		if cfg.SpecificConfig["ps_id"] == "" {
-			return errors.New("configure specific_config/ps_id")
-		}
-		if cfg.SpecificConfig["access_key"] == "" {
-			return errors.New("configure specific_config/access_key")
-		}
-	}
 	if cfg.StatPassword == "" {
 		return errors.New("configure stat_password")
 	}
@@ -182,6 +285,25 @@ func checkConfig(cfg *Config) error {
 	if cfg.FollowerBonus == 0 {
 		return errors.New("configure follower_bonus")
 	}
+	if cfg.RequestsPerSecond == 0 && cfg.IntervalMs != 0 {
+		cfg.RequestsPerSecond = 1000. / float64(cfg.IntervalMs)
+		cfg.RequestsBurst = 1
+	}
+	if cfg.RequestsPerSecond < 0 || cfg.RequestsBurst < 0 {
+		return errors.New("configure requests_per_second and requests_burst as non-negative numbers")
+	}
+	if cfg.FailuresToQuarantine == 0 {
+		cfg.FailuresToQuarantine = cmdlib.DefaultClientHealthPolicy.FailuresToQuarantine
+	}
+	if cfg.QuarantineSeconds == 0 {
+		cfg.QuarantineSeconds = int(cmdlib.DefaultClientHealthPolicy.BaseQuarantine.Seconds())
+	}
+	if cfg.MaxQuarantineSeconds == 0 {
+		cfg.MaxQuarantineSeconds = int(cmdlib.DefaultClientHealthPolicy.MaxQuarantine.Seconds())
+	}
+	if cfg.EndpointRetries != 0 && cfg.EndpointRetryDelayMs == 0 {
+		cfg.EndpointRetryDelayMs = 1000
+	}
 	if cfg.AffiliateLink == "" {
 		cfg.AffiliateLink = "{{ . }}"
 	}
@@ -201,6 +323,49 @@ func checkConfig(cfg *Config) error {
 		return errors.New("configure notifications_ready_period_seconds")
 	}
 
+	if cfg.MassOfflineGuard != "" {
+		m := guardRegexp.FindStringSubmatch(cfg.MassOfflineGuard)
+		if len(m) != 3 {
+			return errors.New(`configure mass_offline_guard as "x" or "x%"`)
+		}
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return err
+		}
+		if m[2] == "%" {
+			cfg.OfflineGuard.Percent = value
+		} else if value == float64(int(value)) {
+			cfg.OfflineGuard.Count = int(value)
+		} else {
+			return errors.New("configure mass_offline_guard as an integer number of models")
+		}
+	}
+
+	if cfg.MassOfflineGuardPolls < 0 {
+		return errors.New("configure mass_offline_guard_polls as a non-negative number")
+	}
+	cfg.OfflineGuard.Polls = cfg.MassOfflineGuardPolls
+
+	if cfg.MinCoveragePercent < 0 || cfg.MinCoveragePercent > 100 {
+		return errors.New("configure min_coverage_percent between 0 and 100")
+	}
+
+	if cfg.MaxResponseBytes < 0 {
+		return errors.New("configure max_response_bytes as a non-negative number")
+	}
+
+	if cfg.FailureLogDir != "" && cfg.FailureLogEntries <= 0 {
+		return errors.New("configure failure_log_entries as a positive number")
+	}
+
+	if cfg.SingleCheckTimeoutSeconds < 0 {
+		return errors.New("configure single_check_timeout_seconds as a non-negative number")
+	}
+
+	if cfg.FailureLogBodyBytes < 0 {
+		return errors.New("configure failure_log_body_bytes as a non-negative number")
+	}
+
 	if m := fractionRegexp.FindStringSubmatch(cfg.DangerousErrorRate); len(m) == 3 {
 		errorThreshold, err := strconv.ParseInt(m[1], 10, 0)
 		if err != nil {
@@ -224,3 +389,48 @@ func checkConfig(cfg *Config) error {
 
 	return nil
 }
+
+func checkWebsites(cfg *Config, lookup SpecificConfigLookup) error {
+	if cfg.Website == "" && len(cfg.Websites) == 0 {
+		return errors.New("configure website or websites")
+	}
+	if cfg.Website != "" && len(cfg.Websites) != 0 {
+		return errors.New("configure either website or websites")
+	}
+	if cfg.Website != "" {
+		if cfg.PeriodSeconds == 0 {
+			return errors.New("configure period_seconds")
+		}
+		return checkSpecificConfig(lookup, cfg.Website, "specific_config", cfg.SpecificConfig)
+	}
+	for name, x := range cfg.Websites {
+		if !websiteNameRegexp.MatchString(name) {
+			return fmt.Errorf("wrong website name %q, use lowercase letters, digits and underscores", name)
+		}
+		if x.PeriodSeconds == 0 && cfg.PeriodSeconds == 0 {
+			return fmt.Errorf("configure websites/%s/period_seconds", name)
+		}
+		if err := checkSpecificConfig(lookup, x.CheckerName(name), "websites/"+name+"/specific_config", x.SpecificConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSpecificConfig(lookup SpecificConfigLookup, website string, prefix string, specificConfig map[string]string) error {
+	required, check, err := lookup(website)
+	if err != nil {
+		return err
+	}
+	for _, key := range required {
+		if specificConfig[key] == "" {
+			return fmt.Errorf("configure %s/%s", prefix, key)
+		}
+	}
+	if check != nil {
+		if err := check(specificConfig); err != nil {
+			return fmt.Errorf("configure %s, %v", prefix, err)
+		}
+	}
+	return nil
+}
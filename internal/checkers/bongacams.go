@@ -1,11 +1,9 @@
 package checkers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"strings"
 
 	"github.com/bcmk/siren/lib/cmdlib"
@@ -16,6 +14,13 @@ type BongaCamsChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &BongaCamsChecker{}
 
+func init() {
+	Register(Site{
+		Name:       "bongacams",
+		NewChecker: func() cmdlib.Checker { return &BongaCamsChecker{} },
+	})
+}
+
 type bongacamsModel struct {
 	Username      string `json:"username"`
 	ProfileImages struct {
@@ -24,61 +29,61 @@ type bongacamsModel struct {
 }
 
 // CheckStatusSingle checks BongaCams model status
-func (c *BongaCamsChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
-	code := c.QueryStatusCode(fmt.Sprintf("https://en.bongacams.com/%s", modelID))
+func (c *BongaCamsChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	code := c.QueryStatusCode(ctx, fmt.Sprintf("https://en.bongacams.com/%s", modelID))
 	switch code {
 	case 200:
-		return cmdlib.StatusOnline
+		return cmdlib.StatusOnline, cmdlib.StreamInfo{}
 	case 302:
-		return cmdlib.StatusOffline
+		return cmdlib.StatusOffline, cmdlib.StreamInfo{}
 	case 404:
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
-	return cmdlib.StatusUnknown
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 }
 
 // CheckEndpoint returns BongaCams online models on the endpoint
-func (c *BongaCamsChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *BongaCamsChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
+	info = map[string]cmdlib.StreamInfo{}
 
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	resp, err := cmdlib.OnlineStreamQuery(ctx, endpoint, client, c.Headers, c.MaxResponseBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
+	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
-	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
-	var parsed []bongacamsModel
-	err = decoder.Decode(&parsed)
-	if err != nil {
-		if c.Dbg {
-			cmdlib.Ldbg("response: %s", buf.String())
+	decoder := json.NewDecoder(resp.Body)
+	err = cmdlib.DecodeJSONArray(decoder, nil, func() error {
+		var m bongacamsModel
+		if err := decoder.Decode(&m); err != nil {
+			return err
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
-	}
-
-	if len(parsed) == 0 {
-		return nil, nil, errors.New("zero online models reported")
-	}
-
-	for _, m := range parsed {
 		modelID := strings.ToLower(m.Username)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = "https:" + m.ProfileImages.ThumbnailImageMediumLive
+		info[modelID] = cmdlib.StreamInfo{ImageURL: "https:" + m.ProfileImages.ThumbnailImageMediumLive}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, cmdlib.ParseError(err)
+	}
+
+	if len(onlineModels) == 0 {
+		return nil, nil, cmdlib.ErrEmptyResult
 	}
 	return
 }
 
 // CheckStatusesMany returns BongaCams online models
-func (c *BongaCamsChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *BongaCamsChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *BongaCamsChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *BongaCamsChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater Creates an updater
 func (c *BongaCamsChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -0,0 +1,281 @@
+package checkers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// browserPool keeps a long-lived browser for each client with a bounded number of tabs
+//
+// The browser connects to the sites through a local proxy
+// dialing from the source address of the client.
+type browserPool struct {
+	tabs     int
+	headers  [][2]string
+	mu       sync.Mutex
+	browsers map[*cmdlib.Client]*browser
+	closed   bool
+}
+
+type browserTab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type browser struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	proxy   *sourceProxy
+	headers network.Headers
+	slots   chan struct{}
+	idle    chan browserTab
+}
+
+func newBrowserPool(tabs int, headers [][2]string) *browserPool {
+	return &browserPool{tabs: tabs, headers: headers, browsers: map[*cmdlib.Client]*browser{}}
+}
+
+func (p *browserPool) browser(client *cmdlib.Client) (*browser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, context.Canceled
+	}
+	if b := p.browsers[client]; b != nil {
+		if b.ctx.Err() == nil {
+			return b, nil
+		}
+		cmdlib.Lerr("[%v] browser is dead, starting a new one", client.Addr)
+		delete(p.browsers, client)
+		b.close()
+	}
+	proxy, err := startSourceProxy(client)
+	if err != nil {
+		return nil, err
+	}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ProxyServer(proxy.url()),
+		chromedp.Flag("proxy-bypass-list", "<-loopback>"))
+	headers := network.Headers{}
+	for _, h := range append(p.headers[:len(p.headers):len(p.headers)], client.Headers...) {
+		if strings.EqualFold(h[0], "User-Agent") {
+			opts = append(opts, chromedp.UserAgent(h[1]))
+		} else {
+			headers[http.CanonicalHeaderKey(h[0])] = h[1]
+		}
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(cmdlib.Ldbg))
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		allocCancel()
+		proxy.close()
+		return nil, err
+	}
+	b := &browser{
+		ctx:     ctx,
+		cancel:  func() { cancel(); allocCancel() },
+		proxy:   proxy,
+		headers: headers,
+		slots:   make(chan struct{}, p.tabs),
+		idle:    make(chan browserTab, p.tabs),
+	}
+	p.browsers[client] = b
+	return b, nil
+}
+
+// evict closes the browser of the client so the next run starts a new one
+func (p *browserPool) evict(client *cmdlib.Client, b *browser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.browsers[client] != b {
+		return
+	}
+	cmdlib.Lerr("[%v] browser connection is lost, starting a new one", client.Addr)
+	delete(p.browsers, client)
+	b.close()
+}
+
+// browserLost tells if the error means the connection to the browser or to its tab is lost
+func browserLost(err error) bool {
+	return errors.Is(err, chromedp.ErrChannelClosed) ||
+		errors.Is(err, chromedp.ErrInvalidTarget) ||
+		errors.Is(err, chromedp.ErrInvalidWebsocketMessage)
+}
+
+func newTab(b *browser) (browserTab, error) {
+	ctx, cancel := chromedp.NewContext(b.ctx)
+	if err := chromedp.Run(ctx, network.Enable(), network.SetExtraHTTPHeaders(b.headers)); err != nil {
+		cancel()
+		return browserTab{}, err
+	}
+	return browserTab{ctx: ctx, cancel: cancel}, nil
+}
+
+func (b *browser) close() {
+	b.cancel()
+	b.proxy.close()
+}
+
+// run runs the actions in a tab of the browser bound to the client
+//
+// It waits for a free tab if all the tabs of the browser are busy.
+// The tab is closed on error and reused otherwise,
+// the browser is replaced if the connection to it is lost.
+func (p *browserPool) run(ctx context.Context, client *cmdlib.Client, timeout time.Duration, actions ...chromedp.Action) error {
+	b, err := p.browser(client)
+	if err != nil {
+		return err
+	}
+	select {
+	case b.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-b.slots }()
+	var tab browserTab
+	select {
+	case tab = <-b.idle:
+	default:
+		if tab, err = newTab(b); err != nil {
+			if b.ctx.Err() != nil || browserLost(err) {
+				p.evict(client, b)
+			}
+			return err
+		}
+	}
+	runCtx, cancel := context.WithTimeout(tab.ctx, timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	if err = chromedp.Run(runCtx, actions...); err != nil {
+		tab.cancel()
+		if b.ctx.Err() != nil || browserLost(err) {
+			p.evict(client, b)
+		}
+		return err
+	}
+	b.idle <- tab
+	return nil
+}
+
+// close closes all the browsers
+func (p *browserPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, b := range p.browsers {
+		b.close()
+	}
+	p.browsers = nil
+}
+
+// sourceProxy is a local HTTP proxy making the connections from the source address of a client,
+// the requests and tunnels respect the rate limit of the client and report its health
+type sourceProxy struct {
+	client   *cmdlib.Client
+	listener net.Listener
+	server   *http.Server
+}
+
+func startSourceProxy(client *cmdlib.Client) (*sourceProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &sourceProxy{client: client, listener: listener}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = p.server.Serve(listener) }()
+	return p, nil
+}
+
+func (p *sourceProxy) url() string { return "http://" + p.listener.Addr().String() }
+
+func (p *sourceProxy) close() { _ = p.server.Close() }
+
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func (p *sourceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.RequestURI = ""
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer cmdlib.CloseBody(resp.Body)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *sourceProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	if err := p.client.Limiter.Wait(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	upstream, err := p.client.Dial(r.Context(), r.Host)
+	if err != nil {
+		if r.Context().Err() == nil {
+			p.client.ReportFailure()
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "hijacking is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		_ = upstream.Close()
+		return
+	}
+	go func() {
+		_, _ = io.Copy(upstream, buffered)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+	_ = conn.Close()
+}
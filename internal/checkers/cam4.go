@@ -2,6 +2,7 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,6 +17,15 @@ type Cam4Checker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &Cam4Checker{}
 
+func init() {
+	Register(Site{
+		Name:             "cam4",
+		NewChecker:       func() cmdlib.Checker { return &Cam4Checker{} },
+		CanonicalModelID: Cam4CanonicalModelID,
+		ModelIDRegexp:    Cam4ModelIDRegexp,
+	})
+}
+
 // Cam4ModelIDRegexp is a regular expression to check model IDs
 var Cam4ModelIDRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
 
@@ -41,21 +51,21 @@ type cam4Response struct {
 }
 
 // CheckStatusSingle checks CAM4 model status
-func (c *Cam4Checker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
+func (c *Cam4Checker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
 	url := fmt.Sprintf("https://api.pinklabel.com/api/v1/cams/profile/%s.json", modelID)
-	addr, resp := c.DoGetRequest(url)
+	addr, resp := c.DoGetRequest(ctx, url)
 	if resp == nil {
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode == 404 {
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
 	buf := bytes.Buffer{}
 	_, err := buf.ReadFrom(resp.Body)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot read response for model %s, %v", addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	parsed := &cam4Response{}
@@ -65,9 +75,9 @@ func (c *Cam4Checker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
-	return cam4RoomStatus(parsed.Status)
+	return cam4RoomStatus(parsed.Status), cmdlib.StreamInfo{}
 }
 
 func cam4RoomStatus(roomStatus string) cmdlib.StatusKind {
@@ -82,41 +92,42 @@ func cam4RoomStatus(roomStatus string) cmdlib.StatusKind {
 }
 
 // CheckEndpoint returns CAM4 online models on the endpoint
-func (c *Cam4Checker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *Cam4Checker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	info = map[string]cmdlib.StreamInfo{}
+	resp, err := cmdlib.OnlineStreamQuery(ctx, endpoint, client, c.Headers, c.MaxResponseBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
+	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
-	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
-	var parsed []cam4Model
-	err = decoder.Decode(&parsed)
-	if err != nil {
-		if c.Dbg {
-			cmdlib.Ldbg("response: %s", buf.String())
+	decoder := json.NewDecoder(resp.Body)
+	err = cmdlib.DecodeJSONArray(decoder, nil, func() error {
+		var m cam4Model
+		if err := decoder.Decode(&m); err != nil {
+			return err
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
-	}
-	for _, m := range parsed {
 		modelID := strings.ToLower(m.Nickname)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ThumbBig
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.ThumbBig}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, cmdlib.ParseError(err)
 	}
 	return
 }
 
 // CheckStatusesMany returns CAM4 online models
-func (c *Cam4Checker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *Cam4Checker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *Cam4Checker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *Cam4Checker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *Cam4Checker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -2,6 +2,7 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +16,13 @@ type CamSodaChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &CamSodaChecker{}
 
+func init() {
+	Register(Site{
+		Name:       "camsoda",
+		NewChecker: func() cmdlib.Checker { return &CamSodaChecker{} },
+	})
+}
+
 type camSodaOnlineResponse struct {
 	Status  bool
 	Error   string
@@ -26,28 +34,28 @@ type camSodaOnlineResponse struct {
 }
 
 // CheckStatusSingle checks CamSoda model status
-func (c *CamSodaChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
-	code := c.QueryStatusCode(fmt.Sprintf("https://www.camsoda.com/%s", modelID))
+func (c *CamSodaChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	code := c.QueryStatusCode(ctx, fmt.Sprintf("https://www.camsoda.com/%s", modelID))
 	switch code {
 	case 200:
-		return cmdlib.StatusOnline | cmdlib.StatusOffline
+		return cmdlib.StatusOnline | cmdlib.StatusOffline, cmdlib.StreamInfo{}
 	case 404:
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
-	return cmdlib.StatusUnknown
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 }
 
 // CheckEndpoint returns CamSoda online models on the endpoint
-func (c *CamSodaChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *CamSodaChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	info = map[string]cmdlib.StreamInfo{}
+	resp, buf, err := cmdlib.OnlineQuery(ctx, endpoint, client, c.Headers)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	var parsed camSodaOnlineResponse
@@ -56,7 +64,7 @@ func (c *CamSodaChecker) CheckEndpoint(endpoint string) (onlineModels map[string
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
+		return nil, nil, cmdlib.ParseError(err)
 	}
 	if !parsed.Status {
 		return nil, nil, fmt.Errorf("API error, %s", parsed.Error)
@@ -64,18 +72,18 @@ func (c *CamSodaChecker) CheckEndpoint(endpoint string) (onlineModels map[string
 	for _, m := range parsed.Results {
 		modelID := strings.ToLower(m.Username)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.Thumb
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.Thumb}
 	}
 	return
 }
 
 // CheckStatusesMany returns CamSoda online models
-func (c *CamSodaChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *CamSodaChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *CamSodaChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *CamSodaChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *CamSodaChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -2,6 +2,7 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,6 +17,14 @@ type ChaturbateChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &ChaturbateChecker{}
 
+func init() {
+	Register(Site{
+		Name:             "chaturbate",
+		NewChecker:       func() cmdlib.Checker { return &ChaturbateChecker{} },
+		CanonicalModelID: ChaturbateCanonicalModelID,
+	})
+}
+
 var chaturbateModelRegex = regexp.MustCompile(`^(?:https?://)?(?:[A-Za-z]+\.)?chaturbate\.com(?:/p|/b)?/([A-Za-z0-9\-_@]+)/?(?:\?.*)?$`)
 
 // ChaturbateCanonicalModelID preprocesses model ID string to canonical for Chaturbate form
@@ -28,8 +37,12 @@ func ChaturbateCanonicalModelID(name string) string {
 }
 
 type chaturbateModel struct {
-	Username string `json:"username"`
-	ImageURL string `json:"image_url"`
+	Username    string   `json:"username"`
+	ImageURL    string   `json:"image_url"`
+	CurrentShow string   `json:"current_show"`
+	RoomSubject string   `json:"room_subject"`
+	NumUsers    int      `json:"num_users"`
+	Tags        []string `json:"tags"`
 }
 
 type chaturbateResponse struct {
@@ -39,20 +52,20 @@ type chaturbateResponse struct {
 }
 
 // CheckStatusSingle checks Chaturbate model status
-func (c *ChaturbateChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
-	addr, resp := c.DoGetRequest(fmt.Sprintf("https://chaturbate.com/api/biocontext/%s/?", modelID))
+func (c *ChaturbateChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	addr, resp := c.DoGetRequest(ctx, fmt.Sprintf("https://chaturbate.com/api/biocontext/%s/?", modelID))
 	if resp == nil {
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode == 404 {
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
 	buf := bytes.Buffer{}
 	_, err := buf.ReadFrom(resp.Body)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot read response for model %s, %v", addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	parsed := &chaturbateResponse{}
@@ -62,12 +75,12 @@ func (c *ChaturbateChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	if parsed.Status != nil {
-		return chaturbateStatus(parsed.Code)
+		return chaturbateStatus(parsed.Code), cmdlib.StreamInfo{}
 	}
-	return chaturbateRoomStatus(parsed.RoomStatus)
+	return chaturbateRoomStatus(parsed.RoomStatus), cmdlib.StreamInfo{SubState: chaturbateSubState(parsed.RoomStatus)}
 }
 
 func chaturbateStatus(status string) cmdlib.StatusKind {
@@ -103,42 +116,69 @@ func chaturbateRoomStatus(roomStatus string) cmdlib.StatusKind {
 	return cmdlib.StatusUnknown
 }
 
+func chaturbateSubState(roomStatus string) cmdlib.SubState {
+	switch roomStatus {
+	case "public":
+		return cmdlib.SubStatePublic
+	case "private":
+		return cmdlib.SubStatePrivate
+	case "group":
+		return cmdlib.SubStateGroup
+	case "hidden":
+		return cmdlib.SubStateHidden
+	case "password protected":
+		return cmdlib.SubStatePassword
+	}
+	return cmdlib.SubStateUnknown
+}
+
+func chaturbateStreamInfo(m chaturbateModel) cmdlib.StreamInfo {
+	return cmdlib.StreamInfo{
+		ImageURL: m.ImageURL,
+		SubState: chaturbateSubState(m.CurrentShow),
+		Title:    m.RoomSubject,
+		Viewers:  m.NumUsers,
+		Tags:     m.Tags,
+	}
+}
+
 // CheckEndpoint returns Chaturbate online models on the endpoint
-func (c *ChaturbateChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *ChaturbateChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	info = map[string]cmdlib.StreamInfo{}
+	resp, err := cmdlib.OnlineStreamQuery(ctx, endpoint, client, c.Headers, c.MaxResponseBytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
+	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
-	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
-	var parsed []chaturbateModel
-	err = decoder.Decode(&parsed)
-	if err != nil {
-		if c.Dbg {
-			cmdlib.Ldbg("response: %s", buf.String())
+	decoder := json.NewDecoder(resp.Body)
+	err = cmdlib.DecodeJSONArray(decoder, nil, func() error {
+		var m chaturbateModel
+		if err := decoder.Decode(&m); err != nil {
+			return err
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
-	}
-	for _, m := range parsed {
 		modelID := strings.ToLower(m.Username)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ImageURL
+		info[modelID] = chaturbateStreamInfo(m)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, cmdlib.ParseError(err)
 	}
 	return
 }
 
 // CheckStatusesMany returns Chaturbate online models
-func (c *ChaturbateChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *ChaturbateChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *ChaturbateChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *ChaturbateChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater Creates an updater
 func (c *ChaturbateChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -0,0 +1,437 @@
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bcmk/siren/internal/fakesite"
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func fakeSiteChecker(server *fakesite.Server, checker cmdlib.Checker, endpoints []string, config cmdlib.CheckerConfig) {
+	config.Clients = []*cmdlib.Client{server.Client()}
+	config.UsersOnlineEndpoints = endpoints
+	config.QueueSize = 100
+	checker.Init(checker, config)
+}
+
+func onlineSet(models map[string]cmdlib.StatusKind) map[string]bool {
+	result := map[string]bool{}
+	for k := range models {
+		result[k] = true
+	}
+	return result
+}
+
+func updatesSet(updates []cmdlib.StatusUpdate) map[string]cmdlib.StatusKind {
+	result := map[string]cmdlib.StatusKind{}
+	for _, u := range updates {
+		result[u.ModelID] = u.Status
+	}
+	return result
+}
+
+func TestFakeSiteEndpoints(t *testing.T) {
+	stripchatRepeatDelay = 0
+	server := fakesite.New()
+	defer server.Close()
+
+	sites := []struct {
+		site     string
+		checker  cmdlib.Checker
+		endpoint string
+		config   map[string]string
+	}{
+		{fakesite.Chaturbate, &ChaturbateChecker{}, "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=x", nil},
+		{fakesite.BongaCams, &BongaCamsChecker{}, "https://tools.bongacams.com/promo.php?c=1&type=api&api_type=json", nil},
+		{fakesite.Stripchat, &StripchatChecker{}, "https://stripchat.com/api/external/v4/widget/?userId=1", nil},
+		{fakesite.Streamate, &StreamateChecker{}, "http://affiliate.streamate.com/SMLive/SMLResult.xml", nil},
+		{fakesite.Twitch, &TwitchChecker{}, "", map[string]string{"client_id": "id", "client_secret": "secret"}},
+	}
+	for _, s := range sites {
+		t.Run(s.site, func(t *testing.T) {
+			server.SetOnline(s.site, "alice", cmdlib.StreamInfo{ImageURL: "https://img/alice.jpg", Title: "hello", Viewers: 10})
+			server.SetOnline(s.site, "bob", cmdlib.StreamInfo{ImageURL: "https://img/bob.jpg"})
+			server.SetOffline(s.site, "carol")
+			fakeSiteChecker(server, s.checker, []string{s.endpoint}, cmdlib.CheckerConfig{SpecificConfig: s.config})
+			online, info, err := s.checker.(endpointChecker).CheckEndpoint(context.Background(), s.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := map[string]bool{"alice": true, "bob": true}
+			if !reflect.DeepEqual(onlineSet(online), expected) {
+				t.Errorf("wrong online models, expected: %v, got: %v", expected, online)
+			}
+			if info["alice"].ImageURL != "https://img/alice.jpg" {
+				t.Errorf("wrong image, got: %q", info["alice"].ImageURL)
+			}
+		})
+	}
+}
+
+func TestFakeSiteCoverage(t *testing.T) {
+	stripchatRepeatDelay = 0
+	server := fakesite.New()
+	defer server.Close()
+	for i := 0; i < 1000; i++ {
+		server.SetOnline(fakesite.Stripchat, fmt.Sprintf("model%04d", i), cmdlib.StreamInfo{})
+		server.SetOnline(fakesite.Streamate, fmt.Sprintf("model%04d", i), cmdlib.StreamInfo{})
+	}
+	for i := 0; i < 150; i++ {
+		server.SetOnline(fakesite.Twitch, fmt.Sprintf("model%04d", i), cmdlib.StreamInfo{})
+	}
+	sites := []struct {
+		site     string
+		checker  cmdlib.CoverageChecker
+		endpoint string
+		config   map[string]string
+		expected cmdlib.Coverage
+	}{
+		{fakesite.Stripchat, &StripchatChecker{}, "https://stripchat.com/api/external/v4/widget/", nil, cmdlib.Coverage{Collected: 1000, Total: 1000, Pages: 18}},
+		{fakesite.Streamate, &StreamateChecker{}, "http://affiliate.streamate.com/SMLive/SMLResult.xml", nil, cmdlib.Coverage{Collected: 1000, Total: 1000, Pages: 3}},
+		{fakesite.Twitch, &TwitchChecker{}, "", map[string]string{"client_id": "id", "client_secret": "secret"}, cmdlib.Coverage{Collected: 150, Pages: 3}},
+	}
+	for _, s := range sites {
+		t.Run(s.site, func(t *testing.T) {
+			fakeSiteChecker(server, s.checker.(cmdlib.Checker), []string{s.endpoint}, cmdlib.CheckerConfig{SpecificConfig: s.config})
+			_, _, coverage, err := s.checker.CheckEndpointCoverage(context.Background(), s.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if coverage != s.expected {
+				t.Errorf("wrong coverage, expected: %v, got: %v", s.expected, coverage)
+			}
+		})
+	}
+}
+
+func TestFakeSiteStatusSingle(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+
+	sites := []struct {
+		site    string
+		checker cmdlib.Checker
+		config  map[string]string
+	}{
+		{fakesite.Chaturbate, &ChaturbateChecker{}, nil},
+		{fakesite.BongaCams, &BongaCamsChecker{}, nil},
+		{fakesite.Stripchat, &StripchatChecker{}, map[string]string{"single_check": "api"}},
+		{fakesite.Streamate, &StreamateChecker{}, nil},
+		{fakesite.Twitch, &TwitchChecker{}, map[string]string{"client_id": "id", "client_secret": "secret"}},
+	}
+	for _, s := range sites {
+		t.Run(s.site, func(t *testing.T) {
+			server.SetOnline(s.site, "alice", cmdlib.StreamInfo{})
+			server.SetOffline(s.site, "bob")
+			fakeSiteChecker(server, s.checker, nil, cmdlib.CheckerConfig{SpecificConfig: s.config})
+			expected := map[string]cmdlib.StatusKind{
+				"alice":   cmdlib.StatusOnline,
+				"bob":     cmdlib.StatusOffline,
+				"nothere": cmdlib.StatusNotFound,
+			}
+			for modelID, status := range expected {
+				if got, _ := s.checker.CheckStatusSingle(context.Background(), modelID); got != status {
+					t.Errorf("wrong status for %s, expected: %v, got: %v", modelID, status, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeSiteTwitchToken(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOnline(fakesite.Twitch, "alice", cmdlib.StreamInfo{})
+	checker := &TwitchChecker{}
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{"client_id": "id", "client_secret": "secret"},
+	})
+	ctx := context.Background()
+	check := func() {
+		if status, _ := checker.CheckStatusSingle(ctx, "alice"); status != cmdlib.StatusOnline {
+			t.Errorf("wrong status, got: %v", status)
+		}
+		online, _, err := checker.CheckStatusesMany(ctx, cmdlib.QueryModelList{List: []string{"alice"}}, cmdlib.CheckOnline)
+		if err != nil || online["alice"] != cmdlib.StatusOnline {
+			t.Errorf("wrong statuses, got: %v %v", online, err)
+		}
+		if _, _, err := checker.CheckEndpoint(ctx, ""); err != nil {
+			t.Error(err)
+		}
+	}
+
+	check()
+	check()
+	if issued := server.TwitchTokensIssued(); issued != 1 {
+		t.Errorf("the token is not cached, issued: %d", issued)
+	}
+
+	server.ExpireTwitchTokens()
+	check()
+	if issued := server.TwitchTokensIssued(); issued != 2 {
+		t.Errorf("the token is not refreshed once, issued: %d", issued)
+	}
+}
+
+// webhookClient returns a client delivering the messages for the default HTTPS port to the webhook,
+// Twitch accepts the callbacks on this port only
+func webhookClient(webhook *httptest.Server) *http.Client {
+	client := webhook.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, webhook.Listener.Addr().String())
+	}
+	client.Transport = transport
+	return client
+}
+
+func TestFakeSiteTwitchEventSub(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOffline(fakesite.Twitch, "alice")
+	server.SetOffline(fakesite.Twitch, "bob")
+	checker := &TwitchChecker{}
+	webhook := httptest.NewTLSServer(http.HandlerFunc(checker.serveEventSub))
+	defer webhook.Close()
+	server.SetTwitchWebhookClient(webhookClient(webhook))
+	eventsCh := make(chan cmdlib.StatusUpdateResults, 10)
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{
+			"client_id":         "id",
+			"client_secret":     "secret",
+			"eventsub_callback": "https://example.com/eventsub",
+			"eventsub_secret":   "secret1234",
+		},
+		EventsCallback: func(res cmdlib.StatusUpdateResults) { eventsCh <- res },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	resultsCh := make(chan cmdlib.StatusUpdateResults)
+	callback := func(res cmdlib.StatusUpdateResults) { resultsCh <- res }
+	poll := func(subscriptions ...string) map[string]cmdlib.StatusKind {
+		t.Helper()
+		subs := map[string]cmdlib.StatusKind{}
+		for _, s := range subscriptions {
+			subs[s] = cmdlib.StatusOffline
+		}
+		err := checker.Updater().PushUpdateRequest(cmdlib.StatusUpdateRequest{Callback: callback, Subscriptions: subs})
+		if err != nil {
+			t.Fatalf("cannot query updates, %v", err)
+		}
+		res := <-resultsCh
+		if res.Data == nil {
+			t.Fatal("no updates")
+		}
+		return updatesSet(res.Data.Updates)
+	}
+	event := func() map[string]cmdlib.StatusKind {
+		t.Helper()
+		select {
+		case res := <-eventsCh:
+			return updatesSet(res.Data.Updates)
+		default:
+			t.Fatal("no events")
+			return nil
+		}
+	}
+
+	poll("alice", "bob")
+	if subs := server.TwitchSubscriptions(); subs != 4 {
+		t.Errorf("wrong number of subscriptions, got: %d", subs)
+	}
+
+	server.SetOnline(fakesite.Twitch, "alice", cmdlib.StreamInfo{})
+	expected := map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline}
+	if got := event(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong events, expected: %v, got: %v", expected, got)
+	}
+	if got := poll("alice", "bob"); len(got) != 0 {
+		t.Errorf("the poll repeats the events, got: %v", got)
+	}
+
+	server.SetOffline(fakesite.Twitch, "alice")
+	expected = map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOffline}
+	if got := event(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong events, expected: %v, got: %v", expected, got)
+	}
+
+	poll("alice")
+	if subs := server.TwitchSubscriptions(); subs != 2 {
+		t.Errorf("the subscriptions are not removed, got: %d", subs)
+	}
+
+	server.RevokeTwitchSubscriptions()
+	poll("alice")
+	if subs := server.TwitchSubscriptions(); subs != 2 {
+		t.Errorf("the subscriptions are not restored, got: %d", subs)
+	}
+}
+
+func TestFakeSiteTwitchRename(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOffline(fakesite.Twitch, "alice")
+	server.SetOffline(fakesite.Twitch, "bob")
+	checker := &TwitchChecker{}
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{"client_id": "id", "client_secret": "secret"},
+	})
+	ctx := context.Background()
+
+	statuses, userIDs, renames, err := checker.CheckIdentities(ctx, []string{"alice", "bob"})
+	if err != nil || statuses["alice"] != cmdlib.StatusOnline|cmdlib.StatusOffline || len(renames) != 0 {
+		t.Errorf("wrong identities, got: %v %v %v", statuses, renames, err)
+	}
+	aliceID, bobID := userIDs["alice"], userIDs["bob"]
+	if aliceID == "" || bobID == "" || aliceID == bobID {
+		t.Errorf("wrong user IDs, got: %v", userIDs)
+	}
+
+	server.Rename(fakesite.Twitch, "alice", "alicia")
+	statuses, userIDs, renames, err = checker.CheckIdentities(ctx, []string{"alice", "bob"})
+	if err != nil || !reflect.DeepEqual(renames, map[string]string{"alice": "alicia"}) {
+		t.Errorf("the rename is not detected, got: %v %v", renames, err)
+	}
+	if statuses["alice"] != cmdlib.StatusNotFound || statuses["alicia"] != cmdlib.StatusOnline|cmdlib.StatusOffline || userIDs["alicia"] != aliceID {
+		t.Errorf("wrong identities, got: %v %v", statuses, userIDs)
+	}
+
+	server.SetOffline(fakesite.Twitch, "alice")
+	server.Rename(fakesite.Twitch, "alicia", "alicia2")
+	checker = &TwitchChecker{}
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{"client_id": "id", "client_secret": "secret"},
+		UserIDs:        map[string]string{"alicia": aliceID},
+	})
+	_, userIDs, renames, err = checker.CheckIdentities(ctx, []string{"alicia", "alice"})
+	if err != nil || !reflect.DeepEqual(renames, map[string]string{"alicia": "alicia2"}) {
+		t.Errorf("the rename is not detected with stored user IDs, got: %v %v", renames, err)
+	}
+	if userIDs["alice"] == "" || userIDs["alice"] == aliceID {
+		t.Errorf("the new user of the login is not recorded, got: %v", userIDs)
+	}
+
+	server.Rename(fakesite.Twitch, "bob", "robert")
+	server.SetOffline(fakesite.Twitch, "bob")
+	checker = &TwitchChecker{}
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{"client_id": "id", "client_secret": "secret"},
+		UserIDs:        map[string]string{"bob": bobID},
+	})
+	_, userIDs, renames, err = checker.CheckIdentities(ctx, []string{"bob"})
+	if err != nil || !reflect.DeepEqual(renames, map[string]string{"bob": "robert"}) || userIDs["robert"] != bobID {
+		t.Errorf("the rename is not detected for a taken login, got: %v %v %v", renames, userIDs, err)
+	}
+}
+
+func TestFakeSiteChaturbateSubState(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOnline(fakesite.Chaturbate, "alice", cmdlib.StreamInfo{SubState: cmdlib.SubStatePrivate})
+	checker := &ChaturbateChecker{}
+	fakeSiteChecker(server, checker, nil, cmdlib.CheckerConfig{})
+	status, info := checker.CheckStatusSingle(context.Background(), "alice")
+	if status != cmdlib.StatusOnline || info.SubState != cmdlib.SubStatePrivate {
+		t.Errorf("wrong status, got: %v %v", status, info.SubState)
+	}
+}
+
+func TestFakeSiteFullUpdater(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOnline(fakesite.Chaturbate, "alice", cmdlib.StreamInfo{})
+	server.SetOnline(fakesite.Chaturbate, "bob", cmdlib.StreamInfo{Title: "hi"})
+	checker := &ChaturbateChecker{}
+	endpoint := "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=x"
+	fakeSiteChecker(server, checker, []string{endpoint}, cmdlib.CheckerConfig{
+		SiteOnlineModels: map[string]bool{"alice": true, "carol": true},
+		SiteSubStates:    map[string]cmdlib.SubState{"alice": cmdlib.SubStatePublic, "carol": cmdlib.SubStatePublic},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	resultsCh := make(chan cmdlib.StatusUpdateResults)
+	callback := func(res cmdlib.StatusUpdateResults) { resultsCh <- res }
+	update := func() *cmdlib.StatusUpdateResultsData {
+		err := checker.Updater().PushUpdateRequest(cmdlib.StatusUpdateRequest{Callback: callback, Subscriptions: map[string]cmdlib.StatusKind{}})
+		if err != nil {
+			t.Fatalf("cannot query updates, %v", err)
+		}
+		res := <-resultsCh
+		if res.Data == nil {
+			t.Fatal("no updates")
+		}
+		return res.Data
+	}
+
+	data := update()
+	expected := map[string]cmdlib.StatusKind{"bob": cmdlib.StatusOnline, "carol": cmdlib.StatusOffline}
+	if got := updatesSet(data.Updates); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong updates, expected: %v, got: %v", expected, got)
+	}
+	if data.Info["bob"].Title != "hi" {
+		t.Errorf("wrong info, got: %v", data.Info["bob"])
+	}
+
+	server.SetOffline(fakesite.Chaturbate, "alice")
+	server.SetOnline(fakesite.Chaturbate, "carol", cmdlib.StreamInfo{})
+	data = update()
+	expected = map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOffline, "carol": cmdlib.StatusOnline}
+	if got := updatesSet(data.Updates); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong updates, expected: %v, got: %v", expected, got)
+	}
+
+	data = update()
+	if len(data.Updates) != 0 {
+		t.Errorf("unexpected updates, %v", data.Updates)
+	}
+}
+
+func TestFakeSiteSelectiveUpdater(t *testing.T) {
+	server := fakesite.New()
+	defer server.Close()
+	server.SetOnline(fakesite.Twitch, "alice", cmdlib.StreamInfo{})
+	server.SetOffline(fakesite.Twitch, "bob")
+	checker := &TwitchChecker{}
+	fakeSiteChecker(server, checker, []string{""}, cmdlib.CheckerConfig{
+		SpecificConfig: map[string]string{"client_id": "id", "client_secret": "secret"},
+		Subscriptions:  map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline, "bob": cmdlib.StatusOnline},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	resultsCh := make(chan cmdlib.StatusUpdateResults)
+	callback := func(res cmdlib.StatusUpdateResults) { resultsCh <- res }
+	subscriptions := map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline, "bob": cmdlib.StatusOnline}
+	update := func() map[string]cmdlib.StatusKind {
+		err := checker.Updater().PushUpdateRequest(cmdlib.StatusUpdateRequest{Callback: callback, Subscriptions: subscriptions})
+		if err != nil {
+			t.Fatalf("cannot query updates, %v", err)
+		}
+		res := <-resultsCh
+		if res.Data == nil {
+			t.Fatal("no updates")
+		}
+		return updatesSet(res.Data.Updates)
+	}
+
+	expected := map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline}
+	if got := update(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong updates, expected: %v, got: %v", expected, got)
+	}
+
+	server.SetOffline(fakesite.Twitch, "alice")
+	server.SetOnline(fakesite.Twitch, "bob", cmdlib.StreamInfo{})
+	expected = map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOffline, "bob": cmdlib.StatusOnline}
+	if got := update(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong updates, expected: %v, got: %v", expected, got)
+	}
+}
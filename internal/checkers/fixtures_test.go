@@ -0,0 +1,246 @@
+package checkers
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+var record = flag.Bool("record", false, "record fixtures from the real websites")
+
+// fixtureChecker initializes a checker replaying the named golden file
+func fixtureChecker(t *testing.T, name string, checker cmdlib.Checker, specificConfig map[string]string) {
+	mode := cmdlib.FixtureReplay
+	if *record {
+		mode = cmdlib.FixtureRecord
+	}
+	transport, err := cmdlib.NewFixtureTransport(filepath.Join("testdata", "fixtures", name+".json"), mode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.Init(checker, cmdlib.CheckerConfig{
+		Clients:        []*cmdlib.Client{cmdlib.NewFixtureClient(transport)},
+		SpecificConfig: specificConfig,
+	})
+	t.Cleanup(func() {
+		if err := transport.Save(); err != nil {
+			t.Error(err)
+		}
+		for _, f := range transport.Unused() {
+			t.Errorf("unused fixture %s %s", f.Method, f.URL)
+		}
+	})
+}
+
+type endpointChecker interface {
+	CheckEndpoint(ctx context.Context, endpoint string) (map[string]cmdlib.StatusKind, map[string]cmdlib.StreamInfo, error)
+}
+
+type singleCase struct {
+	modelID  string
+	status   cmdlib.StatusKind
+	subState cmdlib.SubState
+}
+
+func checkSingle(t *testing.T, checker cmdlib.Checker, cases []singleCase) {
+	for _, c := range cases {
+		status, info := checker.CheckStatusSingle(context.Background(), c.modelID)
+		if status != c.status || info.SubState != c.subState {
+			t.Errorf("unexpected status for %s: %v %v", c.modelID, status, info.SubState)
+		}
+	}
+}
+
+func checkEndpoint(t *testing.T, checker cmdlib.Checker, endpoint string, expected map[string]cmdlib.StreamInfo) {
+	online, info, err := checker.(endpointChecker).CheckEndpoint(context.Background(), endpoint)
+	if err != nil {
+		t.Errorf("unexpected error for %s: %v", endpoint, err)
+		return
+	}
+	if len(online) != len(expected) {
+		t.Errorf("unexpected online models for %s: %v", endpoint, online)
+	}
+	for modelID := range online {
+		if online[modelID] != cmdlib.StatusOnline {
+			t.Errorf("unexpected status for %s: %v", modelID, online[modelID])
+		}
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("unexpected info for %s: %v", endpoint, info)
+	}
+}
+
+func checkEndpointError(t *testing.T, checker cmdlib.Checker, endpoint string) {
+	_, _, err := checker.(endpointChecker).CheckEndpoint(context.Background(), endpoint)
+	if err == nil {
+		t.Errorf("expected an error for %s", endpoint)
+	}
+}
+
+func TestChaturbateFixtures(t *testing.T) {
+	checker := &ChaturbateChecker{}
+	fixtureChecker(t, "chaturbate", checker, nil)
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline, cmdlib.SubStatePublic},
+		{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+		{"dave", cmdlib.StatusDenied, cmdlib.SubStateUnknown},
+		{"eve", cmdlib.StatusUnknown, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=test", map[string]cmdlib.StreamInfo{
+		"alice": {
+			ImageURL: "https://roomimg.stream.highwebmedia.com/ri/alice.jpg",
+			SubState: cmdlib.SubStatePublic,
+			Title:    "hello #music",
+			Viewers:  120,
+			Tags:     []string{"music"},
+		},
+		"frank": {
+			ImageURL: "https://roomimg.stream.highwebmedia.com/ri/frank.jpg",
+			SubState: cmdlib.SubStatePrivate,
+			Viewers:  3,
+			Tags:     []string{},
+		},
+	})
+	checkEndpoint(t, checker, "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=empty", map[string]cmdlib.StreamInfo{})
+	checkEndpointError(t, checker, "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=malformed")
+	checkEndpointError(t, checker, "https://chaturbate.com/affiliates/api/onlinerooms/?format=json&wm=unavailable")
+}
+
+func TestBongaCamsFixtures(t *testing.T) {
+	checker := &BongaCamsChecker{}
+	fixtureChecker(t, "bongacams", checker, nil)
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline, cmdlib.SubStateUnknown},
+		{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://tools.bongacams.com/promo.php?c=1&type=api&api_type=json", map[string]cmdlib.StreamInfo{
+		"alice": {ImageURL: "https://i.bcicdn.com/alice.jpg"},
+		"bob":   {ImageURL: "https://i.bcicdn.com/bob.jpg"},
+	})
+	checkEndpointError(t, checker, "https://tools.bongacams.com/promo.php?c=2&type=api&api_type=json")
+	checkEndpointError(t, checker, "https://tools.bongacams.com/promo.php?c=3&type=api&api_type=json")
+}
+
+func TestCam4Fixtures(t *testing.T) {
+	checker := &Cam4Checker{}
+	fixtureChecker(t, "cam4", checker, nil)
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline, cmdlib.SubStateUnknown},
+		{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+		{"eve", cmdlib.StatusUnknown, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://api.pinklabel.com/api/v1/cams/online.json?gender=female", map[string]cmdlib.StreamInfo{
+		"alice": {ImageURL: "https://snapshots.xcdnpro.com/alice.jpg"},
+		"bob":   {ImageURL: "https://snapshots.xcdnpro.com/bob.jpg"},
+	})
+	checkEndpointError(t, checker, "https://api.pinklabel.com/api/v1/cams/online.json?gender=male")
+}
+
+func TestCamSodaFixtures(t *testing.T) {
+	checker := &CamSodaChecker{}
+	fixtureChecker(t, "camsoda", checker, nil)
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline | cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://www.camsoda.com/api/v1/browse/online_embed?id=test", map[string]cmdlib.StreamInfo{
+		"alice": {ImageURL: "https://md.camsoda.com/thumbs/alice.jpg"},
+		"bob":   {ImageURL: "https://md.camsoda.com/thumbs/bob.jpg"},
+	})
+	checkEndpointError(t, checker, "https://www.camsoda.com/api/v1/browse/online_embed?id=wrong")
+	checkEndpointError(t, checker, "https://www.camsoda.com/api/v1/browse/online_embed?id=malformed")
+}
+
+func TestFlirt4FreeFixtures(t *testing.T) {
+	checker := &Flirt4FreeChecker{}
+	fixtureChecker(t, "flirt4free", checker, nil)
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline, cmdlib.SubStateUnknown},
+		{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+		{"dave", cmdlib.StatusUnknown, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://ws.vs3.com/rooms/online-models.php?key=test", map[string]cmdlib.StreamInfo{
+		"alice_smith":  {ImageURL: "https://cdn.vs3.com/alice.jpg"},
+		"bob_jones":    {ImageURL: "https://cdn.vs3.com/bob.jpg"},
+		"carol_and_co": {ImageURL: "https://cdn.vs3.com/carol.jpg"},
+	})
+	checkEndpointError(t, checker, "https://ws.vs3.com/rooms/online-models.php?key=wrong")
+	checkEndpointError(t, checker, "https://ws.vs3.com/rooms/online-models.php?key=empty")
+}
+
+func TestLiveJasminFixtures(t *testing.T) {
+	checker := &LiveJasminChecker{}
+	fixtureChecker(t, "livejasmin", checker, map[string]string{"ps_id": "ps", "access_key": "key"})
+	checkSingle(t, checker, []singleCase{
+		{"alice", cmdlib.StatusOnline, cmdlib.SubStateUnknown},
+		{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+		{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+		{"dave", cmdlib.StatusDenied, cmdlib.SubStateUnknown},
+	})
+	checkEndpoint(t, checker, "https://pt.potawe.com/api/model/feed?siteId=jasmin&psId=ps&accessKey=key", map[string]cmdlib.StreamInfo{
+		"alice": {ImageURL: "https://galleryn.potawe.com/alice.jpg"},
+		"bob":   {ImageURL: "https://galleryn.potawe.com/bob.jpg"},
+	})
+	checkEndpointError(t, checker, "https://pt.potawe.com/api/model/feed?siteId=jasmin&psId=ps&accessKey=wrong")
+}
+
+func TestStreamateFixtures(t *testing.T) {
+	t.Run("status", func(t *testing.T) {
+		checker := &StreamateChecker{}
+		fixtureChecker(t, "streamate_status", checker, nil)
+		checkSingle(t, checker, []singleCase{
+			{"alice", cmdlib.StatusOnline, cmdlib.SubStateUnknown},
+			{"bob", cmdlib.StatusOffline, cmdlib.SubStateUnknown},
+			{"carol", cmdlib.StatusNotFound, cmdlib.SubStateUnknown},
+		})
+	})
+	t.Run("endpoint", func(t *testing.T) {
+		checker := &StreamateChecker{}
+		fixtureChecker(t, "streamate_endpoint", checker, nil)
+		checkEndpoint(t, checker, "https://affiliate.streamate.com/SMLive/SMLResult.xml", map[string]cmdlib.StreamInfo{
+			"alice": {ImageURL: "https://m1.nsimg.net/biopic/alice.jpg"},
+			"bob":   {},
+			"carol": {ImageURL: "https://m1.nsimg.net/biopic/carol.jpg"},
+		})
+	})
+}
+
+func TestStripchatFixtures(t *testing.T) {
+	delay := stripchatRepeatDelay
+	stripchatRepeatDelay = 0
+	defer func() { stripchatRepeatDelay = delay }()
+	t.Run("pagination", func(t *testing.T) {
+		checker := &StripchatChecker{}
+		fixtureChecker(t, "stripchat", checker, nil)
+		checkEndpoint(t, checker, "https://stripchat.com/api/external/v4/widget/", map[string]cmdlib.StreamInfo{
+			"alice": {
+				ImageURL: "https://img.strpst.com/alice.jpg",
+				SubState: cmdlib.SubStatePublic,
+				Title:    "hi",
+				Viewers:  10,
+				Tags:     []string{"dance"},
+			},
+			"bob": {
+				ImageURL: "https://img.strpst.com/bob.jpg",
+				SubState: cmdlib.SubStatePrivate,
+				Viewers:  2,
+				Tags:     []string{},
+			},
+			"carol": {SubState: cmdlib.SubStateGroup, Tags: []string{}},
+		})
+	})
+	t.Run("errors", func(t *testing.T) {
+		checker := &StripchatChecker{}
+		fixtureChecker(t, "stripchat_errors", checker, nil)
+		checkEndpointError(t, checker, "https://stripchat.com/api/external/v4/widget/?userId=wrong")
+		checkEndpointError(t, checker, "https://stripchat.com/api/external/v4/widget/?userId=malformed")
+	})
+}
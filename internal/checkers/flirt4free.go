@@ -2,8 +2,8 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -16,6 +16,14 @@ type Flirt4FreeChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &Flirt4FreeChecker{}
 
+func init() {
+	Register(Site{
+		Name:             "flirt4free",
+		NewChecker:       func() cmdlib.Checker { return &Flirt4FreeChecker{} },
+		CanonicalModelID: Flirt4FreeCanonicalModelID,
+	})
+}
+
 type flirt4FreeCheckResponse struct {
 	Status string `json:"status"`
 }
@@ -37,20 +45,20 @@ type flirt4FreeOnlineResponse struct {
 }
 
 // CheckStatusSingle checks Flirt4Free model status
-func (c *Flirt4FreeChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
-	addr, resp := c.DoGetRequest(fmt.Sprintf("https://ws.vs3.com/rooms/check-model-status.php?model_name=%s", modelID))
+func (c *Flirt4FreeChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	addr, resp := c.DoGetRequest(ctx, fmt.Sprintf("https://ws.vs3.com/rooms/check-model-status.php?model_name=%s", modelID))
 	if resp == nil {
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	defer cmdlib.CloseBody(resp.Body)
 	if resp.StatusCode != 200 {
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	buf := bytes.Buffer{}
 	_, err := buf.ReadFrom(resp.Body)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot read response for model %s, %v", addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	parsed := &flirt4FreeCheckResponse{}
@@ -60,9 +68,9 @@ func (c *Flirt4FreeChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
-	return flirt4FreeStatus(parsed.Status)
+	return flirt4FreeStatus(parsed.Status), cmdlib.StreamInfo{}
 }
 
 func flirt4FreeStatus(roomStatus string) cmdlib.StatusKind {
@@ -94,16 +102,16 @@ func Flirt4FreeCanonicalModelID(name string) string {
 }
 
 // CheckEndpoint returns Flirt4Free online models
-func (c *Flirt4FreeChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *Flirt4FreeChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	info = map[string]cmdlib.StreamInfo{}
+	resp, buf, err := cmdlib.OnlineQuery(ctx, endpoint, client, c.Headers)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	var parsed flirt4FreeOnlineResponse
@@ -112,39 +120,39 @@ func (c *Flirt4FreeChecker) CheckEndpoint(endpoint string) (onlineModels map[str
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
+		return nil, nil, cmdlib.ParseError(err)
 	}
 	if parsed.Error != nil {
 		return nil, nil, fmt.Errorf("API error, code: %s, description: %s", parsed.Error.Code, parsed.Error.Description)
 	}
 	if len(parsed.Girls) == 0 || len(parsed.Guys) == 0 || len(parsed.Trans) == 0 {
-		return nil, nil, errors.New("zero online models reported")
+		return nil, nil, cmdlib.ErrEmptyResult
 	}
 	for _, m := range parsed.Girls {
 		modelID := flirt4FreeCanonicalAPIModelID(m.Name)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ScreencapImage
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.ScreencapImage}
 	}
 	for _, m := range parsed.Guys {
 		modelID := flirt4FreeCanonicalAPIModelID(m.Name)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ScreencapImage
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.ScreencapImage}
 	}
 	for _, m := range parsed.Trans {
 		modelID := flirt4FreeCanonicalAPIModelID(m.Name)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ScreencapImage
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.ScreencapImage}
 	}
 	return
 }
 
 // CheckStatusesMany returns Flirt4Free online models
-func (c *Flirt4FreeChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *Flirt4FreeChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *Flirt4FreeChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *Flirt4FreeChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *Flirt4FreeChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
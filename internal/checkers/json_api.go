@@ -0,0 +1,252 @@
+package checkers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// JSONAPIChecker implements a checker for an affiliate feed returning a JSON array of online models
+//
+// The feed is described in specific_config:
+//
+//	array_path    a dot separated path to the array of models, the response itself is the array if empty
+//	id_field      a dot separated path to the model ID inside an element, required
+//	image_field   a dot separated path to the image URL inside an element
+//	image_prefix  a prefix added to the image URLs, e.g. "https:"
+//	title_field   a dot separated path to the stream title inside an element
+//	viewers_field a dot separated path to the viewers count inside an element
+//	status_field  a dot separated path to the status inside an element
+//	status_map    comma separated "value:status" pairs, the status is "online", "offline" or a show like "private",
+//	              the elements with unmapped statuses are skipped
+//	model_url     a model page URL with %s in place of the model ID used to check a single model
+type JSONAPIChecker struct {
+	cmdlib.CheckerCommon
+	// config is the feed description parsed on initialization
+	config    *jsonAPIConfig
+	configErr error
+}
+
+var _ cmdlib.Checker = &JSONAPIChecker{}
+
+func init() {
+	Register(Site{
+		Name:                   "json_api",
+		NewChecker:             func() cmdlib.Checker { return &JSONAPIChecker{} },
+		RequiredSpecificConfig: []string{"id_field"},
+		CheckSpecificConfig: func(specificConfig map[string]string) error {
+			_, err := parseJSONAPIConfig(specificConfig)
+			return err
+		},
+	})
+}
+
+type jsonAPIStatus struct {
+	status   cmdlib.StatusKind
+	subState cmdlib.SubState
+}
+
+type jsonAPIConfig struct {
+	arrayPath    []string
+	idField      []string
+	imageField   []string
+	imagePrefix  string
+	titleField   []string
+	viewersField []string
+	statusField  []string
+	statusMap    map[string]jsonAPIStatus
+	modelURL     string
+}
+
+func jsonPath(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
+
+func parseJSONAPIConfig(specificConfig map[string]string) (*jsonAPIConfig, error) {
+	cfg := &jsonAPIConfig{
+		arrayPath:    jsonPath(specificConfig["array_path"]),
+		idField:      jsonPath(specificConfig["id_field"]),
+		imageField:   jsonPath(specificConfig["image_field"]),
+		imagePrefix:  specificConfig["image_prefix"],
+		titleField:   jsonPath(specificConfig["title_field"]),
+		viewersField: jsonPath(specificConfig["viewers_field"]),
+		statusField:  jsonPath(specificConfig["status_field"]),
+		modelURL:     specificConfig["model_url"],
+	}
+	if cfg.idField == nil {
+		return nil, errors.New("id_field is required")
+	}
+	if cfg.modelURL != "" && strings.Count(cfg.modelURL, "%s") != 1 {
+		return nil, errors.New("model_url should contain exactly one %s")
+	}
+	if statusMap := specificConfig["status_map"]; statusMap != "" {
+		if cfg.statusField == nil {
+			return nil, errors.New("status_map requires status_field")
+		}
+		cfg.statusMap = map[string]jsonAPIStatus{}
+		for _, pair := range strings.Split(statusMap, ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("cannot parse status_map entry %q", pair)
+			}
+			status, err := parseJSONAPIStatus(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, err
+			}
+			cfg.statusMap[strings.TrimSpace(parts[0])] = status
+		}
+	} else if cfg.statusField != nil {
+		return nil, errors.New("status_field requires status_map")
+	}
+	return cfg, nil
+}
+
+func parseJSONAPIStatus(s string) (jsonAPIStatus, error) {
+	switch s {
+	case "online":
+		return jsonAPIStatus{status: cmdlib.StatusOnline}, nil
+	case "offline":
+		return jsonAPIStatus{status: cmdlib.StatusOffline}, nil
+	}
+	for subState := cmdlib.SubStatePublic; subState <= cmdlib.SubStatePassword; subState++ {
+		if subState.String() == s {
+			return jsonAPIStatus{status: cmdlib.StatusOnline, subState: subState}, nil
+		}
+	}
+	return jsonAPIStatus{}, fmt.Errorf("unknown status %q in status_map", s)
+}
+
+// jsonField returns the value at the path or nil if there is no such value
+func jsonField(x interface{}, path []string) interface{} {
+	for _, key := range path {
+		object, ok := x.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		x = object[key]
+	}
+	return x
+}
+
+// jsonString returns a string representation of a scalar JSON value
+func jsonString(x interface{}) string {
+	switch v := x.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// parseJSONAPIModels decodes online models from the response element by element
+func parseJSONAPIModels(cfg *jsonAPIConfig, r io.Reader) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	onlineModels = map[string]cmdlib.StatusKind{}
+	info = map[string]cmdlib.StreamInfo{}
+	err = cmdlib.DecodeJSONArray(decoder, cfg.arrayPath, func() error {
+		var m interface{}
+		if err := decoder.Decode(&m); err != nil {
+			return err
+		}
+		if modelID, streamInfo, ok := parseJSONAPIModel(cfg, m); ok {
+			onlineModels[modelID] = cmdlib.StatusOnline
+			info[modelID] = streamInfo
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, cmdlib.ParseError(err)
+	}
+	return
+}
+
+// parseJSONAPIModel extracts an online model from a decoded element
+func parseJSONAPIModel(cfg *jsonAPIConfig, m interface{}) (modelID string, streamInfo cmdlib.StreamInfo, ok bool) {
+	modelID = strings.ToLower(jsonString(jsonField(m, cfg.idField)))
+	if modelID == "" {
+		return "", cmdlib.StreamInfo{}, false
+	}
+	status := jsonAPIStatus{status: cmdlib.StatusOnline}
+	if cfg.statusMap != nil {
+		var found bool
+		status, found = cfg.statusMap[jsonString(jsonField(m, cfg.statusField))]
+		if !found || status.status != cmdlib.StatusOnline {
+			return "", cmdlib.StreamInfo{}, false
+		}
+	}
+	streamInfo = cmdlib.StreamInfo{SubState: status.subState}
+	if cfg.imageField != nil {
+		if image := jsonString(jsonField(m, cfg.imageField)); image != "" {
+			streamInfo.ImageURL = cfg.imagePrefix + image
+		}
+	}
+	if cfg.titleField != nil {
+		streamInfo.Title = jsonString(jsonField(m, cfg.titleField))
+	}
+	if cfg.viewersField != nil {
+		streamInfo.Viewers, _ = strconv.Atoi(jsonString(jsonField(m, cfg.viewersField)))
+	}
+	return modelID, streamInfo, true
+}
+
+// Init initializes the checker parsing the feed description
+func (c *JSONAPIChecker) Init(checker cmdlib.Checker, config cmdlib.CheckerConfig) {
+	c.CheckerCommon.Init(checker, config)
+	c.config, c.configErr = parseJSONAPIConfig(config.SpecificConfig)
+}
+
+// CheckStatusSingle checks a model status by its page if model_url is configured
+func (c *JSONAPIChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	if c.configErr != nil || c.config.modelURL == "" {
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
+	}
+	code := c.QueryStatusCode(ctx, fmt.Sprintf(c.config.modelURL, modelID))
+	switch code {
+	case 200:
+		return cmdlib.StatusOnline | cmdlib.StatusOffline, cmdlib.StreamInfo{}
+	case 404:
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
+	}
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
+}
+
+// CheckEndpoint returns online models on the endpoint
+func (c *JSONAPIChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	if c.configErr != nil {
+		return nil, nil, c.configErr
+	}
+	client := c.ClientsLoop.NextClient()
+	resp, err := cmdlib.OnlineStreamQuery(ctx, endpoint, client, c.Headers, c.MaxResponseBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
+	}
+	defer cmdlib.CloseBody(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
+	}
+	return parseJSONAPIModels(c.config, resp.Body)
+}
+
+// CheckStatusesMany returns online models
+func (c *JSONAPIChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
+}
+
+// Start starts a daemon
+func (c *JSONAPIChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
+
+// CreateUpdater creates an updater
+func (c *JSONAPIChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -0,0 +1,115 @@
+package checkers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func TestJSONAPIArray(t *testing.T) {
+	cfg, err := parseJSONAPIConfig(map[string]string{
+		"id_field":     "username",
+		"image_field":  "profile_images.thumbnail_image_medium_live",
+		"image_prefix": "https:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	online, info, err := parseJSONAPIModels(cfg, strings.NewReader(`[
+		{"username": "Alice", "profile_images": {"thumbnail_image_medium_live": "//example.com/a.jpg"}},
+		{"username": "bob"},
+		{"nickname": "nobody"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOnline := map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline, "bob": cmdlib.StatusOnline}
+	if !reflect.DeepEqual(online, expectedOnline) {
+		t.Errorf("unexpected online models: %v", online)
+	}
+	expectedInfo := map[string]cmdlib.StreamInfo{"alice": {ImageURL: "https://example.com/a.jpg"}, "bob": {}}
+	if !reflect.DeepEqual(info, expectedInfo) {
+		t.Errorf("unexpected info: %v", info)
+	}
+}
+
+func TestJSONAPIStatusMap(t *testing.T) {
+	cfg, err := parseJSONAPIConfig(map[string]string{
+		"array_path":    "results",
+		"id_field":      "username",
+		"title_field":   "subject",
+		"viewers_field": "viewers",
+		"status_field":  "status",
+		"status_map":    "live:online, private:private, offline:offline",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	online, info, err := parseJSONAPIModels(cfg, strings.NewReader(`{"status": true, "results": [
+		{"username": "alice", "status": "live", "subject": "hello", "viewers": 12},
+		{"username": "bob", "status": "private"},
+		{"username": "carol", "status": "offline"},
+		{"username": "dave", "status": "away"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOnline := map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline, "bob": cmdlib.StatusOnline}
+	if !reflect.DeepEqual(online, expectedOnline) {
+		t.Errorf("unexpected online models: %v", online)
+	}
+	expectedInfo := map[string]cmdlib.StreamInfo{
+		"alice": {Title: "hello", Viewers: 12},
+		"bob":   {SubState: cmdlib.SubStatePrivate},
+	}
+	if !reflect.DeepEqual(info, expectedInfo) {
+		t.Errorf("unexpected info: %v", info)
+	}
+	if _, _, err := parseJSONAPIModels(cfg, strings.NewReader(`{"results": {}}`)); err == nil {
+		t.Error("expected an error for a missing array")
+	}
+}
+
+func TestJSONAPIConfig(t *testing.T) {
+	wrong := []map[string]string{
+		{},
+		{"id_field": "username", "status_map": "live:online"},
+		{"id_field": "username", "status_field": "status"},
+		{"id_field": "username", "status_field": "status", "status_map": "live"},
+		{"id_field": "username", "status_field": "status", "status_map": "live:away"},
+		{"id_field": "username", "model_url": "https://example.com/"},
+	}
+	for _, specificConfig := range wrong {
+		if _, err := parseJSONAPIConfig(specificConfig); err == nil {
+			t.Errorf("expected an error for %v", specificConfig)
+		}
+	}
+}
+
+func TestJSONAPIChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"results": [{"username": "Alice"}]}`))
+	}))
+	defer server.Close()
+	checker := &JSONAPIChecker{}
+	checker.Init(checker, cmdlib.CheckerConfig{
+		Clients:        []*cmdlib.Client{{Client: server.Client(), Addr: &net.TCPAddr{}}},
+		SpecificConfig: map[string]string{"array_path": "results", "id_field": "username"},
+	})
+	online, _, err := checker.CheckEndpoint(context.Background(), server.URL)
+	if err != nil || !reflect.DeepEqual(online, map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOnline}) {
+		t.Errorf("unexpected result %v %v", online, err)
+	}
+
+	wrong := &JSONAPIChecker{}
+	wrong.Init(wrong, cmdlib.CheckerConfig{Clients: []*cmdlib.Client{{Client: server.Client(), Addr: &net.TCPAddr{}}}})
+	if _, _, err := wrong.CheckEndpoint(context.Background(), server.URL); err == nil {
+		t.Error("expected an error for a wrong config")
+	}
+}
@@ -2,6 +2,7 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +16,14 @@ type LiveJasminChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &LiveJasminChecker{}
 
+func init() {
+	Register(Site{
+		Name:                   "livejasmin",
+		NewChecker:             func() cmdlib.Checker { return &LiveJasminChecker{} },
+		RequiredSpecificConfig: []string{"ps_id", "access_key"},
+	})
+}
+
 type liveJasminModel struct {
 	PerformerID       string `json:"performerId"`
 	Status            string `json:"status"`
@@ -32,28 +41,28 @@ type liveJasminResponse struct {
 }
 
 // CheckStatusSingle checks LiveJasmin model status
-func (c *LiveJasminChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
+func (c *LiveJasminChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
 	psID := c.SpecificConfig["ps_id"]
 	accessKey := c.SpecificConfig["access_key"]
 	url := fmt.Sprintf("https://pt.potawe.com/api/model/status?performerId=%s&psId=%s&accessKey=%s&legacyRedirect=1", modelID, psID, accessKey)
-	addr, resp := c.DoGetRequest(url)
+	addr, resp := c.DoGetRequest(ctx, url)
 	if resp == nil {
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	defer cmdlib.CloseBody(resp.Body)
 	switch resp.StatusCode {
 	case 401:
-		return cmdlib.StatusDenied
+		return cmdlib.StatusDenied, cmdlib.StreamInfo{}
 	case 404:
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
 	buf := bytes.Buffer{}
 	_, err := buf.ReadFrom(resp.Body)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot read response for model %s, %v", addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
-	return liveJasminStatus(buf.String())
+	return liveJasminStatus(buf.String()), cmdlib.StreamInfo{}
 }
 
 func liveJasminStatus(roomStatus string) cmdlib.StatusKind {
@@ -74,16 +83,16 @@ func liveJasminStatus(roomStatus string) cmdlib.StatusKind {
 }
 
 // CheckEndpoint returns LiveJasmin online models
-func (c *LiveJasminChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *LiveJasminChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	resp, buf, err := cmdlib.OnlineQuery(endpoint, client, c.Headers)
+	info = map[string]cmdlib.StreamInfo{}
+	resp, buf, err := cmdlib.OnlineQuery(ctx, endpoint, client, c.Headers)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+		return nil, nil, fmt.Errorf("cannot send a query, %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+		return nil, nil, cmdlib.HTTPStatusError(resp.StatusCode)
 	}
 	decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	var parsed liveJasminResponse
@@ -92,7 +101,7 @@ func (c *LiveJasminChecker) CheckEndpoint(endpoint string) (onlineModels map[str
 		if c.Dbg {
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return nil, nil, fmt.Errorf("cannot parse response, %v", err)
+		return nil, nil, cmdlib.ParseError(err)
 	}
 	if parsed.Status != "OK" {
 		if c.Dbg {
@@ -103,18 +112,18 @@ func (c *LiveJasminChecker) CheckEndpoint(endpoint string) (onlineModels map[str
 	for _, m := range parsed.Data.Models {
 		modelID := strings.ToLower(m.PerformerID)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = m.ProfilePictureURL.Size896x504
+		info[modelID] = cmdlib.StreamInfo{ImageURL: m.ProfilePictureURL.Size896x504}
 	}
 	return
 }
 
 // CheckStatusesMany returns LiveJasmin online models
-func (c *LiveJasminChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *LiveJasminChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *LiveJasminChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *LiveJasminChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *LiveJasminChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -1,6 +1,7 @@
 package checkers
 
 import (
+	"context"
 	"math/rand"
 	"time"
 
@@ -12,26 +13,34 @@ type RandomChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &RandomChecker{}
 
+func init() {
+	Register(Site{
+		Name:             "test",
+		NewChecker:       func() cmdlib.Checker { return &RandomChecker{} },
+		DefaultEndpoints: []string{""},
+	})
+}
+
 // CheckStatusSingle mimics checker
-func (c *RandomChecker) CheckStatusSingle(_ string) cmdlib.StatusKind {
-	return cmdlib.StatusOnline
+func (c *RandomChecker) CheckStatusSingle(_ context.Context, _ string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	return cmdlib.StatusOnline, cmdlib.StreamInfo{}
 }
 
 // CheckEndpoint returns random online models
-func (c *RandomChecker) CheckEndpoint(_ string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *RandomChecker) CheckEndpoint(_ context.Context, _ string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	now := time.Now()
 	seconds := now.Sub(now.Truncate(time.Minute))
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
+	info = map[string]cmdlib.StreamInfo{}
 	if seconds < time.Second*30 {
 		toggle := "toggle"
 		onlineModels[toggle] = cmdlib.StatusOnline
-		images[toggle] = ""
+		info[toggle] = cmdlib.StreamInfo{ImageURL: ""}
 	}
 	for i := 0; i < 300; i++ {
 		modelID := randString(4)
 		onlineModels[modelID] = cmdlib.StatusOnline
-		images[modelID] = ""
+		info[modelID] = cmdlib.StreamInfo{ImageURL: ""}
 	}
 	return
 }
@@ -48,12 +57,12 @@ func randString(n int) string {
 }
 
 // CheckStatusesMany returns Random online models
-func (c *RandomChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *RandomChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *RandomChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *RandomChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *RandomChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -0,0 +1,77 @@
+package checkers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// Site describes a website supported by a checker
+type Site struct {
+	// Name is the name of the website used in the config
+	Name string
+	// NewChecker returns a new uninitialized checker for the website
+	NewChecker func() cmdlib.Checker
+	// CanonicalModelID preprocesses a model ID given by a user
+	CanonicalModelID func(string) string
+	// ModelIDRegexp checks a canonical model ID
+	ModelIDRegexp *regexp.Regexp
+	// RequiredSpecificConfig lists the keys required in specific_config
+	RequiredSpecificConfig []string
+	// DefaultEndpoints are used if no endpoints are configured
+	DefaultEndpoints []string
+	// CheckSpecificConfig validates specific_config if set
+	CheckSpecificConfig func(map[string]string) error
+}
+
+var registry = map[string]*Site{}
+
+// Register adds a website to the registry
+func Register(site Site) {
+	if _, found := registry[site.Name]; found {
+		panic(fmt.Sprintf("website %s is already registered", site.Name))
+	}
+	if site.CanonicalModelID == nil {
+		site.CanonicalModelID = cmdlib.CanonicalModelID
+	}
+	if site.ModelIDRegexp == nil {
+		site.ModelIDRegexp = cmdlib.ModelIDRegexp
+	}
+	registry[site.Name] = &site
+}
+
+// Lookup returns a registered website by its name
+func Lookup(name string) *Site {
+	return registry[name]
+}
+
+// SpecificConfig returns the keys required in specific_config of a registered website and its validation,
+// it is the lookup validating the bot config
+func SpecificConfig(name string) ([]string, func(map[string]string) error, error) {
+	site := registry[name]
+	if site == nil {
+		return nil, nil, fmt.Errorf("unknown website %q, use one of %s", name, strings.Join(Names(), ", "))
+	}
+	return site.RequiredSpecificConfig, site.CheckSpecificConfig, nil
+}
+
+// Names returns the sorted names of the registered websites
+func Names() []string {
+	var result []string
+	for name := range registry {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Endpoints returns the configured endpoints or the default ones
+func (s *Site) Endpoints(configured []string) []string {
+	if len(configured) != 0 {
+		return configured
+	}
+	return s.DefaultEndpoints
+}
@@ -0,0 +1,45 @@
+package checkers
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	expected := []string{
+		"bongacams",
+		"cam4",
+		"camsoda",
+		"chaturbate",
+		"flirt4free",
+		"json_api",
+		"livejasmin",
+		"streamate",
+		"stripchat",
+		"test",
+		"twitch",
+	}
+	names := Names()
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected websites: %v", names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("unexpected websites: %v", names)
+		}
+		site := Lookup(name)
+		if site.NewChecker() == nil || site.CanonicalModelID == nil || site.ModelIDRegexp == nil {
+			t.Errorf("website %s is not fully registered", name)
+		}
+	}
+	if Lookup("unknown") != nil {
+		t.Error("unexpected website")
+	}
+	twitch := Lookup("twitch")
+	if twitch.CanonicalModelID("@Test") != "test" || !twitch.ModelIDRegexp.MatchString("test") {
+		t.Error("unexpected twitch model ID handling")
+	}
+	if len(Lookup("livejasmin").RequiredSpecificConfig) != 2 {
+		t.Error("unexpected required specific config for livejasmin")
+	}
+	if endpoints := Lookup("chaturbate").Endpoints([]string{"a"}); len(endpoints) != 1 || endpoints[0] != "a" {
+		t.Errorf("unexpected endpoints: %v", endpoints)
+	}
+}
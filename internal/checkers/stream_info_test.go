@@ -0,0 +1,47 @@
+package checkers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func TestChaturbateStreamInfo(t *testing.T) {
+	var m chaturbateModel
+	data := `{"username":"alice","current_show":"public","image_url":"https://example.com/a.jpg",` +
+		`"room_subject":"hello","num_users":42,"tags":["music","chat"]}`
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := cmdlib.StreamInfo{
+		ImageURL: "https://example.com/a.jpg",
+		SubState: cmdlib.SubStatePublic,
+		Title:    "hello",
+		Viewers:  42,
+		Tags:     []string{"music", "chat"},
+	}
+	if info := chaturbateStreamInfo(m); !reflect.DeepEqual(info, expected) {
+		t.Errorf("unexpected stream info: %+v", info)
+	}
+}
+
+func TestStripchatStreamInfo(t *testing.T) {
+	var m stripchatModel
+	data := `{"username":"alice","status":"groupShow","snapshotUrl":"https://example.com/a.jpg",` +
+		`"topic":"hello","viewersCount":7,"tags":["dance"]}`
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := cmdlib.StreamInfo{
+		ImageURL: "https://example.com/a.jpg",
+		SubState: cmdlib.SubStateGroup,
+		Title:    "hello",
+		Viewers:  7,
+		Tags:     []string{"dance"},
+	}
+	if info := stripchatStreamInfo(m); !reflect.DeepEqual(info, expected) {
+		t.Errorf("unexpected stream info: %+v", info)
+	}
+}
@@ -2,6 +2,7 @@ package checkers
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -16,6 +17,14 @@ type StreamateChecker struct{ cmdlib.CheckerCommon }
 
 var _ cmdlib.Checker = &StreamateChecker{}
 
+func init() {
+	Register(Site{
+		Name:             "streamate",
+		NewChecker:       func() cmdlib.Checker { return &StreamateChecker{} },
+		DefaultEndpoints: []string{"http://affiliate.streamate.com/SMLive/SMLResult.xml"},
+	})
+}
+
 type descriptionsRequest struct {
 	XMLName xml.Name `xml:"Descriptions"`
 }
@@ -112,7 +121,7 @@ type streamateResponse struct {
 }
 
 // CheckStatusSingle checks Streamate model status
-func (c *StreamateChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
+func (c *StreamateChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
 	client := c.ClientsLoop.NextClient()
 	reqData := streamateRequest{
 		Options: optionsRequest{MaxResults: 1},
@@ -128,29 +137,29 @@ func (c *StreamateChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
 	output, err := xml.MarshalIndent(&reqData, "", "    ")
 	cmdlib.CheckErr(err)
 	reqString := fmt.Sprintf("%s%s\n", xml.Header, string(output))
-	req, err := http.NewRequest("POST", "https://affiliate.streamate.com/SMLive/SMLResult.xml", strings.NewReader(reqString))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://affiliate.streamate.com/SMLive/SMLResult.xml", strings.NewReader(reqString))
 	cmdlib.CheckErr(err)
 	for _, h := range c.Headers {
 		req.Header.Set(h[0], h[1])
 	}
 	req.Header.Set("Content-Type", "text/xml")
-	resp, err := client.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot send a query, %v", client.Addr, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	defer cmdlib.CloseBody(resp.Body)
 	if c.Dbg {
 		cmdlib.Ldbg("[%v] query status for %s: %d", client.Addr, modelID, resp.StatusCode)
 	}
 	if resp.StatusCode == 404 {
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
 	buf := bytes.Buffer{}
 	_, err = buf.ReadFrom(resp.Body)
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot read response for model %s, %v", client.Addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	decoder := xml.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 	parsed := &streamateResponse{}
@@ -160,25 +169,36 @@ func (c *StreamateChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
 	}
 	if err != nil {
 		cmdlib.Lerr("[%v] cannot parse response for model %s, %v", client.Addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
 	if parsed.AvailablePerformers.ExactMatches != 1 || len(parsed.AvailablePerformers.Performers) != 1 {
-		return cmdlib.StatusNotFound
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}
 	}
 	switch parsed.AvailablePerformers.Performers[0].StreamType {
 	case "live":
-		return cmdlib.StatusOnline
+		return cmdlib.StatusOnline, cmdlib.StreamInfo{}
 	case "recorded", "offline":
-		return cmdlib.StatusOffline
+		return cmdlib.StatusOffline, cmdlib.StreamInfo{}
 	}
-	return cmdlib.StatusUnknown
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 }
 
 // CheckEndpoint returns Streamate online models
-func (c *StreamateChecker) CheckEndpoint(endpoint string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func (c *StreamateChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	onlineModels, info, _, err = c.CheckEndpointCoverage(ctx, endpoint)
+	return
+}
+
+// CheckEndpointCoverage returns Streamate online models and the coverage of the reported total
+func (c *StreamateChecker) CheckEndpointCoverage(ctx context.Context, endpoint string) (
+	onlineModels map[string]cmdlib.StatusKind,
+	info map[string]cmdlib.StreamInfo,
+	coverage cmdlib.Coverage,
+	err error,
+) {
 	client := c.ClientsLoop.NextClient()
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
+	info = map[string]cmdlib.StreamInfo{}
 	// Somehow 500 doesn't work well
 	queriedPageSize := 400
 	pages := 1
@@ -203,7 +223,7 @@ func (c *StreamateChecker) CheckEndpoint(endpoint string) (onlineModels map[stri
 		output, err := xml.MarshalIndent(&reqData, "", "    ")
 		cmdlib.CheckErr(err)
 		reqString := fmt.Sprintf("%s%s\n", xml.Header, string(output))
-		req, err := http.NewRequest("POST", endpoint, strings.NewReader(reqString))
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(reqString))
 		cmdlib.CheckErr(err)
 		for _, h := range c.Headers {
 			req.Header.Set(h[0], h[1])
@@ -211,7 +231,7 @@ func (c *StreamateChecker) CheckEndpoint(endpoint string) (onlineModels map[stri
 		req.Header.Set("Content-Type", "text/xml")
 		_, buf, err := cmdlib.OnlineRequest(req, client)
 		if err != nil {
-			return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+			return nil, nil, cmdlib.Coverage{}, fmt.Errorf("cannot send a query, %w", err)
 		}
 		decoder := xml.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
 		parsed := &streamateResponse{}
@@ -220,8 +240,9 @@ func (c *StreamateChecker) CheckEndpoint(endpoint string) (onlineModels map[stri
 			cmdlib.Ldbg("response: %s", buf.String())
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("[%v] cannot parse response %v", client.Addr, err)
+			return nil, nil, cmdlib.Coverage{}, fmt.Errorf("[%v] %w", client.Addr, cmdlib.ParseError(err))
 		}
+		coverage.Pages++
 		for _, m := range parsed.AvailablePerformers.Performers {
 			image := ""
 			if m.Media != nil && m.Media.Pic != nil && m.Media.Pic.Full != nil {
@@ -229,25 +250,27 @@ func (c *StreamateChecker) CheckEndpoint(endpoint string) (onlineModels map[stri
 			}
 			modelID := strings.ToLower(m.Name)
 			onlineModels[modelID] = cmdlib.StatusOnline
-			images[modelID] = image
+			info[modelID] = cmdlib.StreamInfo{ImageURL: image}
 		}
 		if i == 1 {
+			coverage.Total = parsed.AvailablePerformers.TotalResultCount
 			pages = (parsed.AvailablePerformers.TotalResultCount + queriedPageSize - 1) / queriedPageSize
 			if pages > 20 {
 				pages = 20
 			}
 		}
 	}
+	coverage.Collected = len(onlineModels)
 	return
 }
 
 // CheckStatusesMany returns Streamate online models
-func (c *StreamateChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *StreamateChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *StreamateChecker) Start() { c.StartFullCheckerDaemon(c) }
+func (c *StreamateChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *StreamateChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bcmk/siren/lib/cmdlib"
@@ -17,20 +20,69 @@ import (
 )
 
 // StripchatChecker implements a checker for Stripchat
-type StripchatChecker struct{ cmdlib.CheckerCommon }
+type StripchatChecker struct {
+	cmdlib.CheckerCommon
+	poolOnce sync.Once
+	pool     *browserPool
+}
 
 var _ cmdlib.Checker = &StripchatChecker{}
 
+func init() {
+	Register(Site{
+		Name:       "stripchat",
+		NewChecker: func() cmdlib.Checker { return &StripchatChecker{} },
+		CheckSpecificConfig: func(specificConfig map[string]string) error {
+			switch specificConfig["single_check"] {
+			case "", "browser", "api":
+			default:
+				return fmt.Errorf("unknown single_check %q", specificConfig["single_check"])
+			}
+			if tabs, found := specificConfig["browser_tabs"]; found {
+				if n, err := strconv.Atoi(tabs); err != nil || n <= 0 {
+					return errors.New("browser_tabs should be a positive number")
+				}
+			}
+			return nil
+		},
+	})
+}
+
 type stripchatModel struct {
-	Username    string `json:"username"`
-	SnapshotURL string `json:"snapshotUrl"`
+	Username     string   `json:"username"`
+	SnapshotURL  string   `json:"snapshotUrl"`
+	Status       string   `json:"status"`
+	Topic        string   `json:"topic"`
+	ViewersCount int      `json:"viewersCount"`
+	Tags         []string `json:"tags"`
 }
 
-type stripchatResponse struct {
-	Total  int              `json:"total"`
-	Models []stripchatModel `json:"models"`
+// decodeStripchatModels decodes a page of online models calling model for every its model,
+// it returns the total number of online models
+func decodeStripchatModels(r io.Reader, model func(stripchatModel)) (total int, err error) {
+	decoder := json.NewDecoder(r)
+	err = cmdlib.DecodeJSONObject(decoder, func(key string) error {
+		switch key {
+		case "total":
+			return decoder.Decode(&total)
+		case "models":
+			return cmdlib.DecodeJSONArray(decoder, nil, func() error {
+				var m stripchatModel
+				if err := decoder.Decode(&m); err != nil {
+					return err
+				}
+				model(m)
+				return nil
+			})
+		}
+		return cmdlib.SkipJSONValue(decoder)
+	})
+	return
 }
 
+// stripchatRepeatDelay is a delay between the repeated passes over the list of online models
+var stripchatRepeatDelay = 5 * time.Second
+
 var statusesOffline = map[string]bool{
 	"status-off": true,
 }
@@ -42,20 +94,137 @@ var statusesOnline = map[string]bool{
 	"status-idle":      true,
 }
 
+// stripchatSubState returns a sub-state for a status reported by the API,
+// page status classes are the same statuses prefixed with "status-"
+func stripchatSubState(status string) cmdlib.SubState {
+	switch status {
+	case "public":
+		return cmdlib.SubStatePublic
+	case "private", "p2p":
+		return cmdlib.SubStatePrivate
+	case "groupShow":
+		return cmdlib.SubStateGroup
+	}
+	return cmdlib.SubStateUnknown
+}
+
+func stripchatStreamInfo(m stripchatModel) cmdlib.StreamInfo {
+	return cmdlib.StreamInfo{
+		ImageURL: m.SnapshotURL,
+		SubState: stripchatSubState(m.Status),
+		Title:    m.Topic,
+		Viewers:  m.ViewersCount,
+		Tags:     m.Tags,
+	}
+}
+
+// stripchatPage describes the elements found on a model page
+type stripchatPage struct {
+	video        bool
+	notFound     bool
+	disabled     bool
+	statusClass  string
+	statusExists bool
+}
+
+// parseStripchatPage returns a model status by the elements found on a model page
+func parseStripchatPage(page stripchatPage) (cmdlib.StatusKind, cmdlib.StreamInfo, error) {
+	if page.video {
+		return cmdlib.StatusOnline, cmdlib.StreamInfo{SubState: cmdlib.SubStatePublic}, nil
+	}
+	if page.notFound {
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}, nil
+	}
+	if page.disabled {
+		return cmdlib.StatusDenied, cmdlib.StreamInfo{}, nil
+	}
+	if !page.statusExists {
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, errors.New("no status element found")
+	}
+	classes := strings.Fields(page.statusClass)
+	for _, class := range classes {
+		if statusesOffline[class] {
+			return cmdlib.StatusOffline, cmdlib.StreamInfo{}, nil
+		}
+		if statusesOnline[class] {
+			return cmdlib.StatusOnline, cmdlib.StreamInfo{SubState: stripchatSubState(strings.TrimPrefix(class, "status-"))}, nil
+		}
+	}
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, fmt.Errorf("unknown status classes %v", classes)
+}
+
+type stripchatCamResponse struct {
+	User struct {
+		User struct {
+			Username  string `json:"username"`
+			Status    string `json:"status"`
+			IsDeleted bool   `json:"isDeleted"`
+			IsBlocked bool   `json:"isBlocked"`
+		} `json:"user"`
+	} `json:"user"`
+	Cam struct {
+		Topic string `json:"topic"`
+	} `json:"cam"`
+}
+
+// parseStripchatCam returns a model status by the response of the cam API
+func parseStripchatCam(parsed *stripchatCamResponse) (cmdlib.StatusKind, cmdlib.StreamInfo, error) {
+	user := parsed.User.User
+	switch {
+	case user.IsDeleted:
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}, nil
+	case user.IsBlocked:
+		return cmdlib.StatusDenied, cmdlib.StreamInfo{}, nil
+	case statusesOffline["status-"+user.Status]:
+		return cmdlib.StatusOffline, cmdlib.StreamInfo{}, nil
+	case user.Status == "public" || statusesOnline["status-"+user.Status]:
+		return cmdlib.StatusOnline, cmdlib.StreamInfo{SubState: stripchatSubState(user.Status), Title: parsed.Cam.Topic}, nil
+	}
+	return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, fmt.Errorf("unknown status %q", user.Status)
+}
+
 // CheckStatusSingle checks Stripchat model status
-func (c *StripchatChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
+//
+// The model page is opened in a pooled browser tab bound to the client,
+// the cam API is used if the page cannot tell the status.
+// Setting specific_config single_check to "api" uses the cam API only.
+func (c *StripchatChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
 	client := c.ClientsLoop.NextClient()
-	ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(cmdlib.Ldbg))
-	defer cancel()
+	if err := client.Limiter.Wait(ctx); err != nil {
+		cmdlib.Lerr("[%v] rate limiter error, %v", client.Addr, err)
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
+	}
+	if c.SpecificConfig["single_check"] != "api" {
+		status, info, err := c.checkPage(ctx, client, modelID)
+		if err == nil {
+			return status, info
+		}
+		cmdlib.Lerr("[%v] cannot check a page for model %s, %v", client.Addr, modelID, err)
+	}
+	status, info, err := c.checkCam(ctx, client, modelID)
+	if err != nil {
+		cmdlib.Lerr("[%v] cannot check cam API for model %s, %v", client.Addr, modelID, err)
+	}
+	return status, info
+}
 
-	ctx, cancel = context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
+func (c *StripchatChecker) browsers() *browserPool {
+	c.poolOnce.Do(func() {
+		tabs, err := strconv.Atoi(c.SpecificConfig["browser_tabs"])
+		if err != nil || tabs <= 0 {
+			tabs = 2
+		}
+		c.pool = newBrowserPool(tabs, c.Headers)
+	})
+	return c.pool
+}
 
+func (c *StripchatChecker) checkPage(ctx context.Context, client *cmdlib.Client, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo, error) {
 	var videoNode []*cdp.Node
 	var statusNode []*cdp.Node
 	var disabledNode []*cdp.Node
 	var notFoundNode []*cdp.Node
-	err := chromedp.Run(ctx,
+	err := c.browsers().run(ctx, client, 15*time.Second,
 		chromedp.Navigate(fmt.Sprintf("https://stripchat.com/%s", modelID)),
 		chromedp.WaitVisible(`video, .vc-status, .account-disabled-page, .not-found-error`, chromedp.ByQuery),
 		chromedp.Nodes(`video`, &videoNode, chromedp.AtLeast(0), chromedp.ByQuery),
@@ -64,57 +233,76 @@ func (c *StripchatChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
 		chromedp.Nodes(`.not-found-error`, &notFoundNode, chromedp.AtLeast(0), chromedp.ByQuery),
 	)
 	if err != nil {
-		cmdlib.Lerr("[%v] cannot open a page for model %s, %v", client.Addr, modelID, err)
-		return cmdlib.StatusUnknown
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, err
 	}
-	if len(videoNode) > 0 {
-		if c.Dbg {
-			cmdlib.Ldbg("video found")
-		}
-		return cmdlib.StatusOnline
+	page := stripchatPage{
+		video:        len(videoNode) > 0,
+		notFound:     len(notFoundNode) > 0,
+		disabled:     len(disabledNode) > 0,
+		statusExists: len(statusNode) > 0,
 	}
-	if len(notFoundNode) > 0 {
-		if c.Dbg {
-			cmdlib.Ldbg(".not-found-error found")
-		}
-		return cmdlib.StatusNotFound
+	if page.statusExists {
+		page.statusClass = statusNode[0].AttributeValue("class")
+	}
+	if c.Dbg {
+		cmdlib.Ldbg("page elements for model %s: %+v", modelID, page)
 	}
-	if len(disabledNode) > 0 {
+	return parseStripchatPage(page)
+}
+
+func (c *StripchatChecker) checkCam(ctx context.Context, client *cmdlib.Client, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://stripchat.com/api/front/v2/models/username/%s/cam", modelID), nil)
+	cmdlib.CheckErr(err)
+	for _, h := range c.Headers {
+		req.Header.Set(h[0], h[1])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, fmt.Errorf("cannot send a query, %w", err)
+	}
+	defer cmdlib.CloseBody(resp.Body)
+	if c.Dbg {
+		cmdlib.Ldbg("[%v] query status for %s: %d", client.Addr, modelID, resp.StatusCode)
+	}
+	if resp.StatusCode == 404 {
+		return cmdlib.StatusNotFound, cmdlib.StreamInfo{}, nil
+	}
+	if resp.StatusCode != 200 {
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, cmdlib.HTTPStatusError(resp.StatusCode)
+	}
+	buf := bytes.Buffer{}
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, fmt.Errorf("cannot read response, %v", err)
+	}
+	parsed := &stripchatCamResponse{}
+	if err := json.Unmarshal(buf.Bytes(), parsed); err != nil {
 		if c.Dbg {
-			cmdlib.Ldbg(".account-disabled-page found")
+			cmdlib.Ldbg("response: %s", buf.String())
 		}
-		return cmdlib.StatusDenied
-	}
-	if len(statusNode) > 0 {
-		classes := strings.Split(statusNode[0].AttributeValue("class"), " ")
-		for _, class := range classes {
-			if statusesOffline[class] {
-				if c.Dbg {
-					cmdlib.Ldbg("offline status found")
-				}
-				return cmdlib.StatusOffline
-			}
-			if statusesOnline[class] {
-				if c.Dbg {
-					cmdlib.Ldbg("online status found")
-				}
-				return cmdlib.StatusOnline
-			}
-		}
-		cmdlib.Lerr("[%v] unknown status for model %s, %v", client.Addr, modelID, classes)
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}, cmdlib.ParseError(err)
 	}
-	cmdlib.Lerr("[%v] unknown status for model %s", client.Addr, modelID)
-	return cmdlib.StatusUnknown
+	return parseStripchatCam(parsed)
 }
 
 // CheckEndpoint returns Stripchat online models
-func (c *StripchatChecker) CheckEndpoint(endpoint string) (
+func (c *StripchatChecker) CheckEndpoint(ctx context.Context, endpoint string) (
+	onlineModels map[string]cmdlib.StatusKind,
+	info map[string]cmdlib.StreamInfo,
+	err error,
+) {
+	onlineModels, info, _, err = c.CheckEndpointCoverage(ctx, endpoint)
+	return
+}
+
+// CheckEndpointCoverage returns Stripchat online models and the coverage of the reported total
+func (c *StripchatChecker) CheckEndpointCoverage(ctx context.Context, endpoint string) (
 	onlineModels map[string]cmdlib.StatusKind,
-	images map[string]string,
+	info map[string]cmdlib.StreamInfo,
+	coverage cmdlib.Coverage,
 	err error,
 ) {
 	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
+	info = map[string]cmdlib.StreamInfo{}
 	maxQueries := 80
 	totalModels := 0
 	// This is the actual limit, although the documentation states 1000
@@ -129,7 +317,7 @@ func (c *StripchatChecker) CheckEndpoint(endpoint string) (
 
 			request, err := url.Parse(endpoint)
 			if err != nil {
-				return nil, nil, fmt.Errorf("cannot parse endpoint %q", endpoint)
+				return nil, nil, cmdlib.Coverage{}, fmt.Errorf("cannot parse endpoint %q", endpoint)
 			}
 
 			q := request.Query()
@@ -137,40 +325,40 @@ func (c *StripchatChecker) CheckEndpoint(endpoint string) (
 			q.Set("limit", strconv.Itoa(limitK))
 
 			request.RawQuery = q.Encode()
+			coverage.Pages++
 
-			resp, buf, err := cmdlib.OnlineQuery(request.String(), client, c.Headers)
+			resp, err := cmdlib.OnlineStreamQuery(ctx, request.String(), client, c.Headers, c.MaxResponseBytes)
 			if err != nil {
-				return nil, nil, fmt.Errorf("cannot send a query, %v", err)
+				return nil, nil, cmdlib.Coverage{}, fmt.Errorf("cannot send a query, %w", err)
 			}
 			if resp.StatusCode != 200 {
-				return nil, nil, fmt.Errorf("query status %d", resp.StatusCode)
+				cmdlib.CloseBody(resp.Body)
+				return nil, nil, cmdlib.Coverage{}, cmdlib.HTTPStatusError(resp.StatusCode)
 			}
-			decoder := json.NewDecoder(io.NopCloser(bytes.NewReader(buf.Bytes())))
-			parsed := &stripchatResponse{}
-			err = decoder.Decode(parsed)
-			if err != nil {
-				if c.Dbg {
-					cmdlib.Ldbg("response: %s", buf.String())
+			streams := 0
+			addedOnInnerIteration := 0
+			total, err := decodeStripchatModels(resp.Body, func(m stripchatModel) {
+				streams++
+				if m.Username == "" {
+					return
+				}
+				modelID := strings.ToLower(m.Username)
+				if _, ok := onlineModels[modelID]; !ok {
+					onlineModels[modelID] = cmdlib.StatusOnline
+					addedOnInnerIteration++
+					addedOnOuterIteration++
 				}
-				return nil, nil, fmt.Errorf("cannot parse response, %v", err)
+				info[modelID] = stripchatStreamInfo(m)
+			})
+			cmdlib.CloseBody(resp.Body)
+			if err != nil {
+				return nil, nil, cmdlib.Coverage{}, cmdlib.ParseError(err)
 			}
 			if c.Dbg {
-				cmdlib.Ldbg("streams count in the response: %d", len(parsed.Models))
+				cmdlib.Ldbg("streams count in the response: %d", streams)
 			}
 			if currentQuery == 0 {
-				totalModels = parsed.Total
-			}
-			addedOnInnerIteration := 0
-			for _, m := range parsed.Models {
-				if m.Username != "" {
-					modelID := strings.ToLower(m.Username)
-					if _, ok := onlineModels[modelID]; !ok {
-						onlineModels[modelID] = cmdlib.StatusOnline
-						addedOnInnerIteration++
-						addedOnOuterIteration++
-					}
-					images[modelID] = m.SnapshotURL
-				}
+				totalModels = total
 			}
 			if c.Dbg {
 				cmdlib.Ldbg("added on inner iteration %d: %d", currentQuery+1, addedOnInnerIteration)
@@ -183,23 +371,30 @@ func (c *StripchatChecker) CheckEndpoint(endpoint string) (
 			cmdlib.Ldbg("added on outer iteration %d: %d", repeatCounter+1, addedOnOuterIteration)
 		}
 		if repeatCounter < repeatCounterK-1 {
-			time.Sleep(5 * time.Second)
+			if err := cmdlib.Sleep(ctx, stripchatRepeatDelay); err != nil {
+				return nil, nil, cmdlib.Coverage{}, err
+			}
 		}
 	}
+	coverage.Collected = len(onlineModels)
+	coverage.Total = totalModels
 	return
 }
 
 // CheckStatusesMany returns Stripchat online models
-func (c *StripchatChecker) CheckStatusesMany(cmdlib.QueryModelList, cmdlib.CheckMode) (
+func (c *StripchatChecker) CheckStatusesMany(ctx context.Context, _ cmdlib.QueryModelList, _ cmdlib.CheckMode) (
 	onlineModels map[string]cmdlib.StatusKind,
-	images map[string]string,
+	info map[string]cmdlib.StreamInfo,
 	err error,
 ) {
-	return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+	return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
-// Start starts a daemon
-func (c *StripchatChecker) Start() { c.StartFullCheckerDaemon(c) }
+// Start starts a daemon, the browsers are closed when the context is done
+func (c *StripchatChecker) Start(ctx context.Context) {
+	c.StartFullCheckerDaemon(ctx, c)
+	context.AfterFunc(ctx, func() { c.browsers().close() })
+}
 
 // CreateUpdater creates an updater
 func (c *StripchatChecker) CreateUpdater() cmdlib.Updater { return c.CreateFullUpdater(c) }
@@ -0,0 +1,129 @@
+package checkers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func TestParseStripchatPage(t *testing.T) {
+	cases := []struct {
+		page     stripchatPage
+		status   cmdlib.StatusKind
+		subState cmdlib.SubState
+		err      bool
+	}{
+		{stripchatPage{video: true, statusExists: true, statusClass: "vc-status status-off"}, cmdlib.StatusOnline, cmdlib.SubStatePublic, false},
+		{stripchatPage{notFound: true}, cmdlib.StatusNotFound, cmdlib.SubStateUnknown, false},
+		{stripchatPage{disabled: true}, cmdlib.StatusDenied, cmdlib.SubStateUnknown, false},
+		{stripchatPage{statusExists: true, statusClass: "vc-status status-off"}, cmdlib.StatusOffline, cmdlib.SubStateUnknown, false},
+		{stripchatPage{statusExists: true, statusClass: "vc-status  status-groupShow"}, cmdlib.StatusOnline, cmdlib.SubStateGroup, false},
+		{stripchatPage{statusExists: true, statusClass: "vc-status status-new"}, cmdlib.StatusUnknown, cmdlib.SubStateUnknown, true},
+		{stripchatPage{}, cmdlib.StatusUnknown, cmdlib.SubStateUnknown, true},
+	}
+	for _, c := range cases {
+		status, info, err := parseStripchatPage(c.page)
+		if status != c.status || info.SubState != c.subState || (err != nil) != c.err {
+			t.Errorf("wrong result for %+v, got: %v %v %v", c.page, status, info.SubState, err)
+		}
+	}
+}
+
+func TestDecodeStripchatModels(t *testing.T) {
+	data := `{"models": [{"username": "Alice"}, {"username": "bob", "unknown": [{"x": 1}]}], "filters": {"x": []}, "total": 5}`
+	var names []string
+	total, err := decodeStripchatModels(strings.NewReader(data), func(m stripchatModel) { names = append(names, m.Username) })
+	if err != nil || total != 5 || !reflect.DeepEqual(names, []string{"Alice", "bob"}) {
+		t.Errorf("unexpected result %d %v %v", total, names, err)
+	}
+	_, err = decodeStripchatModels(cmdlib.MaxBytesReader(strings.NewReader(data), 20), func(stripchatModel) {})
+	if !errors.Is(err, cmdlib.ErrResponseTooLarge) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParseStripchatCam(t *testing.T) {
+	cases := []struct {
+		status    string
+		deleted   bool
+		blocked   bool
+		expected  cmdlib.StatusKind
+		subState  cmdlib.SubState
+		withError bool
+	}{
+		{"public", false, false, cmdlib.StatusOnline, cmdlib.SubStatePublic, false},
+		{"p2p", false, false, cmdlib.StatusOnline, cmdlib.SubStatePrivate, false},
+		{"idle", false, false, cmdlib.StatusOnline, cmdlib.SubStateUnknown, false},
+		{"off", false, false, cmdlib.StatusOffline, cmdlib.SubStateUnknown, false},
+		{"off", true, false, cmdlib.StatusNotFound, cmdlib.SubStateUnknown, false},
+		{"off", false, true, cmdlib.StatusDenied, cmdlib.SubStateUnknown, false},
+		{"new", false, false, cmdlib.StatusUnknown, cmdlib.SubStateUnknown, true},
+	}
+	for _, c := range cases {
+		parsed := &stripchatCamResponse{}
+		parsed.User.User.Status = c.status
+		parsed.User.User.IsDeleted = c.deleted
+		parsed.User.User.IsBlocked = c.blocked
+		status, info, err := parseStripchatCam(parsed)
+		if status != c.expected || info.SubState != c.subState || (err != nil) != c.withError {
+			t.Errorf("wrong result for %+v, got: %v %v %v", c, status, info.SubState, err)
+		}
+	}
+}
+
+func TestSourceProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer target.Close()
+	proxy, err := startSourceProxy(cmdlib.HTTPClientWithTimeoutAndAddress(5, "127.0.0.1", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.close()
+
+	proxyURL, err := url.Parse(proxy.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	cmdlib.CloseBody(resp.Body)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("wrong response through the proxy, %q %v", body, err)
+	}
+
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	host := target.Listener.Addr().String()
+	_, _ = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\nGET / HTTP/1.1\r\nHost: %s\r\n\r\n", host, host, host)
+	reader := bufio.NewReader(conn)
+	for _, method := range []string{"CONNECT", "GET"} {
+		resp, err := http.ReadResponse(reader, &http.Request{Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("wrong status for %s, got: %d", method, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package checkers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func TestChaturbateSubState(t *testing.T) {
+	expected := map[string]cmdlib.SubState{
+		"public":             cmdlib.SubStatePublic,
+		"private":            cmdlib.SubStatePrivate,
+		"group":              cmdlib.SubStateGroup,
+		"hidden":             cmdlib.SubStateHidden,
+		"password protected": cmdlib.SubStatePassword,
+		"connecting":         cmdlib.SubStateUnknown,
+	}
+	for roomStatus, subState := range expected {
+		if chaturbateRoomStatus(roomStatus) != cmdlib.StatusOnline {
+			t.Errorf("room status %q is not online", roomStatus)
+		}
+		if chaturbateSubState(roomStatus) != subState {
+			t.Errorf("unexpected sub-state for room status %q: %v", roomStatus, chaturbateSubState(roomStatus))
+		}
+	}
+}
+
+func TestStripchatSubState(t *testing.T) {
+	expected := map[string]cmdlib.SubState{
+		"status-p2p":       cmdlib.SubStatePrivate,
+		"status-private":   cmdlib.SubStatePrivate,
+		"status-groupShow": cmdlib.SubStateGroup,
+		"status-idle":      cmdlib.SubStateUnknown,
+	}
+	for class, subState := range expected {
+		if !statusesOnline[class] {
+			t.Errorf("class %q is not online", class)
+		}
+		if stripchatSubState(strings.TrimPrefix(class, "status-")) != subState {
+			t.Errorf("unexpected sub-state for class %q", class)
+		}
+	}
+	if stripchatSubState("public") != cmdlib.SubStatePublic {
+		t.Error("unexpected sub-state for public status")
+	}
+}
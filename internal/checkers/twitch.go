@@ -1,10 +1,14 @@
 package checkers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bcmk/siren/lib/cmdlib"
 	"github.com/nicklaw5/helix"
@@ -13,9 +17,31 @@ import (
 // TwitchChecker implements a checker for Twitch
 type TwitchChecker struct {
 	cmdlib.CheckerCommon
+	mu         sync.Mutex
+	sessions   map[*cmdlib.Client]*twitchSession
+	eventSubMu sync.Mutex
+	eventSubs  twitchEventSubs
+	idsMu      sync.Mutex
+	userIDs    map[string]string
+	messagesMu sync.Mutex
+	// messages maps the IDs of the processed EventSub messages to the times they are received
+	messages map[string]time.Time
 }
 
-var _ cmdlib.Checker = &TwitchChecker{}
+var _ cmdlib.WebhookChecker = &TwitchChecker{}
+var _ cmdlib.IdentityChecker = &TwitchChecker{}
+
+func init() {
+	Register(Site{
+		Name:                   "twitch",
+		NewChecker:             func() cmdlib.Checker { return &TwitchChecker{} },
+		CanonicalModelID:       TwitchCanonicalModelID,
+		ModelIDRegexp:          TwitchModelIDRegexp,
+		RequiredSpecificConfig: []string{"client_id", "client_secret"},
+		CheckSpecificConfig:    checkTwitchSpecificConfig,
+		DefaultEndpoints:       []string{""},
+	})
+}
 
 // TwitchModelIDRegexp is a regular expression to check model IDs
 var TwitchModelIDRegexp = regexp.MustCompile(`^@?[a-z0-9][a-z0-9\-_]*$`)
@@ -25,81 +51,175 @@ func TwitchCanonicalModelID(name string) string {
 	return strings.ToLower(strings.TrimPrefix(name, "@"))
 }
 
-// CheckStatusSingle checks Twitch channel status
-func (c *TwitchChecker) CheckStatusSingle(modelID string) cmdlib.StatusKind {
-	client := c.ClientsLoop.NextClient()
+// contextHTTPClient performs the requests of the Helix client with the context of the current call
+type contextHTTPClient struct {
+	ctx    context.Context
+	client *cmdlib.Client
+}
+
+func (c *contextHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+// errTwitchUnauthorized is returned when Twitch rejects the access token
+var errTwitchUnauthorized = errors.New("unauthorized")
+
+// twitchSession is a Helix client with a cached app access token bound to an HTTP client,
+// the calls using the same session are serialized
+type twitchSession struct {
+	mu        sync.Mutex
+	http      *contextHTTPClient
+	helix     *helix.Client
+	refreshAt time.Time
+}
+
+// twitchResponseError returns an error reported in a Helix response
+func twitchResponseError(r helix.ResponseCommon) error {
+	if r.StatusCode == http.StatusUnauthorized {
+		return errTwitchUnauthorized
+	}
+	if r.StatusCode >= 400 {
+		return fmt.Errorf("%s, %w", r.ErrorMessage, cmdlib.HTTPStatusError(r.StatusCode))
+	}
+	if r.ErrorMessage != "" {
+		return errors.New(r.ErrorMessage)
+	}
+	return nil
+}
+
+func (c *TwitchChecker) session(client *cmdlib.Client) (*twitchSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.sessions[client]; s != nil {
+		return s, nil
+	}
+	httpClient := &contextHTTPClient{client: client}
 	helixClient, err := helix.NewClient(&helix.Options{
 		ClientID:     c.SpecificConfig["client_id"],
 		ClientSecret: c.SpecificConfig["client_secret"],
-		HTTPClient:   client.Client,
+		HTTPClient:   httpClient,
 	})
 	if err != nil {
-		cmdlib.Lerr("cannot create new twitch client, %v", err)
-		return cmdlib.StatusUnknown
+		return nil, fmt.Errorf("cannot create new twitch client, %v", err)
 	}
-	accessResponse, err := requestAppAccessToken(helixClient)
-	if err != nil {
-		cmdlib.Lerr("%v", err)
-		return cmdlib.StatusUnknown
+	if c.sessions == nil {
+		c.sessions = map[*cmdlib.Client]*twitchSession{}
 	}
+	s := &twitchSession{http: httpClient, helix: helixClient}
+	c.sessions[client] = s
+	return s, nil
+}
 
-	helixClient.SetAppAccessToken(accessResponse.Data.AccessToken)
-
-	streamsResponse, err := helixClient.GetStreams(&helix.StreamsParams{UserLogins: []string{modelID}})
+// refreshToken requests a new app access token,
+// it is refreshed again after 90% of its lifetime
+func (s *twitchSession) refreshToken() error {
+	accessResponse, err := s.helix.RequestAppAccessToken(nil)
 	if err != nil {
-		cmdlib.Lerr("negotiation error on getting streams, %v", err)
-		return cmdlib.StatusUnknown
+		return fmt.Errorf("negotiation error on requesting an access token, %w", err)
 	}
-	if streamsResponse.ErrorMessage != "" {
-		cmdlib.Lerr("Twitch returns the error on getting streams, %s", streamsResponse.ErrorMessage)
-		return cmdlib.StatusUnknown
-	}
-	if len(streamsResponse.Data.Streams) == 1 {
-		return cmdlib.StatusOnline
+	if accessResponse.ErrorMessage != "" {
+		return fmt.Errorf("Twitch returns an error on requesting an access token, %s", accessResponse.ErrorMessage)
 	}
+	s.helix.SetAppAccessToken(accessResponse.Data.AccessToken)
+	lifetime := time.Duration(accessResponse.Data.ExpiresIn) * time.Second
+	s.refreshAt = time.Now().Add(lifetime * 9 / 10)
+	return nil
+}
 
-	chanResponse, err := helixClient.GetUsers(&helix.UsersParams{
-		Logins: []string{modelID},
-	})
+// withHelix calls f with the Helix client of the next HTTP client,
+// the token is requested if it is missing or about to expire,
+// and it is requested again once if Twitch rejects it
+func (c *TwitchChecker) withHelix(ctx context.Context, f func(*helix.Client) error) error {
+	s, err := c.session(c.ClientsLoop.NextClient())
 	if err != nil {
-		cmdlib.Lerr("negotiation error on getting users, %v", err)
-		return cmdlib.StatusUnknown
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.http.ctx = ctx
+	defer func() { s.http.ctx = nil }()
+	if !time.Now().Before(s.refreshAt) {
+		if err := s.refreshToken(); err != nil {
+			return err
+		}
 	}
-	if chanResponse.ErrorMessage != "" {
-		cmdlib.Lerr("Twitch returns the error on getting users, %s", streamsResponse.ErrorMessage)
-		return cmdlib.StatusUnknown
+	err = f(s.helix)
+	if !errors.Is(err, errTwitchUnauthorized) {
+		return err
 	}
-	if len(chanResponse.Data.Users) == 1 {
-		return cmdlib.StatusOffline
+	if c.Dbg {
+		cmdlib.Ldbg("the access token is rejected, requesting a new one")
 	}
-	return cmdlib.StatusNotFound
+	if err := s.refreshToken(); err != nil {
+		return err
+	}
+	return f(s.helix)
 }
 
-// CheckStatusesMany checks Twitch channel status
-func (c *TwitchChecker) CheckStatusesMany(channels cmdlib.QueryModelList, checkMode cmdlib.CheckMode) (results map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	client := c.ClientsLoop.NextClient()
-	helixClient, err := helix.NewClient(&helix.Options{
-		ClientID:     c.SpecificConfig["client_id"],
-		ClientSecret: c.SpecificConfig["client_secret"],
-		HTTPClient:   client.Client,
+// CheckStatusSingle checks Twitch channel status
+func (c *TwitchChecker) CheckStatusSingle(ctx context.Context, modelID string) (cmdlib.StatusKind, cmdlib.StreamInfo) {
+	status := cmdlib.StatusUnknown
+	var info cmdlib.StreamInfo
+	err := c.withHelix(ctx, func(helixClient *helix.Client) error {
+		streamsResponse, err := helixClient.GetStreams(&helix.StreamsParams{UserLogins: []string{modelID}})
+		if err != nil {
+			return fmt.Errorf("negotiation error on getting streams, %v", err)
+		}
+		if err := twitchResponseError(streamsResponse.ResponseCommon); err != nil {
+			return fmt.Errorf("Twitch returns the error on getting streams, %w", err)
+		}
+		if len(streamsResponse.Data.Streams) == 1 {
+			status, info = cmdlib.StatusOnline, twitchStreamInfo(streamsResponse.Data.Streams[0])
+			return nil
+		}
+
+		chanResponse, err := helixClient.GetUsers(&helix.UsersParams{
+			Logins: []string{modelID},
+		})
+		if err != nil {
+			return fmt.Errorf("negotiation error on getting users, %v", err)
+		}
+		if err := twitchResponseError(chanResponse.ResponseCommon); err != nil {
+			return fmt.Errorf("Twitch returns the error on getting users, %w", err)
+		}
+		if len(chanResponse.Data.Users) == 1 {
+			status = cmdlib.StatusOffline
+		} else {
+			status = cmdlib.StatusNotFound
+		}
+		return nil
 	})
 	if err != nil {
-		return nil, nil, err
+		cmdlib.Lerr("%v", err)
+		return cmdlib.StatusUnknown, cmdlib.StreamInfo{}
 	}
-	accessResponse, err := requestAppAccessToken(helixClient)
+	return status, info
+}
+
+// CheckStatusesMany checks Twitch channel status
+func (c *TwitchChecker) CheckStatusesMany(ctx context.Context, channels cmdlib.QueryModelList, checkMode cmdlib.CheckMode) (results map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	if checkMode == cmdlib.CheckOnline && channels.All {
+		return cmdlib.CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
+	}
+	err = c.withHelix(ctx, func(helixClient *helix.Client) error {
+		var err error
+		if checkMode == cmdlib.CheckOnline {
+			results, info, err = c.checkOnlineMany(helixClient, channels.List)
+		} else {
+			results, _, _, err = c.checkExistingMany(helixClient, channels.List)
+		}
+		return err
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-
-	helixClient.SetAppAccessToken(accessResponse.Data.AccessToken)
-
-	if checkMode == cmdlib.CheckOnline && channels.All {
-		return cmdlib.CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
-	} else if checkMode == cmdlib.CheckOnline {
-		return c.checkOnlineMany(helixClient, channels.List)
+	if checkMode == cmdlib.CheckOnline && c.eventSubEnabled() {
+		err := c.withHelix(ctx, func(helixClient *helix.Client) error { return c.syncEventSub(helixClient, channels.List) })
+		if err != nil {
+			cmdlib.Lerr("cannot update EventSub subscriptions, %v", err)
+		}
 	}
-
-	return c.checkExistingMany(helixClient, channels.List)
+	return results, info, nil
 }
 
 func thumbnail(s string) string {
@@ -107,9 +227,18 @@ func thumbnail(s string) string {
 	return strings.Replace(s, "{height}", "720", 1)
 }
 
-func (c *TwitchChecker) checkOnlineMany(client *helix.Client, channels []string) (online map[string]cmdlib.StatusKind, images map[string]string, err error) {
+func twitchStreamInfo(s helix.Stream) cmdlib.StreamInfo {
+	return cmdlib.StreamInfo{
+		ImageURL: thumbnail(s.ThumbnailURL),
+		Title:    s.Title,
+		Viewers:  s.ViewerCount,
+		Game:     s.GameName,
+	}
+}
+
+func (c *TwitchChecker) checkOnlineMany(client *helix.Client, channels []string) (online map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
 	online = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
+	info = map[string]cmdlib.StreamInfo{}
 	for _, chunk := range chunks(channels, 100) {
 		streamsResponse, err := client.GetStreams(&helix.StreamsParams{
 			First:      100,
@@ -118,98 +247,199 @@ func (c *TwitchChecker) checkOnlineMany(client *helix.Client, channels []string)
 		if err != nil {
 			return nil, nil, err
 		}
-		if streamsResponse.ErrorMessage != "" {
-			return nil, nil, errors.New(streamsResponse.ErrorMessage)
+		if err := twitchResponseError(streamsResponse.ResponseCommon); err != nil {
+			return nil, nil, err
 		}
 		for _, s := range streamsResponse.Data.Streams {
 			name := strings.ToLower(s.UserLogin)
 			online[name] = cmdlib.StatusOnline
-			images[name] = thumbnail(s.ThumbnailURL)
+			info[name] = twitchStreamInfo(s)
 		}
 	}
-	return online, images, nil
+	return online, info, nil
 }
 
-func (c *TwitchChecker) checkExistingMany(helixClient *helix.Client, channels []string) (results map[string]cmdlib.StatusKind, images map[string]string, err error) {
+// checkExistingMany checks if the channels exist,
+// the channels not found by their logins are looked up by their known user IDs to detect renames
+func (c *TwitchChecker) checkExistingMany(helixClient *helix.Client, channels []string) (
+	results map[string]cmdlib.StatusKind,
+	userIDs map[string]string,
+	renames map[string]string,
+	err error,
+) {
 	results = map[string]cmdlib.StatusKind{}
+	userIDs = map[string]string{}
+	renames = map[string]string{}
 	for _, c := range channels {
 		results[c] = cmdlib.StatusNotFound
 	}
+	known := c.knownUserIDs()
+	// missing maps the known user IDs of the channels not found by their logins to the logins
+	missing := map[string]string{}
+	// taken maps the logins taken by other users to their user IDs
+	taken := map[string]string{}
 	for _, chunk := range chunks(channels, 100) {
 		chanResponse, err := helixClient.GetUsers(&helix.UsersParams{
 			Logins: chunk,
 		})
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		if chanResponse.ErrorMessage != "" {
-			return nil, nil, errors.New(chanResponse.ErrorMessage)
+		if err := twitchResponseError(chanResponse.ResponseCommon); err != nil {
+			return nil, nil, nil, err
 		}
 		for _, u := range chanResponse.Data.Users {
-			results[u.Login] = cmdlib.StatusOnline | cmdlib.StatusOffline
+			login := strings.ToLower(u.Login)
+			results[login] = cmdlib.StatusOnline | cmdlib.StatusOffline
+			if id := known[login]; id != "" && id != u.ID {
+				taken[login] = u.ID
+				continue
+			}
+			userIDs[login] = u.ID
 		}
 	}
-	return results, images, nil
-}
-
-// CheckEndpoint returns all Twitch online channels
-func (c *TwitchChecker) CheckEndpoint(string) (onlineModels map[string]cmdlib.StatusKind, images map[string]string, err error) {
-	httpClient := c.ClientsLoop.NextClient()
-	onlineModels = map[string]cmdlib.StatusKind{}
-	images = map[string]string{}
-	helixClient, err := helix.NewClient(&helix.Options{
-		ClientID:     c.SpecificConfig["client_id"],
-		ClientSecret: c.SpecificConfig["client_secret"],
-		HTTPClient:   httpClient.Client,
-	})
-	if err != nil {
-		return nil, nil, err
+	for _, c := range channels {
+		if id := known[c]; id != "" && (results[c] == cmdlib.StatusNotFound || taken[c] != "") {
+			missing[id] = c
+		}
 	}
-	accessResponse, err := requestAppAccessToken(helixClient)
-	if err != nil {
-		return nil, nil, err
+	var ids []string
+	for id := range missing {
+		ids = append(ids, id)
 	}
-
-	helixClient.SetAppAccessToken(accessResponse.Data.AccessToken)
-
-	after := ""
-	for {
-		streamsResponse, err := helixClient.GetStreams(&helix.StreamsParams{
-			First: 100,
-			After: after,
+	for _, chunk := range chunks(ids, 100) {
+		chanResponse, err := helixClient.GetUsers(&helix.UsersParams{
+			IDs: chunk,
 		})
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		if streamsResponse.ErrorMessage != "" {
-			return nil, nil, errors.New(streamsResponse.ErrorMessage)
+		if err := twitchResponseError(chanResponse.ResponseCommon); err != nil {
+			return nil, nil, nil, err
 		}
-		for _, s := range streamsResponse.Data.Streams {
-			name := strings.ToLower(s.UserLogin)
-			onlineModels[name] = cmdlib.StatusOnline
-			images[name] = thumbnail(s.ThumbnailURL)
+		for _, u := range chanResponse.Data.Users {
+			login := strings.ToLower(u.Login)
+			if old := missing[u.ID]; old != "" && old != login {
+				renames[old] = login
+				results[login] = cmdlib.StatusOnline | cmdlib.StatusOffline
+				userIDs[login] = u.ID
+			}
 		}
-		if len(streamsResponse.Data.Streams) == 0 {
-			break
+	}
+	for login, id := range taken {
+		if renames[login] == "" {
+			userIDs[login] = id
 		}
-		after = streamsResponse.Data.Pagination.Cursor
 	}
-	return onlineModels, images, nil
+	c.storeUserIDs(userIDs, renames)
+	return results, userIDs, renames, nil
 }
 
-func requestAppAccessToken(helixClient *helix.Client) (*helix.AppAccessTokenResponse, error) {
-	accessResponse, err := helixClient.RequestAppAccessToken(nil)
+// CheckIdentities checks if Twitch channels exist and detects renamed channels
+func (c *TwitchChecker) CheckIdentities(ctx context.Context, modelIDs []string) (
+	statuses map[string]cmdlib.StatusKind,
+	userIDs map[string]string,
+	renames map[string]string,
+	err error,
+) {
+	err = c.withHelix(ctx, func(helixClient *helix.Client) error {
+		var err error
+		statuses, userIDs, renames, err = c.checkExistingMany(helixClient, modelIDs)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("negotiation error on requesting an access token, %w", err)
+		return nil, nil, nil, err
 	}
-	if accessResponse.ErrorMessage != "" {
-		return nil, fmt.Errorf("Twitch returns an error on requesting an access token, %s", accessResponse.ErrorMessage)
+	return statuses, userIDs, renames, nil
+}
+
+// knownUserIDs returns a copy of the known user IDs of the channels
+func (c *TwitchChecker) knownUserIDs() map[string]string {
+	c.idsMu.Lock()
+	defer c.idsMu.Unlock()
+	c.initUserIDs()
+	result := make(map[string]string, len(c.userIDs))
+	for k, v := range c.userIDs {
+		result[k] = v
+	}
+	return result
+}
+
+func (c *TwitchChecker) storeUserIDs(userIDs map[string]string, renames map[string]string) {
+	c.idsMu.Lock()
+	defer c.idsMu.Unlock()
+	c.initUserIDs()
+	for old := range renames {
+		delete(c.userIDs, old)
+	}
+	for k, v := range userIDs {
+		c.userIDs[k] = v
+	}
+}
+
+// initUserIDs copies the stored user IDs on the first use
+func (c *TwitchChecker) initUserIDs() {
+	if c.userIDs != nil {
+		return
+	}
+	c.userIDs = map[string]string{}
+	for k, v := range c.UserIDs {
+		c.userIDs[k] = v
+	}
+}
+
+// CheckEndpoint returns all Twitch online channels
+func (c *TwitchChecker) CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]cmdlib.StatusKind, info map[string]cmdlib.StreamInfo, err error) {
+	onlineModels, info, _, err = c.CheckEndpointCoverage(ctx, endpoint)
+	return
+}
+
+// CheckEndpointCoverage returns all Twitch online channels and the number of pages walked,
+// Twitch does not report the total
+func (c *TwitchChecker) CheckEndpointCoverage(ctx context.Context, _ string) (
+	onlineModels map[string]cmdlib.StatusKind,
+	info map[string]cmdlib.StreamInfo,
+	coverage cmdlib.Coverage,
+	err error,
+) {
+	err = c.withHelix(ctx, func(helixClient *helix.Client) error {
+		onlineModels = map[string]cmdlib.StatusKind{}
+		info = map[string]cmdlib.StreamInfo{}
+		coverage = cmdlib.Coverage{}
+		after := ""
+		for {
+			streamsResponse, err := helixClient.GetStreams(&helix.StreamsParams{
+				First: 100,
+				After: after,
+			})
+			if err != nil {
+				return err
+			}
+			if err := twitchResponseError(streamsResponse.ResponseCommon); err != nil {
+				return err
+			}
+			coverage.Pages++
+			for _, s := range streamsResponse.Data.Streams {
+				name := strings.ToLower(s.UserLogin)
+				onlineModels[name] = cmdlib.StatusOnline
+				info[name] = twitchStreamInfo(s)
+			}
+			if len(streamsResponse.Data.Streams) == 0 {
+				break
+			}
+			after = streamsResponse.Data.Pagination.Cursor
+		}
+		coverage.Collected = len(onlineModels)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, cmdlib.Coverage{}, err
 	}
-	return accessResponse, nil
+	return onlineModels, info, coverage, nil
 }
 
 // Start starts a daemon
-func (c *TwitchChecker) Start() { c.StartSelectiveCheckerDaemon(c) }
+func (c *TwitchChecker) Start(ctx context.Context) { c.StartSelectiveCheckerDaemon(ctx, c) }
 
 // CreateUpdater creates an updater
 func (c *TwitchChecker) CreateUpdater() cmdlib.Updater { return c.CreateSelectiveUpdater(c) }
@@ -0,0 +1,344 @@
+package checkers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+	"github.com/nicklaw5/helix"
+)
+
+// EventSub webhook headers
+const (
+	eventSubMessageID        = "Twitch-Eventsub-Message-Id"
+	eventSubMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	eventSubMessageSignature = "Twitch-Eventsub-Message-Signature"
+	eventSubMessageType      = "Twitch-Eventsub-Message-Type"
+)
+
+// eventSubMaxAge is the maximum age of an accepted EventSub message protecting from replays
+const eventSubMaxAge = 10 * time.Minute
+
+// eventSubMaxBody is the maximum size of an EventSub message
+const eventSubMaxBody = 1 << 20
+
+// eventSubCreateBatch is the maximum number of subscriptions created in a single poll
+const eventSubCreateBatch = 100
+
+// eventSubTypes are the subscription types created for every model
+var eventSubTypes = []string{helix.EventSubTypeStreamOnline, helix.EventSubTypeStreamOffline}
+
+type eventSubMessage struct {
+	Challenge    string `json:"challenge"`
+	Subscription struct {
+		ID        string `json:"id"`
+		Type      string `json:"type"`
+		Status    string `json:"status"`
+		Condition struct {
+			BroadcasterUserID string `json:"broadcaster_user_id"`
+		} `json:"condition"`
+	} `json:"subscription"`
+	Event struct {
+		BroadcasterUserID    string `json:"broadcaster_user_id"`
+		BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	} `json:"event"`
+}
+
+// twitchEventSubs tracks the EventSub subscriptions of the checker
+type twitchEventSubs struct {
+	loaded bool
+	// subs maps user IDs and subscription types to subscription IDs
+	subs map[string]map[string]string
+}
+
+func checkTwitchSpecificConfig(specificConfig map[string]string) error {
+	callback := specificConfig["eventsub_callback"]
+	if callback == "" {
+		return nil
+	}
+	u, err := url.Parse(callback)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("eventsub_callback should be an HTTPS URL")
+	}
+	if port := u.Port(); port != "" && port != "443" {
+		return errors.New("eventsub_callback should use port 443")
+	}
+	if secret := specificConfig["eventsub_secret"]; len(secret) < 10 || len(secret) > 100 {
+		return errors.New("eventsub_secret should be from 10 to 100 characters long")
+	}
+	return nil
+}
+
+// verifyEventSub checks the signature and the age of an EventSub message
+func verifyEventSub(secret string, header http.Header, body []byte, now time.Time) bool {
+	timestamp, err := time.Parse(time.RFC3339Nano, header.Get(eventSubMessageTimestamp))
+	if err != nil || now.Sub(timestamp) > eventSubMaxAge || timestamp.Sub(now) > eventSubMaxAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(header.Get(eventSubMessageID) + header.Get(eventSubMessageTimestamp)))
+	_, _ = mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get(eventSubMessageSignature)))
+}
+
+func (c *TwitchChecker) eventSubEnabled() bool { return c.SpecificConfig["eventsub_callback"] != "" }
+
+// Webhook returns the EventSub webhook if it is configured
+func (c *TwitchChecker) Webhook() (string, http.Handler) {
+	if !c.eventSubEnabled() {
+		return "", nil
+	}
+	u, err := url.Parse(c.SpecificConfig["eventsub_callback"])
+	if err != nil {
+		cmdlib.Lerr("cannot parse EventSub callback, %v", err)
+		return "", nil
+	}
+	return u.Host + u.Path, http.HandlerFunc(c.serveEventSub)
+}
+
+func (c *TwitchChecker) serveEventSub(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, eventSubMaxBody))
+	if err != nil {
+		http.Error(w, "cannot read the message", http.StatusBadRequest)
+		return
+	}
+	if !verifyEventSub(c.SpecificConfig["eventsub_secret"], r.Header, body, time.Now()) {
+		cmdlib.Lerr("EventSub message with a wrong signature from %s", r.RemoteAddr)
+		http.Error(w, "wrong signature", http.StatusForbidden)
+		return
+	}
+	var message eventSubMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		cmdlib.Lerr("cannot parse EventSub message, %v", err)
+		http.Error(w, "cannot parse the message", http.StatusBadRequest)
+		return
+	}
+	messageType := r.Header.Get(eventSubMessageType)
+	if messageType == "webhook_callback_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, message.Challenge)
+		return
+	}
+	if c.seenEventSubMessage(r.Header.Get(eventSubMessageID), time.Now()) {
+		if c.Dbg {
+			cmdlib.Ldbg("EventSub message %s is already processed", r.Header.Get(eventSubMessageID))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	switch messageType {
+	case "notification":
+		c.pushEventSubNotification(&message)
+	case "revocation":
+		cmdlib.Lerr("EventSub subscription %s for %s is revoked, %s", message.Subscription.Type, message.Subscription.Condition.BroadcasterUserID, message.Subscription.Status)
+		c.forgetEventSub(message.Subscription.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// seenEventSubMessage tells if the message is already processed and remembers it otherwise,
+// the IDs are kept as long as the messages are accepted
+func (c *TwitchChecker) seenEventSubMessage(id string, now time.Time) bool {
+	c.messagesMu.Lock()
+	defer c.messagesMu.Unlock()
+	if c.messages == nil {
+		c.messages = map[string]time.Time{}
+	}
+	for k, received := range c.messages {
+		if now.Sub(received) > 2*eventSubMaxAge {
+			delete(c.messages, k)
+		}
+	}
+	if _, found := c.messages[id]; found {
+		return true
+	}
+	c.messages[id] = now
+	return false
+}
+
+func (c *TwitchChecker) pushEventSubNotification(message *eventSubMessage) {
+	var status cmdlib.StatusKind
+	switch message.Subscription.Type {
+	case helix.EventSubTypeStreamOnline:
+		status = cmdlib.StatusOnline
+	case helix.EventSubTypeStreamOffline:
+		status = cmdlib.StatusOffline
+	default:
+		return
+	}
+	modelID := strings.ToLower(message.Event.BroadcasterUserLogin)
+	if c.Dbg {
+		cmdlib.Ldbg("EventSub %s for %s", message.Subscription.Type, modelID)
+	}
+	if updater, ok := c.Updater().(cmdlib.EventUpdater); ok {
+		updater.PushEvents([]cmdlib.StatusUpdate{{ModelID: modelID, Status: status}}, nil)
+	}
+}
+
+func (c *TwitchChecker) forgetEventSub(id string) {
+	c.eventSubMu.Lock()
+	defer c.eventSubMu.Unlock()
+	for userID, byType := range c.eventSubs.subs {
+		for t, subID := range byType {
+			if subID == id {
+				delete(byType, t)
+			}
+		}
+		if len(byType) == 0 {
+			delete(c.eventSubs.subs, userID)
+		}
+	}
+}
+
+// syncEventSub subscribes to the stream events of the models and unsubscribes from the others
+//
+// The existing subscriptions are loaded on the first call,
+// so they survive restarts.
+func (c *TwitchChecker) syncEventSub(helixClient *helix.Client, models []string) error {
+	c.eventSubMu.Lock()
+	defer c.eventSubMu.Unlock()
+	subs := &c.eventSubs
+	if !subs.loaded {
+		if err := c.loadEventSubs(helixClient); err != nil {
+			return err
+		}
+		subs.loaded = true
+	}
+	known := c.knownUserIDs()
+	var unknown []string
+	for _, m := range models {
+		if known[m] == "" {
+			unknown = append(unknown, m)
+		}
+	}
+	found := map[string]string{}
+	for _, chunk := range chunks(unknown, 100) {
+		usersResponse, err := helixClient.GetUsers(&helix.UsersParams{Logins: chunk})
+		if err != nil {
+			return fmt.Errorf("negotiation error on getting users, %v", err)
+		}
+		if err := twitchResponseError(usersResponse.ResponseCommon); err != nil {
+			return err
+		}
+		for _, u := range usersResponse.Data.Users {
+			login := strings.ToLower(u.Login)
+			found[login] = u.ID
+			known[login] = u.ID
+		}
+	}
+	c.storeUserIDs(found, nil)
+	wanted := map[string]bool{}
+	for _, m := range models {
+		if id := known[m]; id != "" {
+			wanted[id] = true
+		}
+	}
+	for userID, byType := range subs.subs {
+		if wanted[userID] {
+			continue
+		}
+		for t, id := range byType {
+			resp, err := helixClient.RemoveEventSubSubscription(id)
+			if err != nil {
+				return fmt.Errorf("negotiation error on removing a subscription, %v", err)
+			}
+			if err := twitchResponseError(resp.ResponseCommon); err != nil && resp.StatusCode != http.StatusNotFound {
+				return err
+			}
+			delete(byType, t)
+		}
+		delete(subs.subs, userID)
+	}
+	created := 0
+	for userID := range wanted {
+		for _, t := range eventSubTypes {
+			if subs.subs[userID][t] != "" {
+				continue
+			}
+			if created == eventSubCreateBatch {
+				return nil
+			}
+			if err := c.createEventSub(helixClient, userID, t); err != nil {
+				return err
+			}
+			created++
+		}
+	}
+	return nil
+}
+
+func (c *TwitchChecker) loadEventSubs(helixClient *helix.Client) error {
+	c.eventSubs.subs = map[string]map[string]string{}
+	callback := c.SpecificConfig["eventsub_callback"]
+	after := ""
+	for {
+		resp, err := helixClient.GetEventSubSubscriptions(&helix.EventSubSubscriptionsParams{After: after})
+		if err != nil {
+			return fmt.Errorf("negotiation error on getting subscriptions, %v", err)
+		}
+		if err := twitchResponseError(resp.ResponseCommon); err != nil {
+			return err
+		}
+		for _, sub := range resp.Data.EventSubSubscriptions {
+			if sub.Transport.Callback != callback {
+				continue
+			}
+			if sub.Status != "enabled" && sub.Status != "webhook_callback_verification_pending" {
+				if _, err := helixClient.RemoveEventSubSubscription(sub.ID); err != nil {
+					return fmt.Errorf("negotiation error on removing a subscription, %v", err)
+				}
+				continue
+			}
+			c.setEventSub(sub.Condition.BroadcasterUserID, sub.Type, sub.ID)
+		}
+		after = resp.Data.Pagination.Cursor
+		if after == "" {
+			return nil
+		}
+	}
+}
+
+func (c *TwitchChecker) createEventSub(helixClient *helix.Client, userID string, subType string) error {
+	resp, err := helixClient.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:      subType,
+		Version:   "1",
+		Condition: helix.EventSubCondition{BroadcasterUserID: userID},
+		Transport: helix.EventSubTransport{
+			Method:   "webhook",
+			Callback: c.SpecificConfig["eventsub_callback"],
+			Secret:   c.SpecificConfig["eventsub_secret"],
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("negotiation error on creating a subscription, %v", err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		// the subscription is not tracked, it is adopted on the next load
+		c.eventSubs.loaded = false
+		return nil
+	}
+	if err := twitchResponseError(resp.ResponseCommon); err != nil {
+		return fmt.Errorf("Twitch returns the error on creating a subscription, %w", err)
+	}
+	for _, sub := range resp.Data.EventSubSubscriptions {
+		c.setEventSub(userID, subType, sub.ID)
+	}
+	return nil
+}
+
+func (c *TwitchChecker) setEventSub(userID string, subType string, id string) {
+	if c.eventSubs.subs[userID] == nil {
+		c.eventSubs.subs[userID] = map[string]string{}
+	}
+	c.eventSubs.subs[userID][subType] = id
+}
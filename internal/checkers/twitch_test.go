@@ -0,0 +1,93 @@
+package checkers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func eventSubHeader(secret string, id string, timestamp time.Time, body []byte) http.Header {
+	ts := timestamp.UTC().Format(time.RFC3339Nano)
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(id + ts))
+	_, _ = mac.Write(body)
+	header := http.Header{}
+	header.Set(eventSubMessageID, id)
+	header.Set(eventSubMessageTimestamp, ts)
+	header.Set(eventSubMessageSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerifyEventSub(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":{}}`)
+	if !verifyEventSub("secret1234", eventSubHeader("secret1234", "1", now, body), body, now) {
+		t.Error("a valid message is rejected")
+	}
+	if verifyEventSub("secret1234", eventSubHeader("another123", "1", now, body), body, now) {
+		t.Error("a message with a wrong secret is accepted")
+	}
+	if verifyEventSub("secret1234", eventSubHeader("secret1234", "1", now, body), []byte(`{}`), now) {
+		t.Error("a modified message is accepted")
+	}
+	if verifyEventSub("secret1234", eventSubHeader("secret1234", "1", now.Add(-time.Hour), body), body, now) {
+		t.Error("an old message is accepted")
+	}
+}
+
+func TestCheckTwitchSpecificConfig(t *testing.T) {
+	cases := []struct {
+		config map[string]string
+		valid  bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"eventsub_callback": "https://example.com/eventsub", "eventsub_secret": "secret1234"}, true},
+		{map[string]string{"eventsub_callback": "http://example.com/eventsub", "eventsub_secret": "secret1234"}, false},
+		{map[string]string{"eventsub_callback": "https://example.com:443/eventsub", "eventsub_secret": "secret1234"}, true},
+		{map[string]string{"eventsub_callback": "https://example.com:8443/eventsub", "eventsub_secret": "secret1234"}, false},
+		{map[string]string{"eventsub_callback": "https://example.com/eventsub", "eventsub_secret": "short"}, false},
+	}
+	for _, c := range cases {
+		if err := checkTwitchSpecificConfig(c.config); (err == nil) != c.valid {
+			t.Errorf("wrong validation result for %v, got: %v", c.config, err)
+		}
+	}
+}
+
+func TestEventSubDuplicates(t *testing.T) {
+	checker := &TwitchChecker{}
+	var events []cmdlib.StatusUpdate
+	checker.Init(checker, cmdlib.CheckerConfig{
+		QueueSize:      1,
+		SpecificConfig: map[string]string{"eventsub_secret": "secret1234"},
+		Subscriptions:  map[string]cmdlib.StatusKind{"alice": cmdlib.StatusOffline},
+		EventsCallback: func(res cmdlib.StatusUpdateResults) { events = append(events, res.Data.Updates...) },
+	})
+	send := func(id string, subscriptionType string) {
+		t.Helper()
+		body := []byte(`{"subscription":{"type":"` + subscriptionType + `"},"event":{"broadcaster_user_login":"alice"}}`)
+		req := httptest.NewRequest(http.MethodPost, "/eventsub", bytes.NewReader(body))
+		req.Header = eventSubHeader("secret1234", id, time.Now(), body)
+		req.Header.Set(eventSubMessageType, "notification")
+		rec := httptest.NewRecorder()
+		checker.serveEventSub(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("unexpected response code %d", rec.Code)
+		}
+	}
+	send("1", "stream.online")
+	send("2", "stream.offline")
+	send("1", "stream.online")
+	expected := []cmdlib.StatusUpdate{{ModelID: "alice", Status: cmdlib.StatusOnline}, {ModelID: "alice", Status: cmdlib.StatusOffline}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("wrong events, expected: %v, got: %v", expected, events)
+	}
+}
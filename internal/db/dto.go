@@ -9,8 +9,11 @@ type Notification struct {
 	ChatID   int64
 	ModelID  string
 	Status   cmdlib.StatusKind
+	SubState cmdlib.SubState // SubState is set for notifications of sub-state changes
 	TimeDiff *int
 	ImageURL string
+	Title    string
+	Viewers  int
 	Social   bool
 	Sound    bool
 	Priority int
@@ -36,24 +39,27 @@ const (
 
 // User represents a chat
 type User struct {
-	ChatID               int64
-	MaxModels            int
-	Reports              int
-	Blacklist            bool
-	ShowImages           bool
-	OfflineNotifications bool
+	ChatID                int64
+	MaxModels             int
+	Reports               int
+	Blacklist             bool
+	ShowImages            bool
+	OfflineNotifications  bool
+	SubStateNotifications bool
 }
 
 // Model represents a model
 type Model struct {
-	ModelID string
-	Status  cmdlib.StatusKind
+	ModelID  string
+	Status   cmdlib.StatusKind
+	SubState cmdlib.SubState
 }
 
 // StatusChange represents a status change
 type StatusChange struct {
 	ModelID   string
 	Status    cmdlib.StatusKind
+	SubState  cmdlib.SubState
 	Timestamp int
 }
 
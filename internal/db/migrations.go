@@ -132,6 +132,19 @@ var migrations = []func(d *Database){
 			include (model_id, timestamp)
 			where is_latest = true;`)
 	},
+	func(d *Database) {
+		d.MustExec(`alter table status_changes add column sub_state integer not null default 0;`)
+		d.MustExec(`alter table models add column sub_state integer not null default 0;`)
+		d.MustExec(`alter table notification_queue add column sub_state integer not null default 0;`)
+		d.MustExec(`alter table users add column sub_state_notifications boolean not null default false;`)
+	},
+	func(d *Database) {
+		d.MustExec(`alter table notification_queue add column title text not null default '';`)
+		d.MustExec(`alter table notification_queue add column viewers integer not null default 0;`)
+	},
+	func(d *Database) {
+		d.MustExec(`alter table models add column user_id text;`)
+	},
 }
 
 // ApplyMigrations applies all migrations to the database
@@ -13,7 +13,7 @@ func (d *Database) NewNotifications() []Notification {
 	var nots []Notification
 	var iter Notification
 	d.MustQuery(
-		`select id, endpoint, chat_id, model_id, status, time_diff, image_url, social, priority, sound, kind
+		`select id, endpoint, chat_id, model_id, status, sub_state, time_diff, image_url, title, viewers, social, priority, sound, kind
 		from notification_queue
 		where sending = 0
 		order by id`,
@@ -24,8 +24,11 @@ func (d *Database) NewNotifications() []Notification {
 			&iter.ChatID,
 			&iter.ModelID,
 			&iter.Status,
+			&iter.SubState,
 			&iter.TimeDiff,
 			&iter.ImageURL,
+			&iter.Title,
+			&iter.Viewers,
 			&iter.Social,
 			&iter.Priority,
 			&iter.Sound,
@@ -50,16 +53,31 @@ func (d *Database) StoreNotifications(nots []Notification) {
 					chat_id,
 					model_id,
 					status,
+					sub_state,
 					time_diff,
 					image_url,
+					title,
+					viewers,
 					social,
 					priority,
 					sound,
 					kind
 				)
-				values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 			`,
-			n.Endpoint, n.ChatID, n.ModelID, n.Status, n.TimeDiff, n.ImageURL, n.Social, n.Priority, n.Sound, n.Kind,
+			n.Endpoint,
+			n.ChatID,
+			n.ModelID,
+			n.Status,
+			n.SubState,
+			n.TimeDiff,
+			n.ImageURL,
+			n.Title,
+			n.Viewers,
+			n.Social,
+			n.Priority,
+			n.Sound,
+			n.Kind,
 		)
 	}
 	d.SendBatch(batch)
@@ -119,14 +137,20 @@ func (d *Database) UsersForModels() (users map[string][]User, endpoints map[stri
 	var endpoint string
 	var offlineNotifications bool
 	var showImages bool
+	var subStateNotifications bool
 	d.MustQuery(`
-		select signals.model_id, signals.chat_id, signals.endpoint, users.offline_notifications, users.show_images
+		select signals.model_id, signals.chat_id, signals.endpoint, users.offline_notifications, users.show_images, users.sub_state_notifications
 		from signals
 		join users on users.chat_id = signals.chat_id`,
 		QueryParams{},
-		ScanTo{&modelID, &chatID, &endpoint, &offlineNotifications, &showImages},
+		ScanTo{&modelID, &chatID, &endpoint, &offlineNotifications, &showImages, &subStateNotifications},
 		func() {
-			users[modelID] = append(users[modelID], User{ChatID: chatID, OfflineNotifications: offlineNotifications, ShowImages: showImages})
+			users[modelID] = append(users[modelID], User{
+				ChatID:                chatID,
+				OfflineNotifications:  offlineNotifications,
+				ShowImages:            showImages,
+				SubStateNotifications: subStateNotifications,
+			})
 			endpoints[modelID] = append(endpoints[modelID], endpoint)
 		})
 	return
@@ -158,13 +182,13 @@ func (d *Database) ModelsForChat(endpoint string, chatID int64) (models []string
 func (d *Database) StatusesForChat(endpoint string, chatID int64) (statuses []Model) {
 	var iter Model
 	d.MustQuery(`
-		select models.model_id, models.status
+		select models.model_id, models.status, models.sub_state
 		from models
 		join signals on signals.model_id=models.model_id
 		where signals.chat_id = $1 and signals.endpoint = $2
 		order by models.model_id`,
 		QueryParams{chatID, endpoint},
-		ScanTo{&iter.ModelID, &iter.Status},
+		ScanTo{&iter.ModelID, &iter.Status, &iter.SubState},
 		func() { statuses = append(statuses, iter) })
 	return
 }
@@ -182,9 +206,20 @@ func (d *Database) SubscriptionsNumber(endpoint string, chatID int64) int {
 
 // User queries a user with particular ID
 func (d *Database) User(chatID int64) (user User, found bool) {
-	found = d.MaybeRecord("select chat_id, max_models, reports, blacklist, show_images, offline_notifications from users where chat_id = $1",
+	found = d.MaybeRecord(`
+		select chat_id, max_models, reports, blacklist, show_images, offline_notifications, sub_state_notifications
+		from users
+		where chat_id = $1`,
 		QueryParams{chatID},
-		ScanTo{&user.ChatID, &user.MaxModels, &user.Reports, &user.Blacklist, &user.ShowImages, &user.OfflineNotifications})
+		ScanTo{
+			&user.ChatID,
+			&user.MaxModels,
+			&user.Reports,
+			&user.Blacklist,
+			&user.ShowImages,
+			&user.OfflineNotifications,
+			&user.SubStateNotifications,
+		})
 	return
 }
 
@@ -363,13 +398,14 @@ func (d *Database) HeavyUsersCount(endpoint string, maxModels int, heavyUserRema
 		maxModels-heavyUserRemainder)
 }
 
-// ConfirmSub confirms subscription
-func (d *Database) ConfirmSub(sub Subscription) {
+// ConfirmSub confirms subscription storing the stable user ID of the model if it is known
+func (d *Database) ConfirmSub(sub Subscription, userID string) {
 	d.MustExec(`
-		insert into models (model_id)
-		values ($1)
-		on conflict(model_id) do nothing`,
-		sub.ModelID)
+		insert into models (model_id, user_id)
+		values ($1, nullif($2, ''))
+		on conflict(model_id) do update set user_id = coalesce(excluded.user_id, models.user_id)`,
+		sub.ModelID,
+		userID)
 	d.MustExec("update signals set confirmed=1 where endpoint = $1 and chat_id = $2 and model_id = $3", sub.Endpoint, sub.ChatID, sub.ModelID)
 }
 
@@ -383,9 +419,9 @@ func (d *Database) QueryLastStatusChanges() map[string]StatusChange {
 	statusChanges := map[string]StatusChange{}
 	var statusChange StatusChange
 	d.MustQuery(
-		`select model_id, status, timestamp from status_changes where is_latest = true`,
+		`select model_id, status, sub_state, timestamp from status_changes where is_latest = true`,
 		nil,
-		ScanTo{&statusChange.ModelID, &statusChange.Status, &statusChange.Timestamp},
+		ScanTo{&statusChange.ModelID, &statusChange.Status, &statusChange.SubState, &statusChange.Timestamp},
 		func() { statusChanges[statusChange.ModelID] = statusChange })
 	return statusChanges
 }
@@ -395,9 +431,9 @@ func (d *Database) QueryLastStatusChangesForModels(modelIDs []string) map[string
 	statusChanges := map[string]StatusChange{}
 	var statusChange StatusChange
 	d.MustQuery(
-		`select model_id, status, timestamp from status_changes where is_latest = true and model_id = any($1)`,
+		`select model_id, status, sub_state, timestamp from status_changes where is_latest = true and model_id = any($1)`,
 		QueryParams{modelIDs},
-		ScanTo{&statusChange.ModelID, &statusChange.Status, &statusChange.Timestamp},
+		ScanTo{&statusChange.ModelID, &statusChange.Status, &statusChange.SubState, &statusChange.Timestamp},
 		func() { statusChanges[statusChange.ModelID] = statusChange })
 	return statusChanges
 }
@@ -426,6 +462,19 @@ func (d *Database) QueryLastOnlineModels() map[string]bool {
 	return onlineModels
 }
 
+// QueryLastSubStates queries latest known sub-states of online models
+func (d *Database) QueryLastSubStates() map[string]cmdlib.SubState {
+	subStates := map[string]cmdlib.SubState{}
+	var modelID string
+	var subState cmdlib.SubState
+	d.MustQuery(
+		`select model_id, sub_state from status_changes where is_latest and status = 2 and sub_state <> 0`,
+		nil,
+		ScanTo{&modelID, &subState},
+		func() { subStates[modelID] = subState })
+	return subStates
+}
+
 // QueryConfirmedModels returns all known confirmed models
 func (d *Database) QueryConfirmedModels() map[string]bool {
 	statuses := map[string]bool{}
@@ -474,6 +523,86 @@ func (d *Database) ResetBlock(endpoint string, chatID int64) {
 	d.MustExec("update block set block=0 where endpoint = $1 and chat_id = $2", endpoint, chatID)
 }
 
+// QueryUserIDs returns the stored stable user IDs of the models
+func (d *Database) QueryUserIDs() map[string]string {
+	userIDs := map[string]string{}
+	var modelID, userID string
+	d.MustQuery(
+		`select model_id, user_id from models where user_id is not null`,
+		nil,
+		ScanTo{&modelID, &userID},
+		func() { userIDs[modelID] = userID })
+	return userIDs
+}
+
+// StoreUserIDs stores the stable user IDs of the models
+func (d *Database) StoreUserIDs(userIDs map[string]string) {
+	batch := &pgx.Batch{}
+	for modelID, userID := range userIDs {
+		batch.Queue(
+			`
+				insert into models (model_id, user_id)
+				values ($1, $2)
+				on conflict(model_id) do update set user_id = excluded.user_id
+			`,
+			modelID,
+			userID)
+	}
+	d.SendBatch(batch)
+}
+
+// RenameModel moves the subscriptions, the status history, the details and the queued notifications of a model to its new ID,
+// it returns the confirmed subscriptions moved to the new ID
+func (d *Database) RenameModel(modelID string, newModelID string) []Subscription {
+	done := d.Measure("db: rename model")
+	defer done()
+	tx, err := d.Begin()
+	checkErr(err)
+	exec := func(q string) {
+		_, err := tx.Exec(context.Background(), q, modelID, newModelID)
+		checkErr(err)
+	}
+	exec(`
+		delete from signals s
+		where model_id = $1 and exists (
+			select 1 from signals t
+			where t.model_id = $2 and t.chat_id = s.chat_id and t.endpoint = s.endpoint)
+	`)
+	// The subscribers already subscribed to the new ID are not notified
+	var subs []Subscription
+	rows, err := tx.Query(context.Background(), "select endpoint, chat_id from signals where model_id = $1 and confirmed = 1", modelID)
+	checkErr(err)
+	for rows.Next() {
+		sub := Subscription{ModelID: newModelID}
+		checkErr(rows.Scan(&sub.Endpoint, &sub.ChatID))
+		subs = append(subs, sub)
+	}
+	checkErr(rows.Err())
+	rows.Close()
+	queries := []string{
+		`update signals set model_id = $2 where model_id = $1`,
+		`
+			update status_changes set is_latest = false
+			where model_id = $1 and is_latest and exists (
+				select 1 from status_changes where model_id = $2 and is_latest)
+		`,
+		`update status_changes set model_id = $2 where model_id = $1`,
+		`
+			update models set user_id = coalesce(models.user_id, old.user_id), special = models.special or old.special
+			from models old
+			where models.model_id = $2 and old.model_id = $1
+		`,
+		`delete from models where model_id = $1 and exists (select 1 from models where model_id = $2)`,
+		`update models set model_id = $2 where model_id = $1`,
+		`update notification_queue set model_id = $2 where model_id = $1`,
+	}
+	for _, q := range queries {
+		exec(q)
+	}
+	checkErr(tx.Commit(context.Background()))
+	return subs
+}
+
 // InsertStatusChanges inserts status changes using a bulk method
 func (d *Database) InsertStatusChanges(changedStatuses []StatusChange) {
 	statusDone := d.Measure("db: insert unconfirmed status updates")
@@ -500,6 +629,7 @@ func (d *Database) InsertStatusChanges(changedStatuses []StatusChange) {
 		statusChangeRows = append(statusChangeRows, []interface{}{
 			statusChange.ModelID,
 			statusChange.Status,
+			statusChange.SubState,
 			statusChange.Timestamp,
 			true,
 		})
@@ -507,7 +637,7 @@ func (d *Database) InsertStatusChanges(changedStatuses []StatusChange) {
 	_, err = tx.CopyFrom(
 		context.Background(),
 		[]string{"status_changes"},
-		[]string{"model_id", "status", "timestamp", "is_latest"},
+		[]string{"model_id", "status", "sub_state", "timestamp", "is_latest"},
 		pgx.CopyFromRows(statusChangeRows),
 	)
 	checkErr(err)
@@ -515,6 +645,21 @@ func (d *Database) InsertStatusChanges(changedStatuses []StatusChange) {
 	checkErr(tx.Commit(context.Background()))
 }
 
+// UpdateLatestSubStates updates the sub-states of the latest status changes,
+// so switching shows does not start a new online period
+func (d *Database) UpdateLatestSubStates(subStateChanges []StatusChange) {
+	done := d.Measure("db: update latest sub-states")
+	defer done()
+	batch := &pgx.Batch{}
+	for _, i := range subStateChanges {
+		batch.Queue(
+			"update status_changes set sub_state = $2 where model_id = $1 and is_latest",
+			i.ModelID,
+			i.SubState)
+	}
+	d.SendBatch(batch)
+}
+
 // InsertConfirmedStatusChanges inserts status changes using a bulk method
 func (d *Database) InsertConfirmedStatusChanges(changedStatuses []StatusChange) {
 	confirmationsDone := d.Measure("db: insert confirmed status changes")
@@ -523,12 +668,13 @@ func (d *Database) InsertConfirmedStatusChanges(changedStatuses []StatusChange)
 	for _, i := range changedStatuses {
 		batch.Queue(
 			`
-				insert into models (model_id, status)
-				values ($1, $2)
-				on conflict(model_id) do update set status = excluded.status
+				insert into models (model_id, status, sub_state)
+				values ($1, $2, $3)
+				on conflict(model_id) do update set status = excluded.status, sub_state = excluded.sub_state
 			`,
 			i.ModelID,
-			i.Status)
+			i.Status,
+			i.SubState)
 	}
 	d.SendBatch(batch)
 }
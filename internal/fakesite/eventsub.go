@@ -0,0 +1,208 @@
+package fakesite
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// twitchSubscription is an EventSub subscription delivered to a webhook
+type twitchSubscription struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Status    string `json:"status"`
+	Condition struct {
+		BroadcasterUserID string `json:"broadcaster_user_id"`
+	} `json:"condition"`
+	Transport struct {
+		Method   string `json:"method"`
+		Callback string `json:"callback"`
+		Secret   string `json:"secret,omitempty"`
+	} `json:"transport"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TwitchSubscriptions returns the number of enabled EventSub subscriptions
+func (s *Server) TwitchSubscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, sub := range s.twitchSubs {
+		if sub.Status == "enabled" {
+			count++
+		}
+	}
+	return count
+}
+
+// SetTwitchWebhookClient sets the client delivering EventSub messages,
+// it should trust the certificate of the webhook
+func (s *Server) SetTwitchWebhookClient(client *http.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookClient = client
+}
+
+// RevokeTwitchSubscriptions revokes all EventSub subscriptions notifying their webhooks
+func (s *Server) RevokeTwitchSubscriptions() {
+	s.mu.Lock()
+	var deliveries []twitchDelivery
+	for id, sub := range s.twitchSubs {
+		sub.Status = "authorization_revoked"
+		deliveries = append(deliveries, s.twitchMessage(sub, "revocation", nil))
+		delete(s.twitchSubs, id)
+	}
+	s.mu.Unlock()
+	deliverAll(deliveries)
+}
+
+func (s *Server) serveTwitchSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		sub := &twitchSubscription{}
+		if err := json.NewDecoder(r.Body).Decode(sub); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"status": http.StatusBadRequest, "message": err.Error()})
+			return
+		}
+		if !s.twitchUserExists(sub.Condition.BroadcasterUserID) {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"status": http.StatusBadRequest, "message": "unknown broadcaster"})
+			return
+		}
+		for _, x := range s.twitchSubs {
+			if x.Type == sub.Type && x.Condition.BroadcasterUserID == sub.Condition.BroadcasterUserID {
+				writeJSON(w, http.StatusConflict, map[string]interface{}{"status": http.StatusConflict, "message": "subscription already exists"})
+				return
+			}
+		}
+		s.nextSubID++
+		sub.ID = "sub-" + strconv.Itoa(s.nextSubID)
+		sub.CreatedAt = time.Now()
+		sub.Status = "webhook_callback_verification_pending"
+		s.twitchSubs[sub.ID] = sub
+		challenge := "challenge-" + sub.ID
+		verification := s.twitchMessage(sub, "webhook_callback_verification", map[string]interface{}{"challenge": challenge})
+		// The webhook is free to query the server while it responds
+		s.mu.Unlock()
+		verified := verification.deliver() == challenge
+		s.mu.Lock()
+		if verified {
+			sub.Status = "enabled"
+		} else {
+			sub.Status = "webhook_callback_verification_failed"
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"data": []*twitchSubscription{publicTwitchSubscription(sub)}, "total": len(s.twitchSubs)})
+	case http.MethodGet:
+		data := []*twitchSubscription{}
+		for _, sub := range s.twitchSubs {
+			data = append(data, publicTwitchSubscription(sub))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "total": len(data), "pagination": map[string]string{}})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if s.twitchSubs[id] == nil {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"status": http.StatusNotFound, "message": "subscription not found"})
+			return
+		}
+		delete(s.twitchSubs, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func publicTwitchSubscription(sub *twitchSubscription) *twitchSubscription {
+	result := *sub
+	result.Transport.Secret = ""
+	return &result
+}
+
+func (s *Server) twitchUserExists(userID string) bool {
+	for _, m := range s.models[Twitch] {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// twitchNotifications returns the messages delivering a stream event of a model to the enabled subscriptions
+func (s *Server) twitchNotifications(m *Model, eventType string) []twitchDelivery {
+	var result []twitchDelivery
+	for _, sub := range s.twitchSubs {
+		if sub.Status != "enabled" || sub.Type != eventType || sub.Condition.BroadcasterUserID != m.UserID {
+			continue
+		}
+		event := map[string]interface{}{
+			"broadcaster_user_id":    m.UserID,
+			"broadcaster_user_login": m.ID,
+			"broadcaster_user_name":  m.ID,
+		}
+		if eventType == "stream.online" {
+			event["id"] = "stream-" + m.UserID
+			event["type"] = "live"
+		}
+		result = append(result, s.twitchMessage(sub, "notification", map[string]interface{}{"event": event}))
+	}
+	return result
+}
+
+// twitchDelivery is a signed EventSub message,
+// it is delivered without holding the lock, so the webhook can query the server
+type twitchDelivery struct {
+	client *http.Client
+	req    *http.Request
+}
+
+func deliverAll(deliveries []twitchDelivery) {
+	for _, d := range deliveries {
+		d.deliver()
+	}
+}
+
+// twitchMessage signs a message to the webhook of the subscription
+func (s *Server) twitchMessage(sub *twitchSubscription, messageType string, fields map[string]interface{}) twitchDelivery {
+	message := map[string]interface{}{"subscription": publicTwitchSubscription(sub)}
+	for k, v := range fields {
+		message[k] = v
+	}
+	body, err := json.Marshal(message)
+	cmdlib.CheckErr(err)
+	s.nextMessageID++
+	id := "message-" + strconv.Itoa(s.nextMessageID)
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	mac := hmac.New(sha256.New, []byte(sub.Transport.Secret))
+	_, _ = mac.Write([]byte(id + timestamp))
+	_, _ = mac.Write(body)
+	req, err := http.NewRequest(http.MethodPost, sub.Transport.Callback, bytes.NewReader(body))
+	cmdlib.CheckErr(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Twitch-Eventsub-Message-Id", id)
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+	req.Header.Set("Twitch-Eventsub-Subscription-Type", sub.Type)
+	return twitchDelivery{client: s.webhookClient, req: req}
+}
+
+// deliver posts the message and returns the response
+func (d twitchDelivery) deliver() string {
+	resp, err := d.client.Do(d.req)
+	if err != nil {
+		return ""
+	}
+	defer cmdlib.CloseBody(resp.Body)
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	return string(result)
+}
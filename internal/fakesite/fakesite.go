@@ -0,0 +1,249 @@
+// Package fakesite emulates the APIs of the checked websites for tests
+//
+// The server routes the requests by their original host,
+// so the checkers work with it unchanged through the client returned by Client.
+package fakesite
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+// Emulated websites
+const (
+	Chaturbate = "chaturbate"
+	BongaCams  = "bongacams"
+	Stripchat  = "stripchat"
+	Streamate  = "streamate"
+	Twitch     = "twitch"
+)
+
+// Model represents a model of an emulated website
+type Model struct {
+	ID       string
+	UserID   string
+	Online   bool
+	SubState cmdlib.SubState
+	Title    string
+	Viewers  int
+	ImageURL string
+}
+
+// Step is a change of the models applied after a delay
+type Step struct {
+	After time.Duration
+	Apply func(s *Server)
+}
+
+// Server emulates the online lists and the single status APIs of the websites
+type Server struct {
+	*httptest.Server
+	mu            sync.Mutex
+	models        map[string]map[string]*Model
+	requests      map[string]int
+	nextUserID    int
+	twitchTokens  map[string]bool
+	nextToken     int
+	twitchSubs    map[string]*twitchSubscription
+	nextSubID     int
+	nextMessageID int
+	webhookClient *http.Client
+}
+
+// New starts a new server
+func New() *Server {
+	s := &Server{
+		models:        map[string]map[string]*Model{},
+		requests:      map[string]int{},
+		twitchTokens:  map[string]bool{},
+		twitchSubs:    map[string]*twitchSubscription{},
+		webhookClient: http.DefaultClient,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// rewriteTransport sends all the requests to the server keeping the original host
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = req.URL.Host
+	return t.next.RoundTrip(r)
+}
+
+// Client returns a client sending the requests for any website to the server
+func (s *Server) Client() *cmdlib.Client {
+	target, err := url.Parse(s.URL)
+	cmdlib.CheckErr(err)
+	return &cmdlib.Client{
+		Client: &http.Client{
+			Transport:     rewriteTransport{target: target, next: http.DefaultTransport},
+			CheckRedirect: cmdlib.NoRedirect,
+		},
+		Addr: &net.TCPAddr{},
+	}
+}
+
+func (s *Server) model(site string, id string) *Model {
+	if s.models[site] == nil {
+		s.models[site] = map[string]*Model{}
+	}
+	m := s.models[site][id]
+	if m == nil {
+		s.nextUserID++
+		m = &Model{ID: id, UserID: strconv.Itoa(s.nextUserID)}
+		s.models[site][id] = m
+	}
+	return m
+}
+
+// SetOnline adds a model if needed and makes it online with the stream info,
+// Twitch EventSub subscribers are notified if the model was offline
+func (s *Server) SetOnline(site string, id string, info cmdlib.StreamInfo) {
+	s.mu.Lock()
+	m := s.model(site, id)
+	var deliveries []twitchDelivery
+	if site == Twitch && !m.Online {
+		deliveries = s.twitchNotifications(m, "stream.online")
+	}
+	m.Online = true
+	m.SubState = info.SubState
+	m.Title = info.Title
+	m.Viewers = info.Viewers
+	m.ImageURL = info.ImageURL
+	s.mu.Unlock()
+	deliverAll(deliveries)
+}
+
+// SetOffline adds a model if needed and makes it offline,
+// Twitch EventSub subscribers are notified if the model was online
+func (s *Server) SetOffline(site string, id string) {
+	s.mu.Lock()
+	m := s.model(site, id)
+	var deliveries []twitchDelivery
+	if site == Twitch && m.Online {
+		deliveries = s.twitchNotifications(m, "stream.offline")
+	}
+	m.Online = false
+	m.SubState = cmdlib.SubStateUnknown
+	m.Viewers = 0
+	s.mu.Unlock()
+	deliverAll(deliveries)
+}
+
+// Remove removes a model, so it is reported as not found
+func (s *Server) Remove(site string, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.models[site], id)
+}
+
+// Rename changes the ID of a model keeping its user ID
+func (s *Server) Rename(site string, id string, newID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.models[site][id]
+	if m == nil {
+		return
+	}
+	delete(s.models[site], id)
+	m.ID = newID
+	s.models[site][newID] = m
+}
+
+// Requests returns the number of requests served for the website
+func (s *Server) Requests(site string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[site]
+}
+
+// ExpireTwitchTokens invalidates all issued Twitch access tokens
+func (s *Server) ExpireTwitchTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.twitchTokens = map[string]bool{}
+}
+
+// TwitchTokensIssued returns the number of Twitch access tokens issued
+func (s *Server) TwitchTokensIssued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextToken
+}
+
+// Play applies the steps in a background goroutine until the context is done
+func (s *Server) Play(ctx context.Context, steps []Step) {
+	go func() {
+		for _, step := range steps {
+			if err := cmdlib.Sleep(ctx, step.After); err != nil {
+				return
+			}
+			step.Apply(s)
+		}
+	}()
+}
+
+// find returns a copy of a model
+func (s *Server) find(site string, id string) (Model, bool) {
+	m := s.models[site][id]
+	if m == nil {
+		return Model{}, false
+	}
+	return *m, true
+}
+
+// online returns copies of the online models of the website sorted by their IDs
+func (s *Server) online(site string) []Model {
+	var result []Model
+	for _, m := range s.models[site] {
+		if m.Online {
+			result = append(result, *m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	switch host {
+	case "chaturbate.com":
+		s.requests[Chaturbate]++
+		s.serveChaturbate(w, r)
+	case "en.bongacams.com", "tools.bongacams.com":
+		s.requests[BongaCams]++
+		s.serveBongaCams(w, r, host)
+	case "stripchat.com":
+		s.requests[Stripchat]++
+		s.serveStripchat(w, r)
+	case "affiliate.streamate.com":
+		s.requests[Streamate]++
+		s.serveStreamate(w, r)
+	case "id.twitch.tv", "api.twitch.tv":
+		s.requests[Twitch]++
+		s.serveTwitch(w, r, host)
+	default:
+		http.NotFound(w, r)
+	}
+}
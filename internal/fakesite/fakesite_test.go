@@ -0,0 +1,142 @@
+package fakesite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func stripchatTotal(t *testing.T, s *Server) int {
+	resp, err := s.Client().Client.Get("https://stripchat.com/api/external/v4/widget/?offset=0&limit=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cmdlib.CloseBody(resp.Body)
+	var parsed struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Total
+}
+
+func TestPlay(t *testing.T) {
+	s := New()
+	defer s.Close()
+	done := make(chan bool)
+	s.Play(context.Background(), []Step{
+		{After: time.Millisecond, Apply: func(s *Server) { s.SetOnline(Stripchat, "a", cmdlib.StreamInfo{}) }},
+		{After: time.Millisecond, Apply: func(s *Server) { s.SetOnline(Stripchat, "b", cmdlib.StreamInfo{}) }},
+		{After: time.Millisecond, Apply: func(s *Server) { s.SetOffline(Stripchat, "a"); close(done) }},
+	})
+	<-done
+	if total := stripchatTotal(t, s); total != 1 {
+		t.Errorf("wrong total, expected: 1, got: %d", total)
+	}
+	if n := s.Requests(Stripchat); n != 1 {
+		t.Errorf("wrong number of requests, expected: 1, got: %d", n)
+	}
+}
+
+func TestTwitchToken(t *testing.T) {
+	s := New()
+	defer s.Close()
+	client := s.Client()
+	resp, err := client.Client.Post("https://id.twitch.tv/oauth2/token", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	cmdlib.CloseBody(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := func() int {
+		req, err := http.NewRequest("GET", "https://api.twitch.tv/helix/streams", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmdlib.CloseBody(resp.Body)
+		return resp.StatusCode
+	}
+	if code := streams(); code != 200 {
+		t.Errorf("wrong status, expected: 200, got: %d", code)
+	}
+	s.ExpireTwitchTokens()
+	if code := streams(); code != 401 {
+		t.Errorf("wrong status, expected: 401, got: %d", code)
+	}
+}
+
+func TestTwitchWebhookQueriesServer(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.SetOffline(Twitch, "alice")
+	var notifications []int
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Challenge string `json:"challenge"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		subs := s.TwitchSubscriptions()
+		if r.Header.Get("Twitch-Eventsub-Message-Type") == "notification" {
+			notifications = append(notifications, subs)
+		}
+		_, _ = io.WriteString(w, message.Challenge)
+	}))
+	defer webhook.Close()
+	s.SetTwitchWebhookClient(webhook.Client())
+
+	client := s.Client()
+	resp, err := client.Client.Post("https://id.twitch.tv/oauth2/token", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	cmdlib.CloseBody(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(
+		`{"type":"stream.online","version":"1","condition":{"broadcaster_user_id":"%s"},"transport":{"method":"webhook","callback":"%s","secret":"secret1234"}}`,
+		s.models[Twitch]["alice"].UserID,
+		webhook.URL)
+	req, err := http.NewRequest("POST", "https://api.twitch.tv/helix/eventsub/subscriptions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdlib.CloseBody(resp.Body)
+	if subs := s.TwitchSubscriptions(); subs != 1 {
+		t.Fatalf("the subscription is not verified, got: %d", subs)
+	}
+
+	s.SetOnline(Twitch, "alice", cmdlib.StreamInfo{})
+	if len(notifications) != 1 || notifications[0] != 1 {
+		t.Errorf("wrong notifications, got: %v", notifications)
+	}
+}
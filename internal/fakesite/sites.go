@@ -0,0 +1,329 @@
+package fakesite
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bcmk/siren/lib/cmdlib"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	cmdlib.CheckErr(json.NewEncoder(w).Encode(v))
+}
+
+func chaturbateShow(m Model) string {
+	switch m.SubState {
+	case cmdlib.SubStatePrivate:
+		return "private"
+	case cmdlib.SubStateGroup:
+		return "group"
+	case cmdlib.SubStateHidden:
+		return "hidden"
+	case cmdlib.SubStatePassword:
+		return "password protected"
+	}
+	return "public"
+}
+
+func (s *Server) serveChaturbate(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/affiliates/api/onlinerooms/" {
+		list := []map[string]interface{}{}
+		for _, m := range s.online(Chaturbate) {
+			list = append(list, map[string]interface{}{
+				"username":     m.ID,
+				"image_url":    m.ImageURL,
+				"current_show": chaturbateShow(m),
+				"room_subject": m.Title,
+				"num_users":    m.Viewers,
+				"tags":         []string{},
+			})
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	if id := strings.TrimPrefix(r.URL.Path, "/api/biocontext/"); id != r.URL.Path {
+		m, found := s.find(Chaturbate, strings.TrimSuffix(id, "/"))
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"status": 404, "code": "not-found"})
+			return
+		}
+		status := "offline"
+		if m.Online {
+			status = chaturbateShow(m)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"room_status": status})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) serveBongaCams(w http.ResponseWriter, r *http.Request, host string) {
+	if host == "tools.bongacams.com" {
+		if r.URL.Path != "/promo.php" {
+			http.NotFound(w, r)
+			return
+		}
+		list := []map[string]interface{}{}
+		for _, m := range s.online(BongaCams) {
+			list = append(list, map[string]interface{}{
+				"username": m.ID,
+				"profile_images": map[string]string{
+					"thumbnail_image_medium_live": strings.TrimPrefix(m.ImageURL, "https:"),
+				},
+			})
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	m, found := s.find(BongaCams, strings.TrimPrefix(r.URL.Path, "/"))
+	switch {
+	case !found:
+		http.NotFound(w, r)
+	case m.Online:
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+func stripchatStatus(m Model) string {
+	switch m.SubState {
+	case cmdlib.SubStatePrivate:
+		return "private"
+	case cmdlib.SubStateGroup:
+		return "groupShow"
+	}
+	return "public"
+}
+
+func (s *Server) serveStripchat(w http.ResponseWriter, r *http.Request) {
+	if id := strings.TrimPrefix(r.URL.Path, "/api/front/v2/models/username/"); id != r.URL.Path {
+		s.serveStripchatCam(w, r, strings.TrimSuffix(id, "/cam"))
+		return
+	}
+	if r.URL.Path != "/api/external/v4/widget/" {
+		http.NotFound(w, r)
+		return
+	}
+	online := s.online(Stripchat)
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = len(online)
+	}
+	models := []map[string]interface{}{}
+	for i := offset; i < len(online) && i < offset+limit; i++ {
+		m := online[i]
+		models = append(models, map[string]interface{}{
+			"username":     m.ID,
+			"snapshotUrl":  m.ImageURL,
+			"status":       stripchatStatus(m),
+			"topic":        m.Title,
+			"viewersCount": m.Viewers,
+			"tags":         []string{},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total": len(online), "models": models})
+}
+
+func (s *Server) serveStripchatCam(w http.ResponseWriter, r *http.Request, id string) {
+	m, found := s.find(Stripchat, id)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	status := "off"
+	if m.Online {
+		status = stripchatStatus(m)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user": map[string]interface{}{
+			"user": map[string]interface{}{"username": m.ID, "status": status},
+		},
+		"cam": map[string]interface{}{"topic": m.Title},
+	})
+}
+
+type streamateQuery struct {
+	Options struct {
+		MaxResults int `xml:"MaxResults,attr"`
+	}
+	AvailablePerformers struct {
+		PageNum           int  `xml:"PageNum,attr"`
+		CountTotalResults bool `xml:"CountTotalResults,attr"`
+		Constraints       struct {
+			Name *string `xml:"Name"`
+		}
+	}
+}
+
+type streamateFull struct {
+	Src string `xml:"Src,attr"`
+}
+
+type streamatePerformer struct {
+	Name       string         `xml:"Name,attr"`
+	StreamType string         `xml:"StreamType,attr"`
+	Full       *streamateFull `xml:"Media>Pic>Full"`
+}
+
+type streamatePerformers struct {
+	ExactMatches     int                  `xml:"ExactMatches,attr"`
+	TotalResultCount int                  `xml:"TotalResultCount,attr,omitempty"`
+	Performers       []streamatePerformer `xml:"Performer"`
+}
+
+type streamateResult struct {
+	XMLName             xml.Name `xml:"SMLResult"`
+	AvailablePerformers streamatePerformers
+}
+
+func (s *Server) serveStreamate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/SMLive/SMLResult.xml" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var query streamateQuery
+	if err := xml.Unmarshal(body, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result streamateResult
+	if name := query.AvailablePerformers.Constraints.Name; name != nil {
+		if m, found := s.find(Streamate, *name); found {
+			streamType := "offline"
+			if m.Online {
+				streamType = "live"
+			}
+			result.AvailablePerformers.ExactMatches = 1
+			result.AvailablePerformers.Performers = []streamatePerformer{{Name: m.ID, StreamType: streamType}}
+		}
+	} else {
+		online := s.online(Streamate)
+		pageSize := query.Options.MaxResults
+		if pageSize <= 0 {
+			pageSize = len(online)
+		}
+		start := (query.AvailablePerformers.PageNum - 1) * pageSize
+		for i := start; i >= 0 && i < len(online) && i < start+pageSize; i++ {
+			result.AvailablePerformers.Performers = append(result.AvailablePerformers.Performers, streamatePerformer{
+				Name:       online[i].ID,
+				StreamType: "live",
+				Full:       &streamateFull{Src: strings.TrimPrefix(online[i].ImageURL, "https:")},
+			})
+		}
+		result.AvailablePerformers.ExactMatches = len(result.AvailablePerformers.Performers)
+		if query.AvailablePerformers.CountTotalResults {
+			result.AvailablePerformers.TotalResultCount = len(online)
+		}
+	}
+	output, err := xml.Marshal(result)
+	cmdlib.CheckErr(err)
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, "%s%s\n", xml.Header, output)
+}
+
+func (s *Server) serveTwitch(w http.ResponseWriter, r *http.Request, host string) {
+	if host == "id.twitch.tv" {
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth2/token" {
+			http.NotFound(w, r)
+			return
+		}
+		s.nextToken++
+		token := fmt.Sprintf("token-%d", s.nextToken)
+		s.twitchTokens[token] = true
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": token,
+			"expires_in":   3600,
+			"token_type":   "bearer",
+		})
+		return
+	}
+	if !s.twitchTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error":   "Unauthorized",
+			"status":  http.StatusUnauthorized,
+			"message": "Invalid OAuth token",
+		})
+		return
+	}
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/helix/streams":
+		s.serveTwitchStreams(w, q["user_login"], q.Get("first"), q.Get("after"))
+	case "/helix/users":
+		users := []map[string]string{}
+		for _, login := range q["login"] {
+			if m, found := s.find(Twitch, strings.ToLower(login)); found {
+				users = append(users, map[string]string{"id": m.UserID, "login": m.ID, "display_name": m.ID})
+			}
+		}
+		for _, id := range q["id"] {
+			for _, m := range s.models[Twitch] {
+				if m.UserID == id {
+					users = append(users, map[string]string{"id": m.UserID, "login": m.ID, "display_name": m.ID})
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": users})
+	case "/helix/eventsub/subscriptions":
+		s.serveTwitchSubscriptions(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveTwitchStreams returns the streams of the requested users
+// or the page of all streams starting at the offset encoded in the cursor
+func (s *Server) serveTwitchStreams(w http.ResponseWriter, logins []string, first string, after string) {
+	var streams []Model
+	cursor := ""
+	if len(logins) > 0 {
+		for _, login := range logins {
+			if m, found := s.find(Twitch, strings.ToLower(login)); found && m.Online {
+				streams = append(streams, m)
+			}
+		}
+	} else {
+		online := s.online(Twitch)
+		offset, _ := strconv.Atoi(after)
+		limit, err := strconv.Atoi(first)
+		if err != nil {
+			limit = 20
+		}
+		for i := offset; i < len(online) && i < offset+limit; i++ {
+			streams = append(streams, online[i])
+		}
+		cursor = strconv.Itoa(offset + len(streams))
+	}
+	data := []map[string]interface{}{}
+	for _, m := range streams {
+		data = append(data, map[string]interface{}{
+			"id":            "stream-" + m.UserID,
+			"user_id":       m.UserID,
+			"user_login":    m.ID,
+			"user_name":     m.ID,
+			"type":          "live",
+			"title":         m.Title,
+			"viewer_count":  m.Viewers,
+			"thumbnail_url": m.ImageURL,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       data,
+		"pagination": map[string]string{"cursor": cursor},
+	})
+}
@@ -1,9 +1,12 @@
 package cmdlib
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -15,17 +18,33 @@ type StatusRequest struct {
 	CheckMode     CheckMode
 }
 
+// StreamInfo contains the details of an online stream
+type StreamInfo struct {
+	ImageURL string
+	SubState SubState
+	Title    string
+	Viewers  int
+	Tags     []string
+	Game     string
+}
+
 // StatusResultsData contains data from online checking algorithm
 type StatusResultsData struct {
 	Statuses map[string]StatusKind
-	Images   map[string]string
+	Info     map[string]StreamInfo
 	Elapsed  time.Duration
+	// Endpoints contains the results of every queried endpoint, it is nil if endpoints are not queried
+	Endpoints []EndpointResult
+	// UserIDs contains the stable user IDs of the found models, it is nil if the site has none
+	UserIDs map[string]string
+	// Renames maps the model IDs of the renamed models to their new model IDs
+	Renames map[string]string
 }
 
 // StatusResults contains results from online checking algorithm
 type StatusResults struct {
 	Data   *StatusResultsData
-	Errors int
+	Errors []*CheckerError
 }
 
 // CheckerConfig represents checker config
@@ -37,15 +56,32 @@ type CheckerConfig struct {
 	SpecificConfig       map[string]string
 	QueueSize            int
 	SiteOnlineModels     map[string]bool
+	SiteSubStates        map[string]SubState
 	Subscriptions        map[string]StatusKind
-	IntervalMs           int
+	PollTimeoutSeconds   int
+	EndpointRetries      int
+	EndpointRetryDelayMs int
+	MassOfflineGuard     MassOfflineGuard
+	MinCoveragePercent   float64
+	// MaxResponseBytes limits the size of the streamed online lists, zero means no limit
+	MaxResponseBytes int64
+	// UserIDs contains the stored stable user IDs of the models
+	UserIDs map[string]string
+	// EventsCallback receives the updates caused by the status changes pushed by a site
+	EventsCallback func(StatusUpdateResults)
+	// SingleCheckTimeoutSeconds limits a single model check of the special models and the specific requests, zero means no limit
+	SingleCheckTimeoutSeconds int
+	// Name identifies the checker in the failure log
+	Name string
+	// FailureLog keeps the failing responses, it is optional
+	FailureLog *FailureLog
 }
 
 // Checker is the interface for a checker for specific site
 type Checker interface {
-	CheckStatusSingle(modelID string) StatusKind
-	CheckStatusesMany(specific QueryModelList, checkMode CheckMode) (statuses map[string]StatusKind, images map[string]string, err error)
-	Start()
+	CheckStatusSingle(ctx context.Context, modelID string) (StatusKind, StreamInfo)
+	CheckStatusesMany(ctx context.Context, specific QueryModelList, checkMode CheckMode) (statuses map[string]StatusKind, info map[string]StreamInfo, err error)
+	Start(ctx context.Context)
 	Init(checker Checker, config CheckerConfig)
 	Updater() Updater
 	PushStatusRequest(statusRequest StatusRequest) error
@@ -89,7 +125,7 @@ func (c *CheckerCommon) PushStatusRequest(statusRequest StatusRequest) error {
 }
 
 type endpointChecker interface {
-	CheckEndpoint(endpoint string) (onlineModels map[string]StatusKind, images map[string]string, err error)
+	CheckEndpoint(ctx context.Context, endpoint string) (onlineModels map[string]StatusKind, info map[string]StreamInfo, err error)
 }
 
 // Init initializes checker common fields
@@ -100,120 +136,264 @@ func (c *CheckerCommon) Init(checker Checker, config CheckerConfig) {
 	c.SpecificConfig = config.SpecificConfig
 	c.QueueSize = config.QueueSize
 	c.SiteOnlineModels = config.SiteOnlineModels
+	c.SiteSubStates = config.SiteSubStates
 	c.Subscriptions = config.Subscriptions
-	c.IntervalMs = config.IntervalMs
+	c.PollTimeoutSeconds = config.PollTimeoutSeconds
+	c.EndpointRetries = config.EndpointRetries
+	c.EndpointRetryDelayMs = config.EndpointRetryDelayMs
+	c.MassOfflineGuard = config.MassOfflineGuard
+	c.MinCoveragePercent = config.MinCoveragePercent
+	c.MaxResponseBytes = config.MaxResponseBytes
+	c.UserIDs = config.UserIDs
+	c.EventsCallback = config.EventsCallback
+	c.SingleCheckTimeoutSeconds = config.SingleCheckTimeoutSeconds
+	c.Name = config.Name
+	c.FailureLog = config.FailureLog
 	c.ClientsLoop = clientsLoop{clients: config.Clients}
 	c.statusRequests = make(chan StatusRequest, config.QueueSize)
 	c.updater = checker.CreateUpdater()
 }
 
-// CheckEndpoints performs queries to all available endpoints
-func CheckEndpoints(c endpointChecker, endpoints []string, dbg bool) (map[string]StatusKind, map[string]string, error) {
-	allStatuses := map[string]StatusKind{}
-	allImages := map[string]string{}
-	for _, endpoint := range endpoints {
-		statuses, images, err := c.CheckEndpoint(endpoint)
-		if err != nil {
-			return nil, nil, err
+// StartFullCheckerDaemon starts a checker for all streams
+func (c *CheckerCommon) StartFullCheckerDaemon(ctx context.Context, checker Checker) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case request := <-c.statusRequests:
+				c.checkFull(ctx, checker, request)
+			}
+		}
+	}()
+}
+
+func (c *CheckerCommon) checkFull(ctx context.Context, checker Checker, request StatusRequest) {
+	ctx, cancel := c.pollContext(ctx)
+	defer cancel()
+	start := time.Now()
+	statuses := map[string]StatusKind{}
+	info := map[string]StreamInfo{}
+	var endpoints []EndpointResult
+	var err error
+	var errs []*CheckerError
+	if request.Specific == nil {
+		if ec, ok := checker.(endpointChecker); ok {
+			endpoints = QueryEndpoints(ctx, ec, c.UsersOnlineEndpoints, c.EndpointRetries, time.Duration(c.EndpointRetryDelayMs)*time.Millisecond, c.Dbg)
+			statuses, info, err = MergeEndpointResults(endpoints)
+			errs = append(errs, EndpointErrors(endpoints)...)
+		} else {
+			captureCtx, capture := withResponseCapture(ctx)
+			statuses, info, err = checker.CheckStatusesMany(captureCtx, AllModels, request.CheckMode)
+			capture.recordFailure("", err)
 		}
-		if dbg {
-			Ldbg("got statuses for endpoint: %d", len(statuses))
+		if err != nil {
+			Lerr("%v", err)
+			request.Callback(StatusResults{Errors: []*CheckerError{ClassifyError("", err)}})
+			return
 		}
-		for m, s := range statuses {
-			allStatuses[m] = s
+	}
+	manual := request.SpecialModels
+	if request.Specific != nil {
+		manual = request.Specific
+	}
+	models := setToSlice(manual)
+	sort.Strings(models)
+	for i, r := range c.checkSingles(ctx, checker, models) {
+		modelID := models[i]
+		if r.status == StatusUnknown || (r.status&StatusNotFound != 0 && request.Specific == nil) {
+			Lerr("status for model %s reported: %v", modelID, r.status)
+			errs = append(errs, NewCheckerError(ErrorKindOther, "status for model %s reported: %v", modelID, r.status))
 		}
-		for k, v := range images {
-			allImages[k] = v
+		statuses[modelID] = r.status
+		if r.status == StatusOnline {
+			info[modelID] = r.info
 		}
 	}
-	return allStatuses, allImages, nil
+	if err := ctx.Err(); err != nil {
+		Lerr("%v", err)
+		request.Callback(StatusResults{Errors: []*CheckerError{ClassifyError("", err)}})
+		return
+	}
+	elapsed := time.Since(start)
+	if c.Dbg {
+		Ldbg("got statuses: %d", len(statuses))
+	}
+	request.Callback(StatusResults{
+		Data:   &StatusResultsData{Statuses: statuses, Info: info, Elapsed: elapsed, Endpoints: endpoints},
+		Errors: errs,
+	})
 }
 
-// StartFullCheckerDaemon starts a checker for all streams
-func (c *CheckerCommon) StartFullCheckerDaemon(checker Checker) {
-	go func() {
-	requests:
-		for request := range c.statusRequests {
-			start := time.Now()
-			statuses := map[string]StatusKind{}
-			images := map[string]string{}
-			var err error
-			if request.Specific == nil {
-				statuses, images, err = checker.CheckStatusesMany(AllModels, request.CheckMode)
-				if err != nil {
-					Lerr("%v", err)
-					request.Callback(StatusResults{Errors: 1})
-					continue requests
-				}
-			}
-			nErrors := 0
-			manual := request.SpecialModels
-			if request.Specific != nil {
-				manual = request.Specific
-			}
-			for modelID := range manual {
-				time.Sleep(time.Duration(c.IntervalMs) * time.Millisecond)
-				status := checker.CheckStatusSingle(modelID)
-				if status == StatusUnknown || (status&StatusNotFound != 0 && request.Specific == nil) {
-					Lerr("status for model %s reported: %v", modelID, status)
-					nErrors++
-				}
-				statuses[modelID] = status
-			}
-			time.Sleep(time.Duration(c.IntervalMs) * time.Millisecond)
-			elapsed := time.Since(start)
-			if c.Dbg {
-				Ldbg("got statuses: %d", len(statuses))
+type singleCheckResult struct {
+	status StatusKind
+	info   StreamInfo
+}
+
+// checkSingles checks the models in parallel, the results are in the order of the models
+func (c *CheckerCommon) checkSingles(ctx context.Context, checker Checker, models []string) []singleCheckResult {
+	results := make([]singleCheckResult, len(models))
+	workers := c.singleCheckWorkers()
+	if workers > len(models) {
+		workers = len(models)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.checkSingle(ctx, checker, models[i])
 			}
-			request.Callback(StatusResults{Data: &StatusResultsData{Statuses: statuses, Images: images, Elapsed: elapsed}, Errors: nErrors})
+		}()
+	}
+	for i := range models {
+		if ctx.Err() != nil {
+			break
 		}
-	}()
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func (c *CheckerCommon) checkSingle(ctx context.Context, checker Checker, modelID string) singleCheckResult {
+	if c.SingleCheckTimeoutSeconds != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.SingleCheckTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	status, info := checker.CheckStatusSingle(ctx, modelID)
+	return singleCheckResult{status: status, info: info}
+}
+
+// singleCheckWorkers returns the number of parallel single checks,
+// a client is queried in parallel as many times as its rate limiter burst allows,
+// a client without a rate limiter is queried one check at a time
+func (c *CheckerCommon) singleCheckWorkers() int {
+	result := 0
+	for _, client := range c.ClientsLoop.clients {
+		result += client.Limiter.Burst()
+	}
+	if result < 1 {
+		return 1
+	}
+	return result
 }
 
 // StartSelectiveCheckerDaemon starts a checker for selected streams
-func (c *CheckerCommon) StartSelectiveCheckerDaemon(checker Checker) {
+func (c *CheckerCommon) StartSelectiveCheckerDaemon(ctx context.Context, checker Checker) {
 	go func() {
-	requests:
-		for request := range c.statusRequests {
-			start := time.Now()
-			var statuses map[string]StatusKind
-			var images map[string]string
-			var err error
-			statuses, images, err = checker.CheckStatusesMany(NewQueryModelList(setToSlice(request.Specific)), request.CheckMode)
-			if err != nil {
-				Lerr("%v", err)
-				request.Callback(StatusResults{Errors: 1})
-				continue requests
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case request := <-c.statusRequests:
+				c.checkSelective(ctx, checker, request)
 			}
-			time.Sleep(time.Duration(c.IntervalMs) * time.Millisecond)
-			elapsed := time.Since(start)
-			if c.Dbg {
-				Ldbg("online streamers: %d", len(statuses))
-			}
-			request.Callback(StatusResults{Data: &StatusResultsData{Statuses: statuses, Images: images, Elapsed: elapsed}, Errors: 0})
 		}
 	}()
 }
 
+func (c *CheckerCommon) checkSelective(ctx context.Context, checker Checker, request StatusRequest) {
+	ctx, cancel := c.pollContext(ctx)
+	defer cancel()
+	start := time.Now()
+	var statuses map[string]StatusKind
+	var info map[string]StreamInfo
+	var userIDs, renames map[string]string
+	var err error
+	captureCtx, capture := withResponseCapture(ctx)
+	if ic, ok := checker.(IdentityChecker); ok && request.CheckMode == CheckStatuses {
+		statuses, userIDs, renames, err = ic.CheckIdentities(captureCtx, setToSlice(request.Specific))
+	} else {
+		statuses, info, err = checker.CheckStatusesMany(captureCtx, NewQueryModelList(setToSlice(request.Specific)), request.CheckMode)
+	}
+	capture.recordFailure("", err)
+	if err != nil {
+		Lerr("%v", err)
+		request.Callback(StatusResults{Errors: []*CheckerError{ClassifyError("", err)}})
+		return
+	}
+	elapsed := time.Since(start)
+	if c.Dbg {
+		Ldbg("online streamers: %d", len(statuses))
+	}
+	request.Callback(StatusResults{
+		Data: &StatusResultsData{
+			Statuses: statuses,
+			Info:     info,
+			Elapsed:  elapsed,
+			UserIDs:  userIDs,
+			Renames:  renames,
+		},
+	})
+}
+
+// pollContext returns a context for a single poll cycle limited by the poll timeout,
+// the failing responses of the cycle are recorded to the failure log
+func (c *CheckerCommon) pollContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = withFailureLog(ctx, c.FailureLog, c.Name)
+	if c.PollTimeoutSeconds == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(c.PollTimeoutSeconds)*time.Second)
+}
+
+// Sleep pauses the current goroutine for the duration or until the context is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // CreateFullUpdater creates an updater quering for all streams
 func (c *CheckerCommon) CreateFullUpdater(checker Checker) Updater {
-	return &fullUpdater{checker: checker, siteOnlineModels: c.SiteOnlineModels}
+	return &fullUpdater{
+		checker:          checker,
+		siteOnlineModels: c.SiteOnlineModels,
+		siteSubStates:    c.SiteSubStates,
+		endpointsOnline:  map[string]map[string]bool{},
+		endpointsMisses:  map[string]map[string]int{},
+		guard:            c.MassOfflineGuard,
+		minCoverage:      c.MinCoveragePercent,
+	}
+}
+
+// IsFullChecker tells if the checker queries for all streams,
+// such checkers return the full online lists whatever models are requested
+func IsFullChecker(checker Checker) bool {
+	_, ok := checker.Updater().(*fullUpdater)
+	return ok
 }
 
 // CreateSelectiveUpdater creates an updater for selected streams
 func (c *CheckerCommon) CreateSelectiveUpdater(checker Checker) Updater {
-	return &selectiveUpdater{checker: checker, siteOnlineModels: c.SiteOnlineModels, knowns: selectKnowns(c.Subscriptions)}
+	return &selectiveUpdater{
+		checker:          checker,
+		siteOnlineModels: c.SiteOnlineModels,
+		siteSubStates:    c.SiteSubStates,
+		knowns:           selectKnowns(c.Subscriptions),
+		eventsCallback:   c.EventsCallback,
+	}
 }
 
 // DoGetRequest performs a GET request respecting the configuration
-func (c *CheckerCommon) DoGetRequest(url string) (net.Addr, *http.Response) {
+func (c *CheckerCommon) DoGetRequest(ctx context.Context, url string) (net.Addr, *http.Response) {
 	client := c.ClientsLoop.NextClient()
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	CheckErr(err)
 	for _, h := range c.Headers {
 		req.Header.Set(h[0], h[1])
 	}
-	resp, err := client.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		Lerr("[%v] cannot send a query, %v", client.Addr, err)
 		return client.Addr, nil
@@ -225,8 +405,8 @@ func (c *CheckerCommon) DoGetRequest(url string) (net.Addr, *http.Response) {
 }
 
 // QueryStatusCode performs a GET request and returns only the status code
-func (c *CheckerCommon) QueryStatusCode(url string) int {
-	_, resp := c.DoGetRequest(url)
+func (c *CheckerCommon) QueryStatusCode(ctx context.Context, url string) int {
+	_, resp := c.DoGetRequest(ctx, url)
 	if resp == nil {
 		return -1
 	}
@@ -0,0 +1,121 @@
+package cmdlib
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrorKind represents a kind of checker failure
+type ErrorKind int
+
+// Checker failure kinds
+const (
+	ErrorKindOther ErrorKind = iota
+	ErrorKindNetwork
+	ErrorKindTimeout
+	ErrorKindHTTPStatus
+	ErrorKindParse
+	ErrorKindEmpty
+	ErrorKindRateLimited
+	// ErrorKindIncomplete is reported for the lists not trusted by the coverage check or the mass offline guard
+	ErrorKindIncomplete
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindNetwork:
+		return "network"
+	case ErrorKindTimeout:
+		return "timeout"
+	case ErrorKindHTTPStatus:
+		return "http_status"
+	case ErrorKindParse:
+		return "parse"
+	case ErrorKindEmpty:
+		return "empty"
+	case ErrorKindRateLimited:
+		return "rate_limited"
+	case ErrorKindIncomplete:
+		return "incomplete"
+	}
+	return "other"
+}
+
+// CheckerError represents a classified checker failure
+type CheckerError struct {
+	Kind ErrorKind
+	// StatusCode is the HTTP status of ErrorKindHTTPStatus and ErrorKindRateLimited failures
+	StatusCode int
+	// Endpoint is the queried endpoint, it is empty if the failure is not caused by an endpoint
+	Endpoint string
+	Err      error
+}
+
+func (e *CheckerError) Error() string { return e.Err.Error() }
+func (e *CheckerError) Unwrap() error { return e.Err }
+
+// Name returns the kind of the failure including the HTTP status if any, e.g. "http_status_502"
+func (e *CheckerError) Name() string {
+	if e.Kind == ErrorKindHTTPStatus {
+		return fmt.Sprintf("%v_%d", e.Kind, e.StatusCode)
+	}
+	return e.Kind.String()
+}
+
+// ErrEmptyResult emerges whenever a site reports no online models at all
+var ErrEmptyResult = &CheckerError{Kind: ErrorKindEmpty, Err: errors.New("zero online models reported")}
+
+// HTTPStatusError returns an error for an unexpected HTTP status
+func HTTPStatusError(code int) error {
+	kind := ErrorKindHTTPStatus
+	if code == http.StatusTooManyRequests {
+		kind = ErrorKindRateLimited
+	}
+	return &CheckerError{Kind: kind, StatusCode: code, Err: fmt.Errorf("query status, %d", code)}
+}
+
+// ParseError returns an error for a response that cannot be parsed
+func ParseError(err error) error {
+	return &CheckerError{Kind: ErrorKindParse, Err: fmt.Errorf("cannot parse response, %w", err)}
+}
+
+// NewCheckerError returns a failure of the kind with the message
+func NewCheckerError(kind ErrorKind, format string, args ...interface{}) *CheckerError {
+	return &CheckerError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// ClassifyError returns the classified failure for an error of the endpoint
+func ClassifyError(endpoint string, err error) *CheckerError {
+	var checkerErr *CheckerError
+	if errors.As(err, &checkerErr) {
+		result := *checkerErr
+		if result.Endpoint == "" {
+			result.Endpoint = endpoint
+		}
+		result.Err = err
+		return &result
+	}
+	result := &CheckerError{Kind: ErrorKindOther, Endpoint: endpoint, Err: err}
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var xmlErr *xml.SyntaxError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Kind = ErrorKindTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			result.Kind = ErrorKindTimeout
+		} else {
+			result.Kind = ErrorKindNetwork
+		}
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.As(err, &xmlErr), errors.Is(err, ErrResponseTooLarge):
+		result.Kind = ErrorKindParse
+	}
+	return result
+}
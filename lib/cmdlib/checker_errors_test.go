@@ -0,0 +1,47 @@
+package cmdlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	var syntaxErr error = &json.SyntaxError{}
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{errors.New("error"), "other"},
+		{fmt.Errorf("cannot send a query, %w", context.DeadlineExceeded), "timeout"},
+		{fmt.Errorf("cannot send a query, %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), "network"},
+		{fmt.Errorf("cannot send a query, %w", &net.DNSError{IsTimeout: true}), "timeout"},
+		{HTTPStatusError(502), "http_status_502"},
+		{HTTPStatusError(429), "rate_limited"},
+		{ParseError(errors.New("error")), "parse"},
+		{syntaxErr, "parse"},
+		{fmt.Errorf("wrapped, %w", ErrResponseTooLarge), "parse"},
+		{ErrEmptyResult, "empty"},
+		{fmt.Errorf("[addr] %w", ParseError(errors.New("error"))), "parse"},
+	}
+	for _, c := range cases {
+		if name := ClassifyError("e", c.err).Name(); name != c.expected {
+			t.Errorf("wrong kind for %v, expected: %s, got: %s", c.err, c.expected, name)
+		}
+	}
+
+	classified := ClassifyError("e1", fmt.Errorf("[addr] %w", HTTPStatusError(503)))
+	if classified.Endpoint != "e1" || classified.StatusCode != 503 || classified.Error() != "[addr] query status, 503" {
+		t.Errorf("wrong classified error %+v", classified)
+	}
+	if again := ClassifyError("e2", classified); again.Endpoint != "e1" {
+		t.Errorf("the endpoint is overwritten, got: %s", again.Endpoint)
+	}
+	if !errors.Is(ClassifyError("", fmt.Errorf("wrapped, %w", ErrEmptyResult)), ErrEmptyResult) {
+		t.Error("the classified error does not wrap the original one")
+	}
+
+}
@@ -0,0 +1,164 @@
+package cmdlib
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const clientHealthHistorySize = 100
+
+// ClientHealthPolicy represents the rules of quarantining failing clients
+type ClientHealthPolicy struct {
+	// FailuresToQuarantine is the number of consecutive failures after which a client is quarantined
+	FailuresToQuarantine int
+	// BaseQuarantine is the duration of the first quarantine, it doubles with each next one
+	BaseQuarantine time.Duration
+	// MaxQuarantine is the maximum duration of a quarantine
+	MaxQuarantine time.Duration
+}
+
+// DefaultClientHealthPolicy is used for the clients without explicit policy
+var DefaultClientHealthPolicy = ClientHealthPolicy{
+	FailuresToQuarantine: 5,
+	BaseQuarantine:       30 * time.Second,
+	MaxQuarantine:        30 * time.Minute,
+}
+
+// ClientHealthStat represents the health of a client
+type ClientHealthStat struct {
+	Address             string `json:"address"`
+	RecentSuccesses     int    `json:"recent_successes"`
+	RecentFailures      int    `json:"recent_failures"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Quarantines         int    `json:"quarantines"`
+	QuarantinedSince    int64  `json:"quarantined_since"`
+	QuarantinedUntil    int64  `json:"quarantined_until"`
+}
+
+// clientHealth tracks recent successes and failures of a client
+type clientHealth struct {
+	mu                  sync.Mutex
+	policy              *ClientHealthPolicy
+	history             [clientHealthHistorySize]bool
+	historyLen          int
+	historyPos          int
+	consecutiveFailures int
+	quarantines         int
+	quarantinedSince    time.Time
+	quarantinedUntil    time.Time
+}
+
+func (h *clientHealth) currentPolicy() *ClientHealthPolicy {
+	if h.policy == nil {
+		return &DefaultClientHealthPolicy
+	}
+	return h.policy
+}
+
+func (h *clientHealth) push(success bool) {
+	h.history[h.historyPos] = success
+	h.historyPos = (h.historyPos + 1) % clientHealthHistorySize
+	if h.historyLen < clientHealthHistorySize {
+		h.historyLen++
+	}
+}
+
+func (h *clientHealth) reportSuccess() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.push(true)
+	h.consecutiveFailures = 0
+	h.quarantines = 0
+}
+
+func (h *clientHealth) reportFailure(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.push(false)
+	h.consecutiveFailures++
+	policy := h.currentPolicy()
+	if h.consecutiveFailures < policy.FailuresToQuarantine || now.Before(h.quarantinedUntil) {
+		return
+	}
+	duration := policy.BaseQuarantine
+	for i := 0; i < h.quarantines && duration < policy.MaxQuarantine; i++ {
+		duration *= 2
+	}
+	if duration > policy.MaxQuarantine {
+		duration = policy.MaxQuarantine
+	}
+	h.quarantines++
+	h.consecutiveFailures = 0
+	h.quarantinedSince = now
+	h.quarantinedUntil = now.Add(duration)
+}
+
+func (h *clientHealth) quarantinedAt(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.Before(h.quarantinedUntil)
+}
+
+func (h *clientHealth) until() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quarantinedUntil
+}
+
+func (h *clientHealth) stat() ClientHealthStat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := ClientHealthStat{ConsecutiveFailures: h.consecutiveFailures, Quarantines: h.quarantines}
+	for i := 0; i < h.historyLen; i++ {
+		if h.history[i] {
+			result.RecentSuccesses++
+		} else {
+			result.RecentFailures++
+		}
+	}
+	if !h.quarantinedUntil.IsZero() {
+		result.QuarantinedSince = h.quarantinedSince.Unix()
+		result.QuarantinedUntil = h.quarantinedUntil.Unix()
+	}
+	return result
+}
+
+// failedResponse tells if a response shows that the client is banned or rate limited
+func failedResponse(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode >= 500
+}
+
+// SetHealthPolicy sets the quarantine rules for the client
+func (c *Client) SetHealthPolicy(policy ClientHealthPolicy) {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	c.health.policy = &policy
+}
+
+// ReportSuccess records a successful request
+func (c *Client) ReportSuccess() { c.health.reportSuccess() }
+
+// ReportFailure records a failed request, the client is quarantined after repeated failures
+func (c *Client) ReportFailure() { c.health.reportFailure(time.Now()) }
+
+// Quarantined tells if the client is quarantined now
+func (c *Client) Quarantined() bool { return c.health.quarantinedAt(time.Now()) }
+
+// HealthStat returns the health of the client
+func (c *Client) HealthStat() ClientHealthStat {
+	stat := c.health.stat()
+	stat.Address = AddressName(c.Addr)
+	return stat
+}
+
+// AddressName returns a readable name of a source address
+func AddressName(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP == nil {
+		return "default"
+	}
+	return addr.String()
+}
@@ -0,0 +1,63 @@
+package cmdlib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientQuarantine(t *testing.T) {
+	now := time.Unix(0, 0)
+	h := &clientHealth{policy: &ClientHealthPolicy{FailuresToQuarantine: 2, BaseQuarantine: time.Minute, MaxQuarantine: 3 * time.Minute}}
+	h.reportFailure(now)
+	if h.quarantinedAt(now) {
+		t.Error("unexpected quarantine after a single failure")
+	}
+	h.reportFailure(now)
+	if !h.quarantinedAt(now) || h.until() != now.Add(time.Minute) {
+		t.Errorf("unexpected quarantine, until: %v", h.until())
+	}
+	now = now.Add(time.Minute)
+	if h.quarantinedAt(now) {
+		t.Error("the quarantine is not over")
+	}
+	h.reportFailure(now)
+	h.reportFailure(now)
+	if h.until() != now.Add(2*time.Minute) {
+		t.Errorf("the quarantine is not doubled, until: %v", h.until())
+	}
+	now = now.Add(2 * time.Minute)
+	h.reportFailure(now)
+	h.reportFailure(now)
+	if h.until() != now.Add(3*time.Minute) {
+		t.Errorf("the quarantine is not limited, until: %v", h.until())
+	}
+	now = now.Add(3 * time.Minute)
+	h.reportSuccess()
+	h.reportFailure(now)
+	h.reportFailure(now)
+	if h.until() != now.Add(time.Minute) {
+		t.Errorf("the quarantine is not reset after a success, until: %v", h.until())
+	}
+	stat := h.stat()
+	if stat.RecentSuccesses != 1 || stat.RecentFailures != 8 || stat.Quarantines != 1 {
+		t.Errorf("unexpected stat: %+v", stat)
+	}
+}
+
+func TestClientsLoopSkipsQuarantined(t *testing.T) {
+	a := HTTPClientWithTimeoutAndAddress(1, "127.0.0.1", false)
+	b := HTTPClientWithTimeoutAndAddress(1, "127.0.0.2", false)
+	a.SetHealthPolicy(ClientHealthPolicy{FailuresToQuarantine: 1, BaseQuarantine: time.Hour, MaxQuarantine: time.Hour})
+	b.SetHealthPolicy(ClientHealthPolicy{FailuresToQuarantine: 1, BaseQuarantine: 2 * time.Hour, MaxQuarantine: 2 * time.Hour})
+	loop := clientsLoop{clients: []*Client{a, b}}
+	a.ReportFailure()
+	for i := 0; i < 3; i++ {
+		if loop.NextClient() != b {
+			t.Error("a quarantined client is returned")
+		}
+	}
+	b.ReportFailure()
+	if loop.NextClient() != a {
+		t.Error("the client released first is expected")
+	}
+}
@@ -1,6 +1,9 @@
 package cmdlib
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 type clientsLoop struct {
 	clients   []*Client
@@ -8,13 +11,24 @@ type clientsLoop struct {
 	mu        sync.Mutex
 }
 
+// NextClient returns the next client skipping quarantined ones,
+// if all the clients are quarantined it returns the one released first
 func (c *clientsLoop) NextClient() *Client {
 	c.mu.Lock()
-	oldIdx := c.clientIdx
-	c.clientIdx++
-	if c.clientIdx == len(c.clients) {
-		c.clientIdx = 0
+	defer c.mu.Unlock()
+	now := time.Now()
+	for range c.clients {
+		client := c.clients[c.clientIdx]
+		c.clientIdx = (c.clientIdx + 1) % len(c.clients)
+		if !client.health.quarantinedAt(now) {
+			return client
+		}
 	}
-	c.mu.Unlock()
-	return c.clients[oldIdx]
+	result := c.clients[0]
+	for _, client := range c.clients[1:] {
+		if client.health.until().Before(result.health.until()) {
+			result = client
+		}
+	}
+	return result
 }
@@ -0,0 +1,54 @@
+package cmdlib
+
+import (
+	"context"
+	"fmt"
+)
+
+// Coverage describes how complete a paginated list of online models is
+type Coverage struct {
+	// Collected is the number of distinct models collected
+	Collected int `json:"collected"`
+	// Total is the number of models reported by the site, zero means it is unknown
+	Total int `json:"total"`
+	// Pages is the number of pages fetched
+	Pages int `json:"pages"`
+}
+
+// CoverageChecker is implemented by the checkers walking paginated lists of online models
+type CoverageChecker interface {
+	endpointChecker
+	CheckEndpointCoverage(ctx context.Context, endpoint string) (onlineModels map[string]StatusKind, info map[string]StreamInfo, coverage Coverage, err error)
+}
+
+// Known tells if the total is reported
+func (c Coverage) Known() bool { return c.Total > 0 }
+
+// Percent returns the percentage of the collected models of the reported total
+func (c Coverage) Percent() float64 {
+	if !c.Known() {
+		return 100
+	}
+	return float64(c.Collected) * 100 / float64(c.Total)
+}
+
+// Trusted tells if the coverage is at least the minimum percentage
+func (c Coverage) Trusted(minPercent float64) bool {
+	return minPercent <= 0 || !c.Known() || c.Percent() >= minPercent
+}
+
+// Add returns the sum of the coverages, the total is unknown if any of the totals is unknown
+func (c Coverage) Add(other Coverage) Coverage {
+	result := Coverage{Collected: c.Collected + other.Collected, Pages: c.Pages + other.Pages}
+	if c.Known() && other.Known() {
+		result.Total = c.Total + other.Total
+	}
+	return result
+}
+
+func (c Coverage) String() string {
+	if !c.Known() {
+		return fmt.Sprintf("%d models, %d pages", c.Collected, c.Pages)
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d), %d pages", c.Percent(), c.Collected, c.Total, c.Pages)
+}
@@ -0,0 +1,168 @@
+package cmdlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EndpointResult represents the result of querying a single endpoint
+type EndpointResult struct {
+	Endpoint string
+	Statuses map[string]StatusKind
+	Info     map[string]StreamInfo
+	// Coverage is reported by the checkers walking paginated lists, it is nil otherwise
+	Coverage *Coverage
+	Err      error
+	// Elapsed is the duration of the query including the retries
+	Elapsed time.Duration
+}
+
+// QueryEndpoints queries every endpoint independently,
+// a failed endpoint is retried with exponential backoff
+func QueryEndpoints(
+	ctx context.Context,
+	c endpointChecker,
+	endpoints []string,
+	retries int,
+	retryDelay time.Duration,
+	dbg bool,
+) []EndpointResult {
+	results := make([]EndpointResult, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		results = append(results, queryEndpoint(ctx, c, endpoint, retries, retryDelay, dbg))
+	}
+	return results
+}
+
+func queryEndpoint(ctx context.Context, c endpointChecker, endpoint string, retries int, retryDelay time.Duration, dbg bool) EndpointResult {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		result := checkEndpoint(ctx, c, endpoint)
+		result.Elapsed = time.Since(start)
+		err := result.Err
+		if err == nil {
+			if dbg {
+				Ldbg("got statuses for endpoint: %d", len(result.Statuses))
+				if result.Coverage != nil {
+					Ldbg("endpoint coverage: %v", *result.Coverage)
+				}
+			}
+			return result
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return EndpointResult{Endpoint: endpoint, Err: ClassifyError(endpoint, err), Elapsed: time.Since(start)}
+		}
+		Lerr("endpoint query failed, retrying in %v, %v", retryDelay, err)
+		if Sleep(ctx, retryDelay) != nil {
+			return EndpointResult{Endpoint: endpoint, Err: ClassifyError(endpoint, err), Elapsed: time.Since(start)}
+		}
+		retryDelay *= 2
+	}
+}
+
+// checkEndpoint queries the endpoint, the result is taken from the response cache of the client if it is not modified
+func checkEndpoint(ctx context.Context, c endpointChecker, endpoint string) EndpointResult {
+	ctx, slot := withEndpointCacheSlot(ctx, endpoint)
+	ctx, capture := withResponseCapture(ctx)
+	result := slot.cachedResult(queryEndpointOnce(ctx, c, endpoint))
+	capture.recordFailure(endpoint, result.Err)
+	return result
+}
+
+func queryEndpointOnce(ctx context.Context, c endpointChecker, endpoint string) EndpointResult {
+	if cc, ok := c.(CoverageChecker); ok {
+		statuses, info, coverage, err := cc.CheckEndpointCoverage(ctx, endpoint)
+		if err != nil {
+			return EndpointResult{Endpoint: endpoint, Err: err}
+		}
+		return EndpointResult{Endpoint: endpoint, Statuses: statuses, Info: info, Coverage: &coverage}
+	}
+	statuses, info, err := c.CheckEndpoint(ctx, endpoint)
+	if err != nil {
+		return EndpointResult{Endpoint: endpoint, Err: err}
+	}
+	return EndpointResult{Endpoint: endpoint, Statuses: statuses, Info: info}
+}
+
+// EndpointsElapsed returns the query durations of the successful endpoints
+func EndpointsElapsed(results []EndpointResult) map[string]time.Duration {
+	result := map[string]time.Duration{}
+	for _, r := range results {
+		if r.Err == nil {
+			result[r.Endpoint] = r.Elapsed
+		}
+	}
+	return result
+}
+
+// EndpointsCoverage returns the total coverage of the successful endpoints reporting it, it is nil if none reports it
+func EndpointsCoverage(results []EndpointResult) *Coverage {
+	var result *Coverage
+	for _, r := range results {
+		if r.Err != nil || r.Coverage == nil {
+			continue
+		}
+		sum := *r.Coverage
+		if result != nil {
+			sum = result.Add(sum)
+		}
+		result = &sum
+	}
+	return result
+}
+
+// MergeEndpointResults merges the results of successful endpoints,
+// it returns an error only if all the endpoints failed
+func MergeEndpointResults(results []EndpointResult) (map[string]StatusKind, map[string]StreamInfo, error) {
+	allStatuses := map[string]StatusKind{}
+	allInfo := map[string]StreamInfo{}
+	var firstErr error
+	for _, r := range results {
+		if r.Err != nil {
+			Lerr("endpoint query failed, %v", r.Err)
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+			continue
+		}
+		for m, s := range r.Statuses {
+			allStatuses[m] = s
+		}
+		for k, v := range r.Info {
+			allInfo[k] = v
+		}
+	}
+	if firstErr != nil && FailedEndpoints(results) == len(results) {
+		return nil, nil, fmt.Errorf("all endpoints failed, %w", firstErr)
+	}
+	return allStatuses, allInfo, nil
+}
+
+// EndpointErrors returns the classified failures of the failed endpoints
+func EndpointErrors(results []EndpointResult) []*CheckerError {
+	var errs []*CheckerError
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, ClassifyError(r.Endpoint, r.Err))
+		}
+	}
+	return errs
+}
+
+// FailedEndpoints returns the number of failed endpoints
+func FailedEndpoints(results []EndpointResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// CheckEndpoints performs queries to all available endpoints,
+// it returns an error only if all the endpoints failed
+func CheckEndpoints(ctx context.Context, c endpointChecker, endpoints []string, dbg bool) (map[string]StatusKind, map[string]StreamInfo, error) {
+	return MergeEndpointResults(QueryEndpoints(ctx, c, endpoints, 0, 0, dbg))
+}
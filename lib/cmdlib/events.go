@@ -0,0 +1,19 @@
+package cmdlib
+
+import "net/http"
+
+// EventUpdater is implemented by the updaters accepting status changes pushed by a site
+//
+// The results are passed to the events callback of the checker config
+// and go through the same pipeline as the results of polling.
+type EventUpdater interface {
+	Updater
+	PushEvents(events []StatusUpdate, info map[string]StreamInfo)
+}
+
+// WebhookChecker is implemented by the checkers receiving status changes over HTTP
+type WebhookChecker interface {
+	Checker
+	// Webhook returns the pattern and the handler to serve, the pattern is empty if webhooks are disabled
+	Webhook() (pattern string, handler http.Handler)
+}
@@ -0,0 +1,286 @@
+package cmdlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailureEntry is a failing response kept for debugging site API changes
+type FailureEntry struct {
+	Time      int64       `json:"time"`
+	Checker   string      `json:"checker"`
+	Kind      string      `json:"kind"`
+	Error     string      `json:"error"`
+	URL       string      `json:"url"`
+	Status    int         `json:"status"`
+	Headers   http.Header `json:"headers"`
+	Body      string      `json:"body"`
+	Truncated bool        `json:"truncated"`
+}
+
+// FailureLog is an on-disk ring buffer of failing responses,
+// it keeps the last entries for each checker and each kind of failure
+type FailureLog struct {
+	mu       sync.Mutex
+	dir      string
+	capacity int
+	maxBody  int
+	next     map[string]int
+}
+
+var failureKeyRegexp = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// secretParams are the query parameters masked in the stored URLs, they are compared in lower case
+var secretParams = map[string]bool{
+	"accesskey":     true,
+	"access_token":  true,
+	"api_key":       true,
+	"apikey":        true,
+	"client_secret": true,
+	"key":           true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// secretHeaders are the response headers not stored
+var secretHeaders = []string{"Set-Cookie", "Set-Cookie2", "Authorization", "Proxy-Authorization", "WWW-Authenticate", "Proxy-Authenticate"}
+
+const redacted = "REDACTED"
+
+// NewFailureLog creates a failure log in the directory
+// keeping capacity entries per checker and kind with the bodies truncated to maxBody bytes
+func NewFailureLog(dir string, capacity int, maxBody int) (*FailureLog, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("wrong failure log capacity %d", capacity)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("cannot create failure log directory, %v", err)
+	}
+	return &FailureLog{dir: dir, capacity: capacity, maxBody: maxBody, next: map[string]int{}}, nil
+}
+
+func failureKey(checker string, kind string) string {
+	return failureKeyRegexp.ReplaceAllString(checker, "_") + "." + failureKeyRegexp.ReplaceAllString(kind, "_")
+}
+
+// Record stores the entry replacing the oldest one of the same checker and kind if the buffer is full
+func (f *FailureLog) Record(entry FailureEntry) error {
+	data, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := failureKey(entry.Checker, entry.Kind)
+	slot, ok := f.next[key]
+	if !ok {
+		slot = f.oldestSlot(key)
+	}
+	f.next[key] = (slot + 1) % f.capacity
+	path := filepath.Join(f.dir, fmt.Sprintf("%s.%d.json", key, slot))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// oldestSlot returns the first free slot or the slot of the oldest entry of the key
+func (f *FailureLog) oldestSlot(key string) int {
+	oldest := 0
+	var oldestTime int64
+	for i := 0; i < f.capacity; i++ {
+		entry, err := readFailureEntry(filepath.Join(f.dir, fmt.Sprintf("%s.%d.json", key, i)))
+		if err != nil {
+			return i
+		}
+		if i == 0 || entry.Time < oldestTime {
+			oldest, oldestTime = i, entry.Time
+		}
+	}
+	return oldest
+}
+
+func readFailureEntry(path string) (*FailureEntry, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var entry FailureEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Entries returns the stored entries newest first,
+// an empty checker or kind matches any
+func (f *FailureLog) Entries(checker string, kind string) ([]FailureEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	files, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var result []FailureEntry
+	for _, file := range files {
+		entry, err := readFailureEntry(file)
+		if err != nil {
+			Lerr("cannot read failure log entry %s, %v", file, err)
+			continue
+		}
+		if (checker == "" || entry.Checker == checker) && (kind == "" || entry.Kind == kind) {
+			result = append(result, *entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time > result[j].Time })
+	return result, nil
+}
+
+// failureScope identifies the checker whose failures are recorded
+type failureScope struct {
+	log     *FailureLog
+	checker string
+}
+
+type failureScopeKey struct{}
+
+// responseCapture keeps the last response received while checking a site
+type responseCapture struct {
+	failureScope
+	mu        sync.Mutex
+	url       string
+	status    int
+	headers   http.Header
+	body      bytes.Buffer
+	truncated bool
+}
+
+type responseCaptureKey struct{}
+
+// captureReader copies the beginning of the body into the capture while it is read
+type captureReader struct {
+	io.ReadCloser
+	capture *responseCapture
+}
+
+func (r captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.write(p[:n])
+	return n, err
+}
+
+// withFailureLog makes the failures of the checks made with the context recorded to the log
+func withFailureLog(ctx context.Context, log *FailureLog, checker string) context.Context {
+	if log == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, failureScopeKey{}, failureScope{log: log, checker: checker})
+}
+
+// withResponseCapture starts a single check capturing its last response
+func withResponseCapture(ctx context.Context) (context.Context, *responseCapture) {
+	scope, ok := ctx.Value(failureScopeKey{}).(failureScope)
+	if !ok {
+		return ctx, nil
+	}
+	capture := &responseCapture{failureScope: scope}
+	return context.WithValue(ctx, responseCaptureKey{}, capture), capture
+}
+
+// captureResponse starts capturing the response if the request is made while checking a site
+func captureResponse(req *http.Request, resp *http.Response) {
+	capture, _ := req.Context().Value(responseCaptureKey{}).(*responseCapture)
+	if capture == nil {
+		return
+	}
+	capture.mu.Lock()
+	capture.url = redactURL(req.URL)
+	capture.status = resp.StatusCode
+	capture.headers = redactHeaders(resp.Header)
+	capture.body.Reset()
+	capture.truncated = false
+	capture.mu.Unlock()
+	resp.Body = captureReader{ReadCloser: resp.Body, capture: capture}
+}
+
+// redactURL returns the URL without the user info and with the secret query parameters masked
+func redactURL(original *url.URL) string {
+	u := *original
+	u.User = nil
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		rawName, _, found := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if found && secretParams[strings.ToLower(name)] {
+			params[i] = rawName + "=" + redacted
+		}
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.String()
+}
+
+// redactHeaders returns a copy of the headers without cookies and authentication
+func redactHeaders(headers http.Header) http.Header {
+	result := headers.Clone()
+	for _, h := range secretHeaders {
+		result.Del(h)
+	}
+	return result
+}
+
+func (c *responseCapture) write(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if left := c.log.maxBody - c.body.Len(); len(p) > left {
+		p = p[:left]
+		c.truncated = true
+	}
+	c.body.Write(p)
+}
+
+// recordFailure stores the captured response along with the failure
+func (c *responseCapture) recordFailure(endpoint string, failure error) {
+	if c == nil || failure == nil {
+		return
+	}
+	err := ClassifyError(endpoint, failure)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status == 0 {
+		return
+	}
+	entry := FailureEntry{
+		Time:      time.Now().Unix(),
+		Checker:   c.checker,
+		Kind:      err.Name(),
+		Error:     err.Error(),
+		URL:       c.url,
+		Status:    c.status,
+		Headers:   c.headers,
+		Body:      strings.ToValidUTF8(c.body.String(), "�"),
+		Truncated: c.truncated,
+	}
+	if err := c.log.Record(entry); err != nil {
+		Lerr("cannot record failure, %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package cmdlib
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testJSONChecker struct {
+	client *Client
+}
+
+func (c *testJSONChecker) CheckEndpoint(ctx context.Context, endpoint string) (map[string]StatusKind, map[string]StreamInfo, error) {
+	resp, buf, err := OnlineQuery(ctx, endpoint, c.client, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, nil, HTTPStatusError(resp.StatusCode)
+	}
+	var models []string
+	if err := json.Unmarshal(buf.Bytes(), &models); err != nil {
+		return nil, nil, ParseError(err)
+	}
+	statuses := map[string]StatusKind{}
+	for _, m := range models {
+		statuses[m] = StatusOnline
+	}
+	return statuses, nil, nil
+}
+
+func TestFailureLog(t *testing.T) {
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{200, `["alice"]`},
+		{200, `{"models": broken`},
+		{502, `bad gateway`},
+		{200, `["alice", broken`},
+		{200, `["alice" broken`},
+	}
+	i := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(responses[i].status)
+		_, _ = w.Write([]byte(responses[i].body))
+		i++
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	log, err := NewFailureLog(dir, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withFailureLog(context.Background(), log, "site")
+	checker := &testJSONChecker{client: &Client{Client: server.Client(), Addr: &net.TCPAddr{}}}
+	for range responses {
+		checkEndpoint(ctx, checker, server.URL)
+	}
+	checkEndpoint(ctx, checker, "http://127.0.0.1:1/unreachable")
+
+	entries, err := log.Entries("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("wrong number of entries, expected: 3, got: %d, %v", len(entries), entries)
+	}
+	parse, _ := log.Entries("site", "parse")
+	if len(parse) != 2 {
+		t.Fatalf("the parse failures are not kept in a ring of two, got: %v", parse)
+	}
+	for _, e := range parse {
+		if e.Status != 200 || e.URL != server.URL || len(e.Body) != 10 || !e.Truncated || e.Headers.Get("Content-Type") != "application/json" {
+			t.Errorf("wrong entry %+v", e)
+		}
+		if e.Body == `{"models":` {
+			t.Errorf("the oldest parse failure is not replaced")
+		}
+	}
+	status, _ := log.Entries("site", "http_status_502")
+	if len(status) != 1 || status[0].Body != "bad gateway"[:10] || status[0].Status != 502 {
+		t.Errorf("wrong status failures %+v", status)
+	}
+	if other, _ := log.Entries("other", ""); len(other) != 0 {
+		t.Errorf("unexpected entries of another checker %v", other)
+	}
+
+	reopened, err := NewFailureLog(dir, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := parse[0]
+	if err := reopened.Record(FailureEntry{Time: newest.Time + 1, Checker: "site", Kind: "parse", Body: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	parse, _ = reopened.Entries("site", "parse")
+	if len(parse) != 2 || (parse[0].Body != "new" && parse[1].Body != "new") {
+		t.Errorf("the reopened log does not replace an entry, got: %v", parse)
+	}
+}
+
+func TestFailureLogRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`["alice", broken`))
+	}))
+	defer server.Close()
+
+	log, err := NewFailureLog(t.TempDir(), 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withFailureLog(context.Background(), log, "site")
+	checker := &testJSONChecker{client: &Client{Client: server.Client(), Addr: &net.TCPAddr{}}}
+	checkEndpoint(ctx, checker, server.URL+"/models?accessKey=key1&limit=10&Client_Secret=secret2&token=token3")
+
+	entries, err := log.Entries("site", "parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("wrong number of entries, expected: 1, got: %v", entries)
+	}
+	expected := server.URL + "/models?accessKey=REDACTED&limit=10&Client_Secret=REDACTED&token=REDACTED"
+	if entries[0].URL != expected {
+		t.Errorf("the URL is not redacted, expected: %s, got: %s", expected, entries[0].URL)
+	}
+	if entries[0].Headers.Get("Set-Cookie") != "" || entries[0].Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("wrong headers %v", entries[0].Headers)
+	}
+}
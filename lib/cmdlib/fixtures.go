@@ -0,0 +1,188 @@
+package cmdlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FixtureMode tells whether a fixture transport records or replays responses
+type FixtureMode int
+
+// Fixture modes
+const (
+	FixtureReplay FixtureMode = iota
+	FixtureRecord
+)
+
+// Fixture represents a recorded HTTP exchange
+type Fixture struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	RequestBody string            `json:"request_body,omitempty"`
+	Status      int               `json:"status"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body"`
+}
+
+// FixtureTransport records HTTP responses to a golden file or replays them offline
+//
+// Requests are matched by their method and URL regardless of the order of the query parameters.
+// Repeated requests are served in the recorded order.
+type FixtureTransport struct {
+	path     string
+	mode     FixtureMode
+	next     http.RoundTripper
+	mu       sync.Mutex
+	fixtures []Fixture
+	used     []bool
+}
+
+// NewFixtureTransport returns a transport replaying the golden file at the path
+// or recording to it using the next transport
+func NewFixtureTransport(path string, mode FixtureMode, next http.RoundTripper) (*FixtureTransport, error) {
+	t := &FixtureTransport{path: path, mode: mode, next: next}
+	if mode == FixtureRecord {
+		if t.next == nil {
+			t.next = http.DefaultTransport
+		}
+		return t, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read fixtures, %v", err)
+	}
+	if err := json.Unmarshal(data, &t.fixtures); err != nil {
+		return nil, fmt.Errorf("cannot parse fixtures %s, %v", path, err)
+	}
+	t.used = make([]bool, len(t.fixtures))
+	return t, nil
+}
+
+// NewFixtureClient returns a client performing its requests through the transport
+func NewFixtureClient(t *FixtureTransport) *Client {
+	return &Client{
+		Client: &http.Client{Transport: t, CheckRedirect: NoRedirect},
+		Addr:   &net.TCPAddr{},
+	}
+}
+
+// normalizedURL returns the URL with sorted query parameters
+func normalizedURL(u *url.URL) string {
+	normalized := *u
+	normalized.RawQuery = u.Query().Encode()
+	return normalized.String()
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == FixtureRecord {
+		return t.record(req)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := normalizedURL(req.URL)
+	for i, f := range t.fixtures {
+		if t.used[i] || f.Method != req.Method {
+			continue
+		}
+		parsed, err := url.Parse(f.URL)
+		if err != nil || normalizedURL(parsed) != u {
+			continue
+		}
+		t.used[i] = true
+		return f.response(req), nil
+	}
+	return nil, fmt.Errorf("no fixture for %s %s", req.Method, req.URL)
+}
+
+func (t *FixtureTransport) record(req *http.Request) (*http.Response, error) {
+	f := Fixture{Method: req.Method, URL: req.URL.String()}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		f.RequestBody = string(data)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseBody(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.Status = resp.StatusCode
+	f.Body = string(data)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		f.Headers = map[string]string{"Content-Type": contentType}
+	}
+	t.mu.Lock()
+	t.fixtures = append(t.fixtures, f)
+	t.mu.Unlock()
+	return f.response(req), nil
+}
+
+func (f Fixture) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	for k, v := range f.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
+
+// Unused returns the fixtures that have not been replayed
+func (t *FixtureTransport) Unused() []Fixture {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mode == FixtureRecord {
+		return nil
+	}
+	var result []Fixture
+	for i, f := range t.fixtures {
+		if !t.used[i] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Save writes the recorded fixtures to the golden file, it does nothing in replay mode
+func (t *FixtureTransport) Save() error {
+	if t.mode != FixtureRecord {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, err := json.MarshalIndent(t.fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,74 @@
+package cmdlib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixtureTransport(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = fmt.Fprintf(w, `{"call": %d}`, calls)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	recorder, err := NewFixtureTransport(path, FixtureRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewFixtureClient(recorder)
+	for _, u := range []string{"/list?b=2&a=1", "/list?b=2&a=1", "/missing"} {
+		if _, _, err := OnlineQuery(context.Background(), server.URL+u, client, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := NewFixtureTransport(path, FixtureReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = NewFixtureClient(replayer)
+	expected := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/list?a=1&b=2", 200, `{"call": 1}`},
+		{"/missing", 404, `{"call": 3}`},
+		{"/list?b=2&a=1", 200, `{"call": 2}`},
+	}
+	for _, e := range expected {
+		resp, buf, err := OnlineQuery(context.Background(), server.URL+e.url, client, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != e.status || buf.String() != e.body {
+			t.Errorf("unexpected response for %s: %d %s", e.url, resp.StatusCode, buf.String())
+		}
+		if resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected headers: %v", resp.Header)
+		}
+	}
+	if _, _, err := OnlineQuery(context.Background(), server.URL+"/list?a=1&b=2", client, nil); err == nil {
+		t.Error("expected an error for an exhausted fixture")
+	}
+	if len(replayer.Unused()) != 0 {
+		t.Errorf("unexpected unused fixtures: %v", replayer.Unused())
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of real requests: %d", calls)
+	}
+}
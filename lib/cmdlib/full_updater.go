@@ -1,23 +1,126 @@
 package cmdlib
 
+import "fmt"
+
+// maxUntrustedMisses is the number of consecutive untrusted lists a retained model can be missing from
+const maxUntrustedMisses = 3
+
 type fullUpdater struct {
 	checker          Checker
 	siteOnlineModels map[string]bool
+	siteSubStates    map[string]SubState
+	endpointsOnline  map[string]map[string]bool
+	endpointsMisses  map[string]map[string]int
+	guard            MassOfflineGuard
+	guardTrips       int
+	minCoverage      float64
 }
 
 func (f *fullUpdater) PushUpdateRequest(updateRequest StatusUpdateRequest) error {
 	return f.checker.PushStatusRequest(fullUpdateReqToStatus(updateRequest, func(res StatusResults) {
 		var updateResults StatusUpdateResults
+		updateResults.Errors = res.Errors
 		if res.Data != nil {
-			online := onlyOnline(res.Data.Statuses)
-			updateResults = StatusUpdateResults{Data: &StatusUpdateResultsData{
-				Updates: getUpdates(f.siteOnlineModels, online),
-				Images:  res.Data.Images,
-				Elapsed: res.Data.Elapsed,
-			}}
+			online, endpointsOnline, endpointsMisses, untrusted := f.onlineRetainingFailedEndpoints(res.Data)
+			updateResults.Errors = append(updateResults.Errors, untrusted...)
+			updates := getUpdates(f.siteOnlineModels, online)
+			offline := len(updates) - countOnline(updates)
+			if f.guard.Trips(len(f.siteOnlineModels), offline) {
+				f.guardTrips++
+				if !f.guard.persists(f.guardTrips) {
+					Lerr("mass offline guard tripped, %d of %d models would go offline", offline, len(f.siteOnlineModels))
+					updateResults.Errors = append(updateResults.Errors, NewCheckerError(ErrorKindIncomplete, "mass offline guard tripped"))
+					updateResults.MassOffline = &MassOfflineDrop{Previous: len(f.siteOnlineModels), Offline: offline}
+					updateRequest.Callback(updateResults)
+					return
+				}
+				Lerr("mass offline guard tripped %d times in a row, accepting the drop of %d of %d models", f.guardTrips, offline, len(f.siteOnlineModels))
+			}
+			f.guardTrips = 0
+			updates, subStates := withSubStates(updates, f.siteOnlineModels, online, f.siteSubStates, res.Data.Info)
+			updateResults.Data = &StatusUpdateResultsData{
+				Updates:  updates,
+				Info:     res.Data.Info,
+				Elapsed:  res.Data.Elapsed,
+				Coverage: EndpointsCoverage(res.Data.Endpoints),
+			}
+			if res.Data.Endpoints != nil {
+				updateResults.Data.EndpointsElapsed = EndpointsElapsed(res.Data.Endpoints)
+			}
 			f.siteOnlineModels = online
+			f.siteSubStates = subStates
+			f.endpointsOnline = endpointsOnline
+			f.endpointsMisses = endpointsMisses
 		}
-		updateResults.Errors = res.Errors
 		updateRequest.Callback(updateResults)
 	}))
 }
+
+// onlineRetainingFailedEndpoints returns online models
+// keeping the models last seen on the endpoints failed this time,
+// all previously online models are kept if a failed endpoint was never seen successful.
+// An endpoint with the coverage below the minimum is untrusted,
+// the models it reports are online but the models missing in it are retained
+// until they are missing in maxUntrustedMisses untrusted lists in a row.
+func (f *fullUpdater) onlineRetainingFailedEndpoints(data *StatusResultsData) (
+	online map[string]bool,
+	endpointsOnline map[string]map[string]bool,
+	endpointsMisses map[string]map[string]int,
+	untrusted []*CheckerError,
+) {
+	online = onlyOnline(data.Statuses)
+	endpointsOnline = make(map[string]map[string]bool, len(f.endpointsOnline))
+	for k, v := range f.endpointsOnline {
+		endpointsOnline[k] = v
+	}
+	endpointsMisses = make(map[string]map[string]int, len(f.endpointsMisses))
+	for k, v := range f.endpointsMisses {
+		endpointsMisses[k] = v
+	}
+	for _, e := range data.Endpoints {
+		trusted := e.Coverage == nil || e.Coverage.Trusted(f.minCoverage)
+		if e.Err == nil && trusted {
+			endpointsOnline[e.Endpoint] = onlyOnline(e.Statuses)
+			delete(endpointsMisses, e.Endpoint)
+			continue
+		}
+		retained, ok := f.endpointsOnline[e.Endpoint]
+		if !ok {
+			retained = f.siteOnlineModels
+		}
+		if e.Err != nil {
+			for k := range retained {
+				online[k] = true
+			}
+			continue
+		}
+		err := &CheckerError{Kind: ErrorKindIncomplete, Endpoint: e.Endpoint, Err: fmt.Errorf("endpoint coverage %v is below %.1f%%", *e.Coverage, f.minCoverage)}
+		Lerr("%v, the models missing in it are retained", err)
+		untrusted = append(untrusted, err)
+		seen := onlyOnline(e.Statuses)
+		misses := map[string]int{}
+		for k := range retained {
+			if seen[k] {
+				continue
+			}
+			if n := f.endpointsMisses[e.Endpoint][k] + 1; n < maxUntrustedMisses {
+				misses[k] = n
+				seen[k] = true
+				online[k] = true
+			}
+		}
+		endpointsOnline[e.Endpoint] = seen
+		endpointsMisses[e.Endpoint] = misses
+	}
+	return online, endpointsOnline, endpointsMisses, untrusted
+}
+
+func countOnline(updates []StatusUpdate) int {
+	result := 0
+	for _, u := range updates {
+		if u.Status == StatusOnline {
+			result++
+		}
+	}
+	return result
+}
@@ -2,11 +2,14 @@ package cmdlib
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"time"
 )
 
@@ -16,6 +19,16 @@ type Client struct {
 	Client *http.Client
 	// Addr is source IP address
 	Addr net.Addr
+	// Limiter limits the rate of the requests made with this client
+	Limiter *RateLimiter
+	// Cache enables conditional online list requests if it is not nil
+	Cache *ResponseCache
+	// Headers are set on every request made with this client overriding the common headers
+	Headers [][2]string
+	// Proxy is the proxy the requests are sent through, it is nil for the clients bound to a source address
+	Proxy *url.URL
+
+	health clientHealth
 }
 
 // NoRedirect tells HTTP client not to redirect
@@ -24,16 +37,23 @@ func NoRedirect(_ *http.Request, _ []*http.Request) error { return http.ErrUseLa
 // HTTPClientWithTimeoutAndAddress returns HTTP client bound to specific IP address
 func HTTPClientWithTimeoutAndAddress(timeoutSeconds int, address string, cookies bool) *Client {
 	addr := &net.TCPAddr{IP: net.ParseIP(address)}
+	return &Client{Client: newHTTPClient(timeoutSeconds, addr, http.ProxyFromEnvironment, cookies), Addr: addr}
+}
+
+func newHTTPClient(timeoutSeconds int, addr *net.TCPAddr, proxy func(*http.Request) (*url.URL, error), cookies bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Second * time.Duration(timeoutSeconds),
+		KeepAlive: 30 * time.Second,
+	}
+	if addr != nil {
+		dialer.LocalAddr = addr
+	}
 	var client = &http.Client{
 		CheckRedirect: NoRedirect,
 		Timeout:       time.Second * time.Duration(timeoutSeconds),
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				LocalAddr: addr,
-				Timeout:   time.Second * time.Duration(timeoutSeconds),
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
 			ForceAttemptHTTP2:     true,
 			MaxIdleConns:          10,
 			IdleConnTimeout:       http.DefaultTransport.(*http.Transport).IdleConnTimeout,
@@ -46,11 +66,36 @@ func HTTPClientWithTimeoutAndAddress(timeoutSeconds int, address string, cookies
 		cookieJar, _ := cookiejar.New(nil)
 		client.Jar = cookieJar
 	}
-	return &Client{Client: client, Addr: addr}
+	return client
+}
+
+// Do performs a request respecting the rate limiter and tracks the health of the client
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.Limiter.Wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("rate limiter error, %w", err)
+	}
+	for _, h := range c.Headers {
+		req.Header.Set(h[0], h[1])
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		if req.Context().Err() == nil {
+			c.ReportFailure()
+		}
+		return nil, err
+	}
+	if failedResponse(resp) {
+		c.ReportFailure()
+	} else {
+		c.ReportSuccess()
+	}
+	captureResponse(req, resp)
+	return resp, nil
 }
 
 // OnlineQuery creates and performs online request
 func OnlineQuery(
+	ctx context.Context,
 	usersOnlineEndpoint string,
 	client *Client,
 	headers [][2]string,
@@ -59,7 +104,7 @@ func OnlineQuery(
 	*bytes.Buffer,
 	error,
 ) {
-	req, err := http.NewRequest("GET", usersOnlineEndpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", usersOnlineEndpoint, nil)
 	CheckErr(err)
 	for _, h := range headers {
 		req.Header.Set(h[0], h[1])
@@ -76,10 +121,12 @@ func OnlineRequest(
 	*bytes.Buffer,
 	error,
 ) {
-	resp, err := client.Client.Do(req)
+	slot := prepareConditional(req, client)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("sending error, %w", err)
 	}
+	slot.recordConditional(resp)
 	defer CloseBody(resp.Body)
 	buf := bytes.Buffer{}
 	_, err = buf.ReadFrom(resp.Body)
@@ -88,3 +135,31 @@ func OnlineRequest(
 	}
 	return resp, &buf, nil
 }
+
+// OnlineStreamQuery creates and performs online request without reading the response,
+// the body fails with ErrResponseTooLarge after maxBytes unless it is zero,
+// the caller should close the body
+func OnlineStreamQuery(
+	ctx context.Context,
+	usersOnlineEndpoint string,
+	client *Client,
+	headers [][2]string,
+	maxBytes int64,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", usersOnlineEndpoint, nil)
+	CheckErr(err)
+	for _, h := range headers {
+		req.Header.Set(h[0], h[1])
+	}
+	slot := prepareConditional(req, client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending error, %w", err)
+	}
+	slot.recordConditional(resp)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{MaxBytesReader(resp.Body, maxBytes), resp.Body}
+	return resp, nil
+}
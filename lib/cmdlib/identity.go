@@ -0,0 +1,13 @@
+package cmdlib
+
+import "context"
+
+// IdentityChecker is implemented by the checkers of the sites with stable user IDs
+//
+// The IDs known to the checker are passed in the checker config.
+type IdentityChecker interface {
+	Checker
+	// CheckIdentities checks if the models exist,
+	// it returns the user IDs of the found models and the new model IDs of the renamed ones
+	CheckIdentities(ctx context.Context, modelIDs []string) (statuses map[string]StatusKind, userIDs map[string]string, renames map[string]string, err error)
+}
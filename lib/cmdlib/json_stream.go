@@ -0,0 +1,130 @@
+package cmdlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrResponseTooLarge emerges whenever a response exceeds the configured size
+var ErrResponseTooLarge = errors.New("response is too large")
+
+// maxBytesReader fails with ErrResponseTooLarge instead of silently truncating the response
+type maxBytesReader struct {
+	r io.Reader
+	n int64
+}
+
+// MaxBytesReader returns a reader failing as soon as more than n bytes are read,
+// n equal to zero means no limit
+func MaxBytesReader(r io.Reader, n int64) io.Reader {
+	if n == 0 {
+		return r
+	}
+	return &maxBytesReader{r: r, n: n}
+}
+
+func (l *maxBytesReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		n = int(l.n)
+		l.n = -1
+		return n, ErrResponseTooLarge
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// DecodeJSONArray walks to the array at the path of object keys
+// and calls element for every its element,
+// element should consume exactly one value from the decoder.
+// The elements are decoded one by one without reading the whole response into memory.
+func DecodeJSONArray(decoder *json.Decoder, path []string, element func() error) error {
+	for _, key := range path {
+		if err := expectDelim(decoder, '{'); err != nil {
+			return err
+		}
+		for {
+			if !decoder.More() {
+				return fmt.Errorf("cannot find %q", key)
+			}
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if token == key {
+				break
+			}
+			if err := SkipJSONValue(decoder); err != nil {
+				return err
+			}
+		}
+	}
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+// DecodeJSONObject calls field for every key of the object,
+// field should consume exactly one value from the decoder,
+// SkipJSONValue skips the values of unknown keys
+func DecodeJSONObject(decoder *json.Decoder, field func(key string) error) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+// SkipJSONValue skips the next value without keeping it in memory
+func SkipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
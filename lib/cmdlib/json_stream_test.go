@@ -0,0 +1,76 @@
+package cmdlib
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeNames(data string, path []string) ([]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	var names []string
+	err := DecodeJSONArray(decoder, path, func() error {
+		var m struct{ Name string }
+		if err := decoder.Decode(&m); err != nil {
+			return err
+		}
+		names = append(names, m.Name)
+		return nil
+	})
+	return names, err
+}
+
+func TestDecodeJSONArray(t *testing.T) {
+	names, err := decodeNames(`[{"name": "alice"}, {"name": "bob"}]`, nil)
+	if err != nil || !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+		t.Errorf("unexpected result %v %v", names, err)
+	}
+	data := `{"status": {"code": [1, {"x": []}]}, "data": {"total": 2, "models": [{"name": "alice"}]}}`
+	names, err = decodeNames(data, []string{"data", "models"})
+	if err != nil || !reflect.DeepEqual(names, []string{"alice"}) {
+		t.Errorf("unexpected result %v %v", names, err)
+	}
+	names, err = decodeNames(`[]`, nil)
+	if err != nil || names != nil {
+		t.Errorf("unexpected result %v %v", names, err)
+	}
+	wrong := []struct {
+		data string
+		path []string
+	}{
+		{`{"data": []}`, nil},
+		{`{"data": []}`, []string{"models"}},
+		{`{"data": {}}`, []string{"data"}},
+		{`[{"name": "alice"}`, nil},
+		{`[1]`, nil},
+	}
+	for _, w := range wrong {
+		if _, err := decodeNames(w.data, w.path); err == nil {
+			t.Errorf("expected an error for %s", w.data)
+		}
+	}
+}
+
+func TestMaxBytesReader(t *testing.T) {
+	data := strings.Repeat("x", 100)
+	if read, err := io.ReadAll(MaxBytesReader(strings.NewReader(data), 100)); err != nil || len(read) != 100 {
+		t.Errorf("unexpected result %d %v", len(read), err)
+	}
+	if read, err := io.ReadAll(MaxBytesReader(strings.NewReader(data), 0)); err != nil || len(read) != 100 {
+		t.Errorf("unexpected result %d %v", len(read), err)
+	}
+	if read, err := io.ReadAll(MaxBytesReader(strings.NewReader(data), 99)); !errors.Is(err, ErrResponseTooLarge) || len(read) != 99 {
+		t.Errorf("unexpected result %d %v", len(read), err)
+	}
+	decoder := json.NewDecoder(MaxBytesReader(strings.NewReader(`[{"name": "alice"}, {"name": "bob"}]`), 20))
+	err := DecodeJSONArray(decoder, nil, func() error {
+		var m struct{ Name string }
+		return decoder.Decode(&m)
+	})
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package cmdlib
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HTTPClientWithTimeoutAndProxy returns HTTP client sending its requests through the proxy,
+// HTTP, HTTPS and SOCKS5 proxies are supported, the credentials are taken from the URL
+func HTTPClientWithTimeoutAndProxy(timeoutSeconds int, proxy *url.URL, cookies bool) *Client {
+	return &Client{
+		Client: newHTTPClient(timeoutSeconds, nil, http.ProxyURL(proxy), cookies),
+		Addr:   proxyAddr{proxy},
+		Proxy:  proxy,
+	}
+}
+
+// proxyAddr identifies a proxy client in the logs and the statistics without its credentials
+type proxyAddr struct{ url *url.URL }
+
+func (a proxyAddr) Network() string { return "proxy" }
+func (a proxyAddr) String() string  { return a.url.Scheme + "://" + a.url.Host }
+
+// Dial opens a TCP connection to the address through the proxy of the client or from its source address
+func (c *Client) Dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	if c.Proxy == nil {
+		dialer.LocalAddr = c.Addr
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	switch c.Proxy.Scheme {
+	case "https":
+		conn = tls.Client(conn, &tls.Config{ServerName: c.Proxy.Hostname(), MinVersion: tls.VersionTLS12})
+		err = connectHTTPProxy(conn, c.Proxy, address)
+	case "http":
+		err = connectHTTPProxy(conn, c.Proxy, address)
+	case "socks5":
+		err = connectSOCKS5Proxy(conn, c.Proxy, address)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %s", c.Proxy.Scheme)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func connectHTTPProxy(conn net.Conn, proxy *url.URL, address string) error {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// the proxy does not send anything after the response until the client speaks
+	resp, err := http.ReadResponse(bufio.NewReaderSize(conn, 1), req)
+	if err != nil {
+		return err
+	}
+	CloseBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy returns status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// connectSOCKS5Proxy performs SOCKS5 handshake as described in RFC 1928 and RFC 1929
+func connectSOCKS5Proxy(conn net.Conn, proxy *url.URL, address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return err
+	}
+	method := byte(0)
+	if proxy.User != nil {
+		method = 2
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("SOCKS5 proxy does not accept the authentication method")
+	}
+	if method == 2 {
+		password, _ := proxy.User.Password()
+		username := proxy.User.Username()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 credentials are too long")
+		}
+		auth := append([]byte{1, byte(len(username))}, username...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 proxy rejects the credentials")
+		}
+	}
+	request := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("the host name is too long")
+		}
+		request = append(append(request, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(append(request, 1), ip4...)
+	} else {
+		request = append(append(request, 4), ip.To16()...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("SOCKS5 proxy fails to connect, code %d", header[1])
+	}
+	var skip int
+	switch header[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return errors.New("SOCKS5 proxy returns unknown address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
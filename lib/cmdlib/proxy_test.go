@@ -0,0 +1,182 @@
+package cmdlib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func splice(a net.Conn, b net.Conn) {
+	go func() {
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+	_, _ = io.Copy(b, a)
+	_ = b.Close()
+}
+
+// testHTTPProxy forwards plain requests and tunnels CONNECT requests checking the credentials
+func testHTTPProxy(t *testing.T) *httptest.Server {
+	credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != credentials {
+			http.Error(w, "wrong credentials", http.StatusProxyAuthRequired)
+			return
+		}
+		if r.Method == "CONNECT" {
+			upstream, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+			splice(conn, upstream)
+			return
+		}
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer CloseBody(resp.Body)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+}
+
+// testSOCKS5Proxy serves SOCKS5 connections authenticated with user:pass
+func testSOCKS5Proxy(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(conn net.Conn) {
+		buf := make([]byte, 262)
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			_ = conn.Close()
+			return
+		}
+		methods := make([]byte, buf[1])
+		if _, err := io.ReadFull(conn, methods); err != nil || !bytes.Contains(methods, []byte{2}) {
+			_ = conn.Close()
+			return
+		}
+		_, _ = conn.Write([]byte{5, 2})
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			_ = conn.Close()
+			return
+		}
+		user := make([]byte, buf[1])
+		_, _ = io.ReadFull(conn, user)
+		_, _ = io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		_, _ = io.ReadFull(conn, pass)
+		if string(user) != "user" || string(pass) != "pass" {
+			_, _ = conn.Write([]byte{1, 1})
+			_ = conn.Close()
+			return
+		}
+		_, _ = conn.Write([]byte{1, 0})
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[3] != 1 {
+			_ = conn.Close()
+			return
+		}
+		_, _ = io.ReadFull(conn, buf[:6])
+		address := net.JoinHostPort(net.IP(buf[:4]).String(), strconv.Itoa(int(buf[4])<<8|int(buf[5])))
+		upstream, err := net.Dial("tcp", address)
+		if err != nil {
+			_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			_ = conn.Close()
+			return
+		}
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		splice(conn, upstream)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return listener
+}
+
+func TestProxyClients(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Egress"))
+	}))
+	defer backend.Close()
+	httpProxy := testHTTPProxy(t)
+	defer httpProxy.Close()
+	socksProxy := testSOCKS5Proxy(t)
+	defer func() { _ = socksProxy.Close() }()
+
+	proxies := []string{
+		"http://user:pass@" + httpProxy.Listener.Addr().String(),
+		"socks5://user:pass@" + socksProxy.Addr().String(),
+	}
+	for _, p := range proxies {
+		proxyURL, err := url.Parse(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := HTTPClientWithTimeoutAndProxy(5, proxyURL, false)
+		client.Headers = [][2]string{{"X-Egress", proxyURL.Scheme}}
+		if name := AddressName(client.Addr); name != proxyURL.Scheme+"://"+proxyURL.Host {
+			t.Errorf("wrong address name %s", name)
+		}
+
+		req, err := http.NewRequest("GET", backend.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		CloseBody(resp.Body)
+		if resp.StatusCode != 200 || string(body) != proxyURL.Scheme {
+			t.Errorf("unexpected response through %s, %d %q", proxyURL.Scheme, resp.StatusCode, body)
+		}
+
+		conn, err := client.Dial(context.Background(), backend.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("cannot dial through %s, %v", proxyURL.Scheme, err)
+		}
+		_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: backend\r\nX-Egress: tunnel\r\nConnection: close\r\n\r\n")
+		resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		_ = conn.Close()
+		if string(body) != "tunnel" {
+			t.Errorf("unexpected tunneled response through %s, %q", proxyURL.Scheme, body)
+		}
+
+		proxyURL.User = url.UserPassword("user", "wrong")
+		if conn, err := HTTPClientWithTimeoutAndProxy(5, proxyURL, false).Dial(context.Background(), backend.Listener.Addr().String()); err == nil {
+			_ = conn.Close()
+			t.Errorf("wrong credentials are accepted by %s", proxyURL.Scheme)
+		}
+	}
+}
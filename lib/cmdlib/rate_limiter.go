@@ -0,0 +1,80 @@
+package cmdlib
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter implements a token bucket
+//
+// The bucket holds up to burst tokens and is refilled with rps tokens per second.
+// A nil rate limiter does not limit anything.
+type RateLimiter struct {
+	rps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// NewRateLimiter returns a rate limiter allowing rps requests per second with the burst,
+// it returns nil if rps is not positive
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rps: rps, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// Burst returns the number of requests allowed at once, it is one for a nil rate limiter
+func (l *RateLimiter) Burst() int {
+	if l == nil {
+		return 1
+	}
+	return int(l.burst)
+}
+
+// reserve takes a token and returns the duration to wait before using it
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rps * float64(time.Second))
+}
+
+// cancel returns an unused token
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
+
+// Wait blocks until a request is allowed or the context is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	delay := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+	if err := Sleep(ctx, delay); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
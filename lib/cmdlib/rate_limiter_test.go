@@ -0,0 +1,50 @@
+package cmdlib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Errorf("unexpected delay within the burst: %v", d)
+		}
+	}
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("unexpected delay: %v", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("unexpected delay: %v", d)
+	}
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Errorf("unexpected delay after refilling: %v", d)
+		}
+	}
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("unexpected delay: %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("the token is not returned on cancellation, delay: %v", d)
+	}
+
+	var unlimited *RateLimiter
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if NewRateLimiter(0, 1) != nil {
+		t.Error("expected no limiter for zero rate")
+	}
+}
@@ -0,0 +1,131 @@
+package cmdlib
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// ResponseCache keeps the validators and the parsed snapshots of the online lists queried by a client,
+// so an unchanged list is neither downloaded nor parsed again
+type ResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]*responseCacheEntry
+	hits    int
+	misses  int
+}
+
+type responseCacheEntry struct {
+	etag         string
+	lastModified string
+	result       EndpointResult
+}
+
+// endpointCacheSlot collects the details of the requests made while checking a single endpoint
+type endpointCacheSlot struct {
+	endpoint     string
+	requests     int
+	client       *Client
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+type endpointCacheSlotKey struct{}
+
+// NewResponseCache creates an empty response cache
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{entries: map[string]*responseCacheEntry{}}
+}
+
+// HitRate returns the number of not modified responses and the number of all cacheable responses
+func (r *ResponseCache) HitRate() (hits int, total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hits, r.hits + r.misses
+}
+
+func (r *ResponseCache) entry(endpoint string) *responseCacheEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entries[endpoint]
+}
+
+func (r *ResponseCache) store(endpoint string, entry *responseCacheEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[endpoint] = entry
+}
+
+func (r *ResponseCache) count(notModified bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if notModified {
+		r.hits++
+	} else {
+		r.misses++
+	}
+}
+
+func withEndpointCacheSlot(ctx context.Context, endpoint string) (context.Context, *endpointCacheSlot) {
+	slot := &endpointCacheSlot{endpoint: endpoint}
+	return context.WithValue(ctx, endpointCacheSlotKey{}, slot), slot
+}
+
+// prepareConditional adds the validators of the last snapshot to the request,
+// only the first request of an endpoint check can be conditional
+func prepareConditional(req *http.Request, client *Client) *endpointCacheSlot {
+	slot, _ := req.Context().Value(endpointCacheSlotKey{}).(*endpointCacheSlot)
+	if slot == nil {
+		return nil
+	}
+	slot.requests++
+	if slot.requests != 1 || client.Cache == nil || req.Method != "GET" || req.URL.String() != slot.endpoint {
+		return nil
+	}
+	slot.client = client
+	if entry := client.Cache.entry(slot.endpoint); entry != nil {
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if entry.lastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+	return slot
+}
+
+// recordConditional remembers the validators of the response or that it is not modified
+func (s *endpointCacheSlot) recordConditional(resp *http.Response) {
+	if s == nil {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		s.notModified = true
+	case http.StatusOK:
+		s.etag = resp.Header.Get("ETag")
+		s.lastModified = resp.Header.Get("Last-Modified")
+	default:
+		return
+	}
+	s.client.Cache.count(s.notModified)
+}
+
+// cachedResult returns the last snapshot if the endpoint is not modified,
+// otherwise it stores the result along with its validators
+func (s *endpointCacheSlot) cachedResult(result EndpointResult) EndpointResult {
+	if s.client == nil {
+		return result
+	}
+	if s.notModified {
+		if entry := s.client.Cache.entry(s.endpoint); entry != nil {
+			return entry.result
+		}
+		return result
+	}
+	if result.Err == nil && s.requests == 1 && (s.etag != "" || s.lastModified != "") {
+		s.client.Cache.store(s.endpoint, &responseCacheEntry{etag: s.etag, lastModified: s.lastModified, result: result})
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package cmdlib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testListChecker struct {
+	client *Client
+	parsed int
+}
+
+func (c *testListChecker) CheckEndpoint(ctx context.Context, endpoint string) (map[string]StatusKind, map[string]StreamInfo, error) {
+	resp, buf, err := OnlineQuery(ctx, endpoint, c.client, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, nil, fmt.Errorf("query status, %d", resp.StatusCode)
+	}
+	c.parsed++
+	statuses := map[string]StatusKind{}
+	for _, m := range strings.Fields(buf.String()) {
+		statuses[m] = StatusOnline
+	}
+	return statuses, nil, nil
+}
+
+func TestResponseCache(t *testing.T) {
+	var mu sync.Mutex
+	list := "alice bob"
+	version := 1
+	full := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := fmt.Sprintf(`"%d"`, version)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(list))
+	}))
+	defer server.Close()
+	client := &Client{Client: server.Client(), Addr: &net.TCPAddr{}, Cache: NewResponseCache()}
+	checker := &testListChecker{client: client}
+	check := func() map[string]StatusKind {
+		t.Helper()
+		statuses, _, err := CheckEndpoints(context.Background(), checker, []string{server.URL}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return statuses
+	}
+
+	expected := map[string]StatusKind{"alice": StatusOnline, "bob": StatusOnline}
+	for i := 0; i < 3; i++ {
+		if got := check(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("wrong statuses, expected: %v, got: %v", expected, got)
+		}
+	}
+	if full != 1 || checker.parsed != 1 {
+		t.Errorf("the list is not cached, downloaded: %d, parsed: %d", full, checker.parsed)
+	}
+	if hits, total := client.Cache.HitRate(); hits != 2 || total != 3 {
+		t.Errorf("wrong hit rate %d/%d", hits, total)
+	}
+
+	mu.Lock()
+	list = "carol"
+	version++
+	mu.Unlock()
+	expected = map[string]StatusKind{"carol": StatusOnline}
+	if got := check(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong statuses, expected: %v, got: %v", expected, got)
+	}
+	if got := check(); !reflect.DeepEqual(got, expected) || full != 2 || checker.parsed != 2 {
+		t.Errorf("the new list is not cached, got: %v, downloaded: %d, parsed: %d", got, full, checker.parsed)
+	}
+
+	other := &testListChecker{client: &Client{Client: server.Client(), Addr: &net.TCPAddr{}, Cache: NewResponseCache()}}
+	if _, _, err := CheckEndpoints(context.Background(), other, []string{server.URL}, false); err != nil || other.parsed != 1 {
+		t.Errorf("the cache is shared between clients, parsed: %d, %v", other.parsed, err)
+	}
+}
@@ -1,18 +1,31 @@
 package cmdlib
 
+import "sync"
+
+// selectiveUpdater queries the statuses of subscribed models,
+// it also accepts the status changes pushed by a site in between,
+// the results of both are delivered in order
 type selectiveUpdater struct {
 	checker          Checker
+	mu               sync.Mutex
 	siteOnlineModels map[string]bool
+	siteSubStates    map[string]SubState
+	info             map[string]StreamInfo
 	knowns           map[string]bool
+	eventsCallback   func(StatusUpdateResults)
 }
 
+var _ EventUpdater = &selectiveUpdater{}
+
 func (f *selectiveUpdater) PushUpdateRequest(updateRequest StatusUpdateRequest) error {
 	subsSet := subscriptionsSet(updateRequest.Subscriptions)
 	return f.checker.PushStatusRequest(selectiveUpdateReqToStatus(updateRequest, func(res StatusResults) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
 		var updateResults StatusUpdateResults
 		if res.Data != nil {
 			online := onlyOnline(res.Data.Statuses)
-			unfilteredUpdates := getUpdates(f.siteOnlineModels, online)
+			unfilteredUpdates, subStates := withSubStates(getUpdates(f.siteOnlineModels, online), f.siteOnlineModels, online, f.siteSubStates, res.Data.Info)
 			var updates []StatusUpdate
 			for _, x := range unfilteredUpdates {
 				if subsSet[x.ModelID] {
@@ -20,6 +33,8 @@ func (f *selectiveUpdater) PushUpdateRequest(updateRequest StatusUpdateRequest)
 				}
 			}
 			f.siteOnlineModels = online
+			f.siteSubStates = subStates
+			f.info = res.Data.Info
 			_, unknowns := HashDiffNewRemoved(f.knowns, subsSet)
 			f.knowns = subsSet
 			for _, u := range unknowns {
@@ -27,7 +42,7 @@ func (f *selectiveUpdater) PushUpdateRequest(updateRequest StatusUpdateRequest)
 			}
 			updateResults = StatusUpdateResults{Data: &StatusUpdateResultsData{
 				Updates: updates,
-				Images:  res.Data.Images,
+				Info:    res.Data.Info,
 				Elapsed: res.Data.Elapsed,
 			}}
 			f.siteOnlineModels = online
@@ -37,6 +52,49 @@ func (f *selectiveUpdater) PushUpdateRequest(updateRequest StatusUpdateRequest)
 	}))
 }
 
+// PushEvents applies the status changes pushed by a site to the last known statuses,
+// the updates of subscribed models are passed to the events callback
+func (f *selectiveUpdater) PushEvents(events []StatusUpdate, info map[string]StreamInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.eventsCallback == nil {
+		return
+	}
+	online := map[string]bool{}
+	for k := range f.siteOnlineModels {
+		online[k] = true
+	}
+	nextInfo := map[string]StreamInfo{}
+	for k, v := range f.info {
+		nextInfo[k] = v
+	}
+	for _, e := range events {
+		if e.Status == StatusOnline {
+			online[e.ModelID] = true
+			if i, found := info[e.ModelID]; found {
+				nextInfo[e.ModelID] = i
+			}
+		} else {
+			delete(online, e.ModelID)
+			delete(nextInfo, e.ModelID)
+		}
+	}
+	unfilteredUpdates, subStates := withSubStates(getUpdates(f.siteOnlineModels, online), f.siteOnlineModels, online, f.siteSubStates, nextInfo)
+	var updates []StatusUpdate
+	for _, x := range unfilteredUpdates {
+		if f.knowns[x.ModelID] {
+			updates = append(updates, x)
+		}
+	}
+	f.siteOnlineModels = online
+	f.siteSubStates = subStates
+	f.info = nextInfo
+	if len(updates) == 0 {
+		return
+	}
+	f.eventsCallback(StatusUpdateResults{Data: &StatusUpdateResultsData{Updates: updates, Info: nextInfo}})
+}
+
 func selectKnowns(xs map[string]StatusKind) map[string]bool {
 	result := map[string]bool{}
 	for k, v := range xs {
@@ -33,3 +33,32 @@ func (s StatusKind) String() string {
 	}
 	return strings.Join(words, "|")
 }
+
+// SubState represents a kind of show of an online model
+type SubState int
+
+// Show kinds of online models
+const (
+	SubStateUnknown  SubState = 0
+	SubStatePublic   SubState = 1
+	SubStatePrivate  SubState = 2
+	SubStateGroup    SubState = 3
+	SubStateHidden   SubState = 4
+	SubStatePassword SubState = 5
+)
+
+func (s SubState) String() string {
+	switch s {
+	case SubStatePublic:
+		return "public"
+	case SubStatePrivate:
+		return "private"
+	case SubStateGroup:
+		return "group"
+	case SubStateHidden:
+		return "hidden"
+	case SubStatePassword:
+		return "password"
+	}
+	return "unknown"
+}
@@ -56,6 +56,7 @@ type Translations struct {
 	Online                      *Translation `yaml:"online"`
 	List                        *Translation `yaml:"list"`
 	Offline                     *Translation `yaml:"offline"`
+	SubState                    *Translation `yaml:"sub_state"`
 	Denied                      *Translation `yaml:"denied"`
 	SyntaxAdd                   *Translation `yaml:"syntax_add"`
 	SyntaxRemove                *Translation `yaml:"syntax_remove"`
@@ -66,6 +67,7 @@ type Translations struct {
 	ModelAdded                  *Translation `yaml:"model_added"`
 	ModelNotInList              *Translation `yaml:"model_not_in_list"`
 	ModelRemoved                *Translation `yaml:"model_removed"`
+	ModelRenamed                *Translation `yaml:"model_renamed"`
 	CheckingModel               *Translation `yaml:"checking_model"`
 	Feedback                    *Translation `yaml:"feedback"`
 	Social                      *Translation `yaml:"social"`
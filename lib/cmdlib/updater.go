@@ -17,21 +17,64 @@ type StatusUpdateRequest struct {
 
 // StatusUpdate represents an update of model status
 type StatusUpdate struct {
-	ModelID string
-	Status  StatusKind
+	ModelID  string
+	Status   StatusKind
+	SubState SubState
 }
 
 // StatusUpdateResultsData contains data from updates checking algorithm
 type StatusUpdateResultsData struct {
 	Updates []StatusUpdate
-	Images  map[string]string
+	Info    map[string]StreamInfo
 	Elapsed time.Duration
+	// Coverage is the total coverage of the paginated endpoints, it is nil if none is paginated
+	Coverage *Coverage
+	// EndpointsElapsed contains the query durations of the successful endpoints, it is nil if the checker does not query endpoints
+	EndpointsElapsed map[string]time.Duration
 }
 
 // StatusUpdateResults contains results from updates checking algorithm
 type StatusUpdateResults struct {
-	Data   *StatusUpdateResultsData
-	Errors int
+	Data        *StatusUpdateResultsData
+	Errors      []*CheckerError
+	MassOffline *MassOfflineDrop
+}
+
+// MassOfflineDrop describes a drop of online models rejected by the mass offline guard
+type MassOfflineDrop struct {
+	Previous int
+	Offline  int
+}
+
+// MassOfflineGuard limits the number of models going offline in a single update
+type MassOfflineGuard struct {
+	// Count is the maximum number of models going offline at once, zero means no limit
+	Count int
+	// Percent is the maximum percentage of online models going offline at once, zero means no limit
+	Percent float64
+	// Polls is the number of consecutive rejected updates after which the drop is accepted,
+	// zero means DefaultMassOfflineGuardPolls
+	Polls int
+}
+
+// DefaultMassOfflineGuardPolls is the default number of consecutive rejected updates after which the drop is accepted
+const DefaultMassOfflineGuardPolls = 3
+
+// Trips tells if the guard rejects the update
+func (g MassOfflineGuard) Trips(previous int, offline int) bool {
+	if g.Count > 0 && offline > g.Count {
+		return true
+	}
+	return g.Percent > 0 && previous > 0 && float64(offline)*100 > g.Percent*float64(previous)
+}
+
+// persists tells if the drop rejected this number of times in a row should be accepted
+func (g MassOfflineGuard) persists(trips int) bool {
+	polls := g.Polls
+	if polls == 0 {
+		polls = DefaultMassOfflineGuardPolls
+	}
+	return trips >= polls
 }
 
 func getUpdates(prev, next map[string]bool) []StatusUpdate {
@@ -46,6 +89,37 @@ func getUpdates(prev, next map[string]bool) []StatusUpdate {
 	return result
 }
 
+// withSubStates sets the sub-states of the models coming online
+// and adds the updates for the models staying online with a changed sub-state,
+// it also returns the known sub-states of online models
+func withSubStates(
+	updates []StatusUpdate,
+	prevOnline map[string]bool,
+	online map[string]bool,
+	prevSubStates map[string]SubState,
+	info map[string]StreamInfo,
+) ([]StatusUpdate, map[string]SubState) {
+	for i, u := range updates {
+		if u.Status == StatusOnline {
+			updates[i].SubState = info[u.ModelID].SubState
+		}
+	}
+	subStates := map[string]SubState{}
+	for modelID := range online {
+		next := info[modelID].SubState
+		prev := prevSubStates[modelID]
+		if next == SubStateUnknown {
+			next = prev
+		} else if prevOnline[modelID] && next != prev {
+			updates = append(updates, StatusUpdate{ModelID: modelID, Status: StatusOnline, SubState: next})
+		}
+		if next != SubStateUnknown {
+			subStates[modelID] = next
+		}
+	}
+	return updates, subStates
+}
+
 func fullUpdateReqToStatus(r StatusUpdateRequest, callback func(StatusResults)) StatusRequest {
 	var specific map[string]bool
 	if r.Specific != nil {
@@ -1,18 +1,26 @@
 package cmdlib
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type TestChecker struct {
 	CheckerCommon
 	status StatusKind
-	online map[string]bool   //nolint:structcheck
-	images map[string]string //nolint:structcheck
-	err    error             //nolint:structcheck
+	online map[string]bool       //nolint:structcheck
+	info   map[string]StreamInfo //nolint:structcheck
+	err    error                 //nolint:structcheck
+	block  bool                  //nolint:structcheck
+	// started is notified when a blocking check starts
+	started chan bool //nolint:structcheck
 }
 
 type testFullChecker struct {
@@ -25,42 +33,49 @@ type testSelectiveChecker struct {
 
 var queueSize = 1000
 
-func (c *TestChecker) CheckStatusSingle(string) StatusKind {
-	return c.status
+func (c *TestChecker) CheckStatusSingle(context.Context, string) (StatusKind, StreamInfo) {
+	return c.status, StreamInfo{}
 }
 
-func (c *testSelectiveChecker) CheckStatusesMany(QueryModelList, CheckMode) (onlineModels map[string]StatusKind, images map[string]string, err error) {
+func (c *testSelectiveChecker) CheckStatusesMany(context.Context, QueryModelList, CheckMode) (onlineModels map[string]StatusKind, info map[string]StreamInfo, err error) {
 	if c.err != nil {
 		return nil, nil, c.err
 	}
-	return onlineStatuses(c.online), c.images, nil
+	return onlineStatuses(c.online), c.info, nil
 }
 
-func (c *testFullChecker) CheckEndpoint(_ string) (onlineModels map[string]StatusKind, images map[string]string, err error) {
+func (c *testFullChecker) CheckEndpoint(ctx context.Context, _ string) (onlineModels map[string]StatusKind, info map[string]StreamInfo, err error) {
+	if c.block {
+		if c.started != nil {
+			c.started <- true
+		}
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	}
 	if c.err != nil {
 		return nil, nil, c.err
 	}
-	return onlineStatuses(c.online), c.images, nil
+	return onlineStatuses(c.online), c.info, nil
 }
 
-func (c *testFullChecker) CheckStatusesMany(QueryModelList, CheckMode) (onlineModels map[string]StatusKind, images map[string]string, err error) {
-	return CheckEndpoints(c, c.UsersOnlineEndpoints, c.Dbg)
+func (c *testFullChecker) CheckStatusesMany(ctx context.Context, _ QueryModelList, _ CheckMode) (onlineModels map[string]StatusKind, info map[string]StreamInfo, err error) {
+	return CheckEndpoints(ctx, c, c.UsersOnlineEndpoints, c.Dbg)
 }
 
 // Start starts a daemon
-func (c *testFullChecker) Start()                 { c.StartFullCheckerDaemon(c) }
-func (c *testFullChecker) CreateUpdater() Updater { return c.CreateFullUpdater(c) }
+func (c *testFullChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
+func (c *testFullChecker) CreateUpdater() Updater    { return c.CreateFullUpdater(c) }
 
 // Start starts a daemon
-func (c *testSelectiveChecker) Start()                 { c.StartSelectiveCheckerDaemon(c) }
-func (c *testSelectiveChecker) CreateUpdater() Updater { return c.CreateSelectiveUpdater(c) }
+func (c *testSelectiveChecker) Start(ctx context.Context) { c.StartSelectiveCheckerDaemon(ctx, c) }
+func (c *testSelectiveChecker) CreateUpdater() Updater    { return c.CreateSelectiveUpdater(c) }
 
 func TestFullUpdater(t *testing.T) {
 	checker := &testFullChecker{}
 	checker.Init(checker, CheckerConfig{UsersOnlineEndpoints: []string{""}, QueueSize: queueSize, SiteOnlineModels: toSet("a", "b")})
 	resultsCh := make(chan StatusUpdateResults)
 	callback := func(res StatusUpdateResults) { resultsCh <- res }
-	checker.Start()
+	checker.Start(context.Background())
 	up := checker.Updater()
 	checker.online = toSet("b", "c")
 	if err := up.PushUpdateRequest(StatusUpdateRequest{Callback: callback, Subscriptions: map[string]StatusKind{}}); err != nil {
@@ -106,6 +121,16 @@ func TestFullUpdater(t *testing.T) {
 	}
 }
 
+func TestIsFullChecker(t *testing.T) {
+	full := &testFullChecker{}
+	full.Init(full, CheckerConfig{QueueSize: queueSize})
+	selective := &testSelectiveChecker{}
+	selective.Init(selective, CheckerConfig{QueueSize: queueSize})
+	if !IsFullChecker(full) || IsFullChecker(selective) {
+		t.Error("wrong checker kind")
+	}
+}
+
 func TestSelectiveUpdater(t *testing.T) {
 	checker := &testSelectiveChecker{}
 	checker.Init(checker, CheckerConfig{
@@ -114,7 +139,7 @@ func TestSelectiveUpdater(t *testing.T) {
 		Subscriptions:    map[string]StatusKind{"a": StatusOnline, "b": StatusOnline}})
 	resultsCh := make(chan StatusUpdateResults)
 	callback := func(res StatusUpdateResults) { resultsCh <- res }
-	checker.Start()
+	checker.Start(context.Background())
 	up := checker.Updater()
 
 	checker.online = toSet("c")
@@ -175,6 +200,445 @@ func TestSelectiveUpdater(t *testing.T) {
 	}
 }
 
+func TestSelectiveUpdaterEvents(t *testing.T) {
+	eventsCh := make(chan StatusUpdateResults, 10)
+	checker := &testSelectiveChecker{}
+	checker.Init(checker, CheckerConfig{
+		QueueSize:        queueSize,
+		SiteOnlineModels: toSet("a"),
+		Subscriptions:    map[string]StatusKind{"a": StatusOnline, "b": StatusOffline},
+		EventsCallback:   func(res StatusUpdateResults) { eventsCh <- res },
+	})
+	resultsCh := make(chan StatusUpdateResults)
+	callback := func(res StatusUpdateResults) { resultsCh <- res }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	up := checker.Updater().(EventUpdater)
+
+	up.PushEvents([]StatusUpdate{
+		{ModelID: "a", Status: StatusOffline},
+		{ModelID: "b", Status: StatusOnline},
+		{ModelID: "c", Status: StatusOnline},
+	}, map[string]StreamInfo{"b": {Title: "hi"}})
+	res := <-eventsCh
+	expected := map[string]StatusKind{"a": StatusOffline, "b": StatusOnline}
+	if uSet := updatesSet(res.Data.Updates); !reflect.DeepEqual(uSet, expected) {
+		t.Errorf("wrong updates, expected: %v, got: %v", expected, uSet)
+	}
+	if res.Data.Info["b"].Title != "hi" {
+		t.Errorf("wrong info, got: %v", res.Data.Info)
+	}
+
+	up.PushEvents([]StatusUpdate{{ModelID: "b", Status: StatusOnline}}, nil)
+	select {
+	case res := <-eventsCh:
+		t.Errorf("unexpected updates, %v", res.Data.Updates)
+	default:
+	}
+
+	checker.online = toSet("b", "c")
+	if err := up.PushUpdateRequest(StatusUpdateRequest{
+		Callback:      callback,
+		Subscriptions: map[string]StatusKind{"a": StatusOffline, "b": StatusOnline},
+	}); err != nil {
+		t.Errorf("cannot query updates, %v", err)
+		return
+	}
+	if updates := (<-resultsCh).Data.Updates; len(updates) != 0 {
+		t.Errorf("unexpected updates after events, %v", updates)
+	}
+}
+
+type testEndpointsChecker struct {
+	testFullChecker
+	endpoints map[string]map[string]bool
+	failing   map[string]int
+	mu        sync.Mutex
+}
+
+func (c *testEndpointsChecker) CheckEndpoint(_ context.Context, endpoint string) (onlineModels map[string]StatusKind, info map[string]StreamInfo, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failing[endpoint] > 0 {
+		c.failing[endpoint]--
+		return nil, nil, errors.New("error")
+	}
+	return onlineStatuses(c.endpoints[endpoint]), nil, nil
+}
+
+func (c *testEndpointsChecker) setFailing(endpoint string, times int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failing[endpoint] = times
+}
+
+func (c *testEndpointsChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
+func (c *testEndpointsChecker) CreateUpdater() Updater    { return c.CreateFullUpdater(c) }
+
+func TestPartialEndpointsFailure(t *testing.T) {
+	checker := &testEndpointsChecker{
+		endpoints: map[string]map[string]bool{"e1": toSet("a", "b"), "e2": toSet("c", "d")},
+		failing:   map[string]int{},
+	}
+	checker.Init(checker, CheckerConfig{
+		UsersOnlineEndpoints: []string{"e1", "e2"},
+		QueueSize:            queueSize,
+		SiteOnlineModels:     toSet("a", "c"),
+		EndpointRetries:      1,
+	})
+	resultsCh := make(chan StatusUpdateResults)
+	callback := func(res StatusUpdateResults) { resultsCh <- res }
+	checker.Start(context.Background())
+	up := checker.Updater()
+	push := func() StatusUpdateResults {
+		if err := up.PushUpdateRequest(StatusUpdateRequest{Callback: callback, Subscriptions: map[string]StatusKind{}}); err != nil {
+			t.Errorf("cannot query updates, %v", err)
+		}
+		return <-resultsCh
+	}
+
+	checker.setFailing("e2", 2)
+	res := push()
+	uSet := updatesSet(res.Data.Updates)
+	expected := map[string]StatusKind{"b": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) || len(res.Errors) != 1 {
+		t.Errorf("wrong updates for a never seen failed endpoint, expected: %v, got: %v, errors: %d", expected, uSet, len(res.Errors))
+	}
+
+	checker.setFailing("e2", 1)
+	res = push()
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"d": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) || len(res.Errors) != 0 {
+		t.Errorf("wrong updates after a retry, expected: %v, got: %v, errors: %d", expected, uSet, len(res.Errors))
+	}
+
+	checker.mu.Lock()
+	checker.endpoints = map[string]map[string]bool{"e1": toSet("a"), "e2": toSet()}
+	checker.mu.Unlock()
+	checker.setFailing("e2", 2)
+	res = push()
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"b": StatusOffline}
+	if !reflect.DeepEqual(uSet, expected) {
+		t.Errorf("models of a failed endpoint are marked offline, expected: %v, got: %v", expected, uSet)
+	}
+
+	checker.setFailing("e1", 2)
+	checker.setFailing("e2", 2)
+	if res = push(); res.Data != nil || len(res.Errors) != 1 {
+		t.Errorf("expected a failure when all endpoints fail, got: %v", res)
+	}
+}
+
+func TestMassOfflineGuard(t *testing.T) {
+	checker := &testFullChecker{}
+	checker.Init(checker, CheckerConfig{
+		UsersOnlineEndpoints: []string{""},
+		QueueSize:            queueSize,
+		SiteOnlineModels:     toSet("a", "b", "c", "d"),
+		MassOfflineGuard:     MassOfflineGuard{Percent: 50},
+	})
+	resultsCh := make(chan StatusUpdateResults)
+	callback := func(res StatusUpdateResults) { resultsCh <- res }
+	checker.Start(context.Background())
+	up := checker.Updater()
+	push := func() StatusUpdateResults {
+		if err := up.PushUpdateRequest(StatusUpdateRequest{Callback: callback, Subscriptions: map[string]StatusKind{}}); err != nil {
+			t.Errorf("cannot query updates, %v", err)
+		}
+		return <-resultsCh
+	}
+
+	checker.online = toSet("a", "b", "e")
+	res := push()
+	uSet := updatesSet(res.Data.Updates)
+	expected := map[string]StatusKind{"c": StatusOffline, "d": StatusOffline, "e": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) || res.MassOffline != nil {
+		t.Errorf("wrong updates within the limit, expected: %v, got: %v", expected, uSet)
+	}
+
+	checker.online = toSet("f")
+	res = push()
+	if res.Data != nil || len(res.Errors) != 1 || res.MassOffline == nil || *res.MassOffline != (MassOfflineDrop{Previous: 3, Offline: 3}) || res.Errors[0].Kind != ErrorKindIncomplete {
+		t.Errorf("the guard is not tripped, got: %+v", res)
+	}
+
+	checker.online = toSet("a", "d", "e")
+	res = push()
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"b": StatusOffline, "d": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) {
+		t.Errorf("the previous snapshot is not kept, expected: %v, got: %v", expected, uSet)
+	}
+
+	checker.online = toSet("f")
+	for i := 1; i < DefaultMassOfflineGuardPolls; i++ {
+		if res = push(); res.Data != nil || res.MassOffline == nil {
+			t.Errorf("the guard is not tripped by a persistent drop, got: %+v", res)
+		}
+	}
+	res = push()
+	if res.Data == nil {
+		t.Fatalf("a persistent drop is not accepted, got: %+v", res)
+	}
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"a": StatusOffline, "d": StatusOffline, "e": StatusOffline, "f": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) || res.MassOffline != nil {
+		t.Errorf("wrong updates for a persistent drop, expected: %v, got: %v", expected, uSet)
+	}
+
+	if (MassOfflineGuard{Count: 2}).Trips(100, 2) || !(MassOfflineGuard{Count: 2}).Trips(100, 3) {
+		t.Error("wrong absolute guard")
+	}
+	if (MassOfflineGuard{}).Trips(100, 100) {
+		t.Error("an empty guard trips")
+	}
+}
+
+type testCoverageChecker struct {
+	testFullChecker
+	total int
+}
+
+func (c *testCoverageChecker) CheckEndpointCoverage(ctx context.Context, endpoint string) (map[string]StatusKind, map[string]StreamInfo, Coverage, error) {
+	statuses, info, err := c.CheckEndpoint(ctx, endpoint)
+	return statuses, info, Coverage{Collected: len(statuses), Total: c.total, Pages: 2}, err
+}
+
+func (c *testCoverageChecker) Start(ctx context.Context) { c.StartFullCheckerDaemon(ctx, c) }
+func (c *testCoverageChecker) CreateUpdater() Updater    { return c.CreateFullUpdater(c) }
+
+func TestCoverage(t *testing.T) {
+	checker := &testCoverageChecker{}
+	checker.Init(checker, CheckerConfig{
+		UsersOnlineEndpoints: []string{""},
+		QueueSize:            queueSize,
+		SiteOnlineModels:     toSet("a", "b", "c"),
+		MinCoveragePercent:   90,
+	})
+	resultsCh := make(chan StatusUpdateResults)
+	callback := func(res StatusUpdateResults) { resultsCh <- res }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	up := checker.Updater()
+	push := func() StatusUpdateResults {
+		if err := up.PushUpdateRequest(StatusUpdateRequest{Callback: callback, Subscriptions: map[string]StatusKind{}}); err != nil {
+			t.Errorf("cannot query updates, %v", err)
+		}
+		return <-resultsCh
+	}
+
+	checker.online = toSet("a", "d")
+	checker.total = 4
+	res := push()
+	uSet := updatesSet(res.Data.Updates)
+	expected := map[string]StatusKind{"d": StatusOnline}
+	if !reflect.DeepEqual(uSet, expected) || len(res.Errors) != 1 {
+		t.Errorf("models missing in an untrusted list are marked offline, expected: %v, got: %v, errors: %d", expected, uSet, len(res.Errors))
+	}
+	if res.Data.Coverage == nil || *res.Data.Coverage != (Coverage{Collected: 2, Total: 4, Pages: 2}) {
+		t.Errorf("wrong coverage, got: %v", res.Data.Coverage)
+	}
+	if _, ok := res.Data.EndpointsElapsed[""]; !ok || len(res.Data.EndpointsElapsed) != 1 {
+		t.Errorf("wrong endpoint durations, got: %v", res.Data.EndpointsElapsed)
+	}
+
+	checker.total = 2
+	res = push()
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"b": StatusOffline, "c": StatusOffline}
+	if !reflect.DeepEqual(uSet, expected) || len(res.Errors) != 0 {
+		t.Errorf("wrong updates for a trusted list, expected: %v, got: %v, errors: %d", expected, uSet, len(res.Errors))
+	}
+
+	checker.online = toSet("a")
+	checker.total = 4
+	for i := 1; i < maxUntrustedMisses; i++ {
+		if res = push(); len(res.Data.Updates) != 0 || len(res.Errors) != 1 {
+			t.Errorf("a model missing in an untrusted list is not retained, got: %v, errors: %d", res.Data.Updates, len(res.Errors))
+		}
+	}
+	res = push()
+	uSet = updatesSet(res.Data.Updates)
+	expected = map[string]StatusKind{"d": StatusOffline}
+	if !reflect.DeepEqual(uSet, expected) {
+		t.Errorf("a model missing in untrusted lists is retained forever, expected: %v, got: %v", expected, uSet)
+	}
+
+	if !(Coverage{Collected: 5}).Trusted(90) || (Coverage{Collected: 5, Total: 10}).Trusted(90) || !(Coverage{Collected: 5, Total: 10}).Trusted(0) {
+		t.Error("wrong trust")
+	}
+	if sum := (Coverage{Collected: 1, Total: 2, Pages: 1}).Add(Coverage{Collected: 3, Pages: 2}); sum != (Coverage{Collected: 4, Pages: 3}) {
+		t.Errorf("wrong sum, got: %v", sum)
+	}
+}
+
+func TestSubStates(t *testing.T) {
+	checker := &testFullChecker{}
+	checker.Init(checker, CheckerConfig{
+		UsersOnlineEndpoints: []string{""},
+		QueueSize:            queueSize,
+		SiteOnlineModels:     toSet("a"),
+		SiteSubStates:        map[string]SubState{"a": SubStatePublic},
+	})
+	resultsCh := make(chan StatusUpdateResults)
+	callback := func(res StatusUpdateResults) { resultsCh <- res }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+	up := checker.Updater()
+
+	check := func(online map[string]bool, info map[string]StreamInfo, expected map[string]SubState) {
+		t.Helper()
+		checker.online = online
+		checker.info = info
+		if err := up.PushUpdateRequest(StatusUpdateRequest{Callback: callback}); err != nil {
+			t.Errorf("cannot query updates, %v", err)
+			return
+		}
+		res := <-resultsCh
+		if res.Data == nil {
+			t.Error("unexpected error")
+			return
+		}
+		got := map[string]SubState{}
+		for _, u := range res.Data.Updates {
+			if u.Status != StatusOnline {
+				t.Errorf("unexpected update %v", u)
+			}
+			got[u.ModelID] = u.SubState
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("wrong sub-state updates, expected: %v, got: %v", expected, got)
+		}
+	}
+
+	check(
+		toSet("a", "b"),
+		map[string]StreamInfo{"a": {SubState: SubStatePrivate}, "b": {SubState: SubStateGroup}},
+		map[string]SubState{"a": SubStatePrivate, "b": SubStateGroup})
+	check(
+		toSet("a", "b"),
+		map[string]StreamInfo{"a": {SubState: SubStatePrivate}},
+		map[string]SubState{})
+	check(
+		toSet("a", "b"),
+		map[string]StreamInfo{"a": {SubState: SubStatePublic}, "b": {SubState: SubStateGroup}},
+		map[string]SubState{"a": SubStatePublic})
+}
+
+func TestCancellation(t *testing.T) {
+	checker := &testFullChecker{}
+	checker.Init(checker, CheckerConfig{UsersOnlineEndpoints: []string{""}, QueueSize: queueSize, PollTimeoutSeconds: 1})
+	checker.block = true
+	resultsCh := make(chan StatusResults)
+	callback := func(res StatusResults) { resultsCh <- res }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+
+	if err := checker.PushStatusRequest(StatusRequest{Callback: callback}); err != nil {
+		t.Errorf("cannot query statuses, %v", err)
+		return
+	}
+	res := <-resultsCh
+	if res.Data != nil || len(res.Errors) != 1 {
+		t.Errorf("the poll deadline is not respected, got: %v", res)
+	}
+
+	// The daemon takes no more requests once cancelled, so it is cancelled only after the check starts
+	checker.started = make(chan bool)
+	if err := checker.PushStatusRequest(StatusRequest{Callback: callback}); err != nil {
+		t.Errorf("cannot query statuses, %v", err)
+		return
+	}
+	<-checker.started
+	cancel()
+	res = <-resultsCh
+	if res.Data != nil || len(res.Errors) != 1 {
+		t.Errorf("the check is not cancelled, got: %v", res)
+	}
+}
+
+// testSingleChecker reports the models starting with "on" online and blocks on the models starting with "slow"
+type testSingleChecker struct {
+	testFullChecker
+	mu      sync.Mutex
+	running int
+	maxRun  int
+}
+
+func (c *testSingleChecker) CheckStatusSingle(ctx context.Context, modelID string) (StatusKind, StreamInfo) {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.maxRun {
+		c.maxRun = c.running
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.running--
+		c.mu.Unlock()
+	}()
+	switch {
+	case strings.HasPrefix(modelID, "slow"):
+		<-ctx.Done()
+		return StatusUnknown, StreamInfo{}
+	case strings.HasPrefix(modelID, "on"):
+		_ = Sleep(ctx, 10*time.Millisecond)
+		return StatusOnline, StreamInfo{ImageURL: modelID}
+	}
+	_ = Sleep(ctx, 10*time.Millisecond)
+	return StatusOffline, StreamInfo{}
+}
+
+func (c *testSingleChecker) CreateUpdater() Updater { return c.CreateFullUpdater(c) }
+
+func TestParallelSingleChecks(t *testing.T) {
+	checker := &testSingleChecker{}
+	clients := []*Client{
+		{Limiter: NewRateLimiter(1000, 3)},
+		{Limiter: NewRateLimiter(1000, 2)},
+	}
+	checker.Init(checker, CheckerConfig{
+		UsersOnlineEndpoints:      []string{""},
+		Clients:                   clients,
+		QueueSize:                 queueSize,
+		SingleCheckTimeoutSeconds: 1,
+	})
+	specific := map[string]bool{"slow1": true, "slow2": true}
+	expected := map[string]StatusKind{"slow1": StatusUnknown, "slow2": StatusUnknown}
+	for i := 0; i < 20; i++ {
+		specific[fmt.Sprintf("on%02d", i)] = true
+		expected[fmt.Sprintf("on%02d", i)] = StatusOnline
+		specific[fmt.Sprintf("off%02d", i)] = true
+		expected[fmt.Sprintf("off%02d", i)] = StatusOffline
+	}
+	resultsCh := make(chan StatusResults, 1)
+	start := time.Now()
+	checker.checkFull(context.Background(), checker, StatusRequest{Specific: specific, Callback: func(res StatusResults) { resultsCh <- res }})
+	res := <-resultsCh
+	elapsed := time.Since(start)
+	if res.Data == nil || !reflect.DeepEqual(res.Data.Statuses, expected) {
+		t.Fatalf("wrong statuses, expected: %v, got: %v", expected, res)
+	}
+	if len(res.Data.Info) != 20 || res.Data.Info["on07"].ImageURL != "on07" {
+		t.Errorf("wrong info %v", res.Data.Info)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Error() != "status for model slow1 reported: unknown" || res.Errors[1].Error() != "status for model slow2 reported: unknown" {
+		t.Errorf("wrong errors %v", res.Errors)
+	}
+	if checker.maxRun != 5 {
+		t.Errorf("wrong number of parallel checks, expected: 5, got: %d", checker.maxRun)
+	}
+	if elapsed > 1500*time.Millisecond {
+		t.Errorf("the single checks are not parallel, elapsed: %v", elapsed)
+	}
+}
+
 func toSet(xs ...string) map[string]bool {
 	result := map[string]bool{}
 	for _, x := range xs {